@@ -0,0 +1,494 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"hash/maphash"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var ErrEntryTooLarge = errors.New("cache: entry exceeds the size bound")
+
+type EvictionPolicy int
+
+const (
+	// PolicyLRU evicts the least recently used entry.
+	PolicyLRU EvictionPolicy = iota
+	// PolicyLFU evicts the least frequently used entry, the least recently used one among ties.
+	PolicyLFU
+	// PolicyTinyLFU is W-TinyLFU: new entries enter a small LRU window and only displace an entry of the
+	// main LRU when a frequency sketch estimates them as more popular. It resists scans better than LRU.
+	PolicyTinyLFU
+)
+
+type EvictionReason int
+
+const (
+	EvictionCapacity EvictionReason = iota
+	EvictionExpired
+)
+
+// EvictionFunc is called after an entry was dropped by the cache itself, not by Delete.
+// It runs outside the cache locks and may call back into the cache.
+type EvictionFunc func(key, value string, reason EvictionReason)
+
+const defaultBoundedShards = 16
+
+// BoundedCache is an in-memory Cache with an upper bound on entries and bytes. Keys are spread over
+// independently locked shards. The entry bound is split exactly between the shards, the byte bound
+// applies to the whole cache so that any entry up to the bound fits.
+type BoundedCache struct {
+	seed              maphash.Seed
+	shards            []*boundedShard
+	mask              uint64
+	maxBytes          int64
+	bytes             atomic.Int64
+	defaultExpiration time.Duration
+	onEvict           EvictionFunc
+}
+
+type boundedConfig struct {
+	maxBytes          int64
+	policy            EvictionPolicy
+	shards            int
+	defaultExpiration time.Duration
+	onEvict           EvictionFunc
+}
+
+type BoundedOption func(*boundedConfig)
+
+// WithMaxBytes bounds the total size of keys and values.
+func WithMaxBytes(maxBytes int64) BoundedOption {
+	return func(c *boundedConfig) {
+		c.maxBytes = maxBytes
+	}
+}
+
+func WithEvictionPolicy(policy EvictionPolicy) BoundedOption {
+	return func(c *boundedConfig) {
+		c.policy = policy
+	}
+}
+
+// WithShards sets the number of shards, rounded down to a power of two. It defaults to 16 and is
+// lowered for small bounds so every shard keeps a useful share of the entries.
+func WithShards(shards int) BoundedOption {
+	return func(c *boundedConfig) {
+		c.shards = shards
+	}
+}
+
+// WithDefaultExpiration is used for Set calls with a zero expiration.
+func WithDefaultExpiration(expiration time.Duration) BoundedOption {
+	return func(c *boundedConfig) {
+		c.defaultExpiration = expiration
+	}
+}
+
+func WithEvictionCallback(onEvict EvictionFunc) BoundedOption {
+	return func(c *boundedConfig) {
+		c.onEvict = onEvict
+	}
+}
+
+// NewBoundedCache creates a cache holding at most maxEntries entries, zero means no entry bound.
+func NewBoundedCache(maxEntries int, opts ...BoundedOption) *BoundedCache {
+	config := boundedConfig{shards: defaultBoundedShards}
+	for _, opt := range opts {
+		opt(&config)
+	}
+
+	shards := 1
+	for shards*2 <= config.shards {
+		shards *= 2
+	}
+	for shards > 1 && maxEntries > 0 && maxEntries/shards < 8 {
+		shards /= 2
+	}
+
+	c := &BoundedCache{
+		seed:              maphash.MakeSeed(),
+		shards:            make([]*boundedShard, shards),
+		mask:              uint64(shards - 1),
+		maxBytes:          config.maxBytes,
+		defaultExpiration: config.defaultExpiration,
+		onEvict:           config.onEvict,
+	}
+	for i := range c.shards {
+		// The first maxEntries%shards shards take one extra entry so the shares add up to maxEntries.
+		share := int64(maxEntries / shards)
+		if i < maxEntries%shards {
+			share++
+		}
+		c.shards[i] = newBoundedShard(share, config.maxBytes, &c.bytes, config.policy)
+	}
+	return c
+}
+
+func (c *BoundedCache) Get(ctx context.Context, key string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	value, found, evicted := c.shard(key).get(key, time.Now())
+	c.notify(evicted)
+	if !found {
+		return "", ErrNotFound
+	}
+	return value, nil
+}
+
+func (c *BoundedCache) Set(ctx context.Context, key string, value string, expiration time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	evicted, err := c.shard(key).set(key, value, c.expiresAt(expiration, time.Now()))
+	c.notify(append(evicted, c.shrink(key)...))
+	return err
+}
+
+func (c *BoundedCache) Delete(ctx context.Context, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	c.shard(key).delete(key)
+	return nil
+}
+
+func (c *BoundedCache) TTL(ctx context.Context, key string) (time.Duration, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	var ttl time.Duration
+	found := false
+	evicted, _ := c.shard(key).mutate(key, now, func(e *boundedEntry) (string, time.Time, bool, error) {
+		if e != nil {
+			found = true
+			ttl = remainingTTL(e.expiresAt, now)
+		}
+		return "", time.Time{}, false, nil
+	})
+	c.notify(evicted)
+	if !found {
+		return 0, ErrNotFound
+	}
+	return ttl, nil
+}
+
+func (c *BoundedCache) SetNX(ctx context.Context, key string, value string, expiration time.Duration) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	now := time.Now()
+	stored := false
+	evicted, err := c.shard(key).mutate(key, now, func(e *boundedEntry) (string, time.Time, bool, error) {
+		stored = e == nil
+		return value, c.expiresAt(expiration, now), stored, nil
+	})
+	c.notify(append(evicted, c.shrink(key)...))
+	return stored && err == nil, err
+}
+
+func (c *BoundedCache) CompareAndSwap(ctx context.Context, key string, oldValue, newValue string, expiration time.Duration) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	now := time.Now()
+	swapped := false
+	evicted, err := c.shard(key).mutate(key, now, func(e *boundedEntry) (string, time.Time, bool, error) {
+		swapped = e != nil && e.value == oldValue
+		return newValue, c.expiresAt(expiration, now), swapped, nil
+	})
+	c.notify(append(evicted, c.shrink(key)...))
+	return swapped && err == nil, err
+}
+
+func (c *BoundedCache) Incr(ctx context.Context, key string, delta int64, expiration time.Duration) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	var n int64
+	evicted, err := c.shard(key).mutate(key, now, func(e *boundedEntry) (string, time.Time, bool, error) {
+		if e == nil {
+			n = delta
+			return strconv.FormatInt(n, 10), c.expiresAt(expiration, now), true, nil
+		}
+		var err error
+		if n, err = addToInteger(e.value, true, delta); err != nil {
+			return "", time.Time{}, false, err
+		}
+		return strconv.FormatInt(n, 10), e.expiresAt, true, nil
+	})
+	c.notify(append(evicted, c.shrink(key)...))
+	return n, err
+}
+
+// Len returns the number of entries, including expired ones that have not been dropped yet.
+func (c *BoundedCache) Len() int {
+	n := 0
+	for _, s := range c.shards {
+		s.mutex.Lock()
+		n += len(s.items)
+		s.mutex.Unlock()
+	}
+	return n
+}
+
+// DeleteExpired drops all expired entries.
+func (c *BoundedCache) DeleteExpired() {
+	now := time.Now()
+	for _, s := range c.shards {
+		c.notify(s.deleteExpired(now))
+	}
+}
+
+func (c *BoundedCache) expiresAt(expiration time.Duration, now time.Time) time.Time {
+	if expiration == 0 {
+		expiration = c.defaultExpiration
+	}
+	if expiration <= 0 {
+		return time.Time{}
+	}
+	return now.Add(expiration)
+}
+
+func (c *BoundedCache) shard(key string) *boundedShard {
+	return c.shards[maphash.String(c.seed, key)&c.mask]
+}
+
+// shrink evicts from all shards in turn while the cache is over its byte bound, which a write can
+// leave it when its own shard had nothing left to evict. The entry for key, just written, is kept.
+func (c *BoundedCache) shrink(key string) []eviction {
+	if c.maxBytes <= 0 {
+		return nil
+	}
+	var evicted []eviction
+	for c.bytes.Load() > c.maxBytes {
+		progress := false
+		for _, s := range c.shards {
+			if c.bytes.Load() <= c.maxBytes {
+				break
+			}
+			if victim := s.evictOne(key); victim != nil {
+				evicted = append(evicted, eviction{entry: victim, reason: EvictionCapacity})
+				progress = true
+			}
+		}
+		if !progress {
+			break
+		}
+	}
+	return evicted
+}
+
+func (c *BoundedCache) notify(evicted []eviction) {
+	if c.onEvict == nil {
+		return
+	}
+	for _, e := range evicted {
+		c.onEvict(e.entry.key, e.entry.value, e.reason)
+	}
+}
+
+type boundedEntry struct {
+	key       string
+	value     string
+	expiresAt time.Time
+	// element is the entry's position in the policy lists, freq is only used by PolicyLFU.
+	element *list.Element
+	freq    int
+	window  bool
+}
+
+func (e *boundedEntry) size() int64 {
+	return int64(len(e.key) + len(e.value))
+}
+
+func (e *boundedEntry) expired(now time.Time) bool {
+	return !e.expiresAt.IsZero() && now.After(e.expiresAt)
+}
+
+type eviction struct {
+	entry  *boundedEntry
+	reason EvictionReason
+}
+
+// evictionPolicy orders the entries of one shard. The shard holds the lock while calling it.
+type evictionPolicy interface {
+	// record counts a lookup or write of key, whether it is cached or not.
+	record(key string)
+	add(e *boundedEntry)
+	access(e *boundedEntry)
+	remove(e *boundedEntry)
+	// victim returns the entry to evict next, nil when the policy holds no entries.
+	victim() *boundedEntry
+	// settle runs after an insert and its evictions.
+	settle()
+}
+
+type boundedShard struct {
+	mutex      sync.Mutex
+	items      map[string]*boundedEntry
+	policy     evictionPolicy
+	maxEntries int64
+	// maxBytes and bytes are the bound and size of the whole cache, shared by all shards.
+	maxBytes int64
+	bytes    *atomic.Int64
+}
+
+func newBoundedShard(maxEntries, maxBytes int64, bytes *atomic.Int64, policy EvictionPolicy) *boundedShard {
+	s := &boundedShard{
+		items:      make(map[string]*boundedEntry),
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+		bytes:      bytes,
+	}
+	switch policy {
+	case PolicyLFU:
+		s.policy = newLFUPolicy()
+	case PolicyTinyLFU:
+		s.policy = newTinyLFUPolicy(maxEntries)
+	default:
+		s.policy = newLRUPolicy()
+	}
+	return s
+}
+
+func (s *boundedShard) get(key string, now time.Time) (string, bool, []eviction) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.policy.record(key)
+	e, ok := s.items[key]
+	if !ok {
+		return "", false, nil
+	}
+	if e.expired(now) {
+		s.removeEntry(e)
+		return "", false, []eviction{{entry: e, reason: EvictionExpired}}
+	}
+	s.policy.access(e)
+	return e.value, true, nil
+}
+
+func (s *boundedShard) set(key, value string, expiresAt time.Time) ([]eviction, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.setLocked(key, value, expiresAt)
+}
+
+// mutate calls fn with the live entry for key, nil if it is missing or expired, and stores the
+// value fn returns if store is true, all under the shard lock.
+func (s *boundedShard) mutate(key string, now time.Time, fn func(e *boundedEntry) (value string, expiresAt time.Time, store bool, err error)) ([]eviction, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var evicted []eviction
+	e, ok := s.items[key]
+	if ok && e.expired(now) {
+		s.removeEntry(e)
+		evicted = append(evicted, eviction{entry: e, reason: EvictionExpired})
+		e = nil
+	}
+
+	value, expiresAt, store, err := fn(e)
+	if err != nil || !store {
+		return evicted, err
+	}
+	more, err := s.setLocked(key, value, expiresAt)
+	return append(evicted, more...), err
+}
+
+func (s *boundedShard) setLocked(key, value string, expiresAt time.Time) ([]eviction, error) {
+	if s.maxBytes > 0 && int64(len(key)+len(value)) > s.maxBytes {
+		return nil, ErrEntryTooLarge
+	}
+	s.policy.record(key)
+
+	e, ok := s.items[key]
+	if ok {
+		s.bytes.Add(int64(len(value) - len(e.value)))
+		e.value = value
+		e.expiresAt = expiresAt
+		s.policy.access(e)
+	} else {
+		e = &boundedEntry{key: key, value: value, expiresAt: expiresAt}
+		s.items[key] = e
+		s.bytes.Add(e.size())
+		s.policy.add(e)
+	}
+
+	var evicted []eviction
+	for {
+		overEntries := s.maxEntries > 0 && int64(len(s.items)) > s.maxEntries
+		overBytes := s.maxBytes > 0 && s.bytes.Load() > s.maxBytes
+		if !overEntries && !overBytes {
+			break
+		}
+		victim := s.policy.victim()
+		// Over the byte bound alone, the new entry stays and other shards give up space instead.
+		if victim == nil || (!overEntries && victim == e) {
+			break
+		}
+		s.removeEntry(victim)
+		evicted = append(evicted, eviction{entry: victim, reason: EvictionCapacity})
+	}
+	s.policy.settle()
+	return evicted, nil
+}
+
+func (s *boundedShard) delete(key string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if e, ok := s.items[key]; ok {
+		s.removeEntry(e)
+	}
+}
+
+func (s *boundedShard) deleteExpired(now time.Time) []eviction {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var evicted []eviction
+	for _, e := range s.items {
+		if e.expired(now) {
+			s.removeEntry(e)
+			evicted = append(evicted, eviction{entry: e, reason: EvictionExpired})
+		}
+	}
+	return evicted
+}
+
+// evictOne evicts the shard's next victim unless it is the entry for keep.
+func (s *boundedShard) evictOne(keep string) *boundedEntry {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	victim := s.policy.victim()
+	if victim == nil || victim.key == keep {
+		return nil
+	}
+	s.removeEntry(victim)
+	s.policy.settle()
+	return victim
+}
+
+func (s *boundedShard) removeEntry(e *boundedEntry) {
+	delete(s.items, e.key)
+	s.bytes.Add(-e.size())
+	s.policy.remove(e)
+}
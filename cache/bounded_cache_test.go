@@ -0,0 +1,277 @@
+package cache
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBoundedCache_Set_Get_Delete(t *testing.T) {
+	bc := NewBoundedCache(100)
+	ctx := context.Background()
+
+	require.NoError(t, bc.Set(ctx, "key", "value", time.Minute))
+	val, err := bc.Get(ctx, "key")
+	require.NoError(t, err)
+	assert.Equal(t, "value", val)
+
+	require.NoError(t, bc.Set(ctx, "key", "updated", time.Minute))
+	val, err = bc.Get(ctx, "key")
+	require.NoError(t, err)
+	assert.Equal(t, "updated", val)
+
+	require.NoError(t, bc.Delete(ctx, "key"))
+	_, err = bc.Get(ctx, "key")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	assert.Error(t, bc.Set(canceled, "key", "value", time.Minute))
+	_, err = bc.Get(canceled, "key")
+	assert.Error(t, err)
+	assert.Error(t, bc.Delete(canceled, "key"))
+}
+
+func TestBoundedCache_Expiration(t *testing.T) {
+	var evicted []string
+	bc := NewBoundedCache(100, WithEvictionCallback(func(key, value string, reason EvictionReason) {
+		assert.Equal(t, EvictionExpired, reason)
+		evicted = append(evicted, key)
+	}))
+	ctx := context.Background()
+
+	require.NoError(t, bc.Set(ctx, "short", "v", 20*time.Millisecond))
+	require.NoError(t, bc.Set(ctx, "other", "v", 20*time.Millisecond))
+	require.NoError(t, bc.Set(ctx, "forever", "v", 0))
+	time.Sleep(40 * time.Millisecond)
+
+	_, err := bc.Get(ctx, "short")
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, err = bc.Get(ctx, "forever")
+	assert.NoError(t, err)
+
+	bc.DeleteExpired()
+	assert.Equal(t, 1, bc.Len())
+	assert.ElementsMatch(t, []string{"short", "other"}, evicted)
+}
+
+func TestBoundedCache_LRU(t *testing.T) {
+	var evicted []string
+	bc := NewBoundedCache(3, WithEvictionCallback(func(key, value string, reason EvictionReason) {
+		assert.Equal(t, EvictionCapacity, reason)
+		evicted = append(evicted, key)
+	}))
+	ctx := context.Background()
+	require.Len(t, bc.shards, 1)
+
+	for _, k := range []string{"a", "b", "c"} {
+		require.NoError(t, bc.Set(ctx, k, k, time.Minute))
+	}
+	_, err := bc.Get(ctx, "a")
+	require.NoError(t, err)
+	require.NoError(t, bc.Set(ctx, "d", "d", time.Minute))
+
+	assert.Equal(t, []string{"b"}, evicted)
+	assert.Equal(t, 3, bc.Len())
+	_, err = bc.Get(ctx, "a")
+	assert.NoError(t, err)
+}
+
+func TestBoundedCache_LFU(t *testing.T) {
+	bc := NewBoundedCache(3, WithEvictionPolicy(PolicyLFU))
+	ctx := context.Background()
+
+	for _, k := range []string{"a", "b", "c"} {
+		require.NoError(t, bc.Set(ctx, k, k, time.Minute))
+	}
+	for i := 0; i < 3; i++ {
+		_, _ = bc.Get(ctx, "a")
+		_, _ = bc.Get(ctx, "c")
+	}
+	_, _ = bc.Get(ctx, "b")
+
+	// b is the least frequently used even though it was used last.
+	require.NoError(t, bc.Set(ctx, "d", "d", time.Minute))
+	_, err := bc.Get(ctx, "b")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	// d now has the lowest count and goes next.
+	require.NoError(t, bc.Set(ctx, "e", "e", time.Minute))
+	_, err = bc.Get(ctx, "d")
+	assert.ErrorIs(t, err, ErrNotFound)
+	for _, k := range []string{"a", "c", "e"} {
+		_, err = bc.Get(ctx, k)
+		assert.NoError(t, err, k)
+	}
+}
+
+func TestBoundedCache_TinyLFU_ResistsScans(t *testing.T) {
+	bc := NewBoundedCache(100, WithEvictionPolicy(PolicyTinyLFU), WithShards(1))
+	ctx := context.Background()
+
+	hot := make([]string, 50)
+	for i := range hot {
+		hot[i] = "hot-" + strconv.Itoa(i)
+		require.NoError(t, bc.Set(ctx, hot[i], "v", time.Minute))
+	}
+	for round := 0; round < 5; round++ {
+		for _, k := range hot {
+			_, _ = bc.Get(ctx, k)
+		}
+	}
+
+	// A one-off scan much larger than the cache.
+	for i := 0; i < 1000; i++ {
+		require.NoError(t, bc.Set(ctx, "scan-"+strconv.Itoa(i), "v", time.Minute))
+	}
+
+	hits := 0
+	for _, k := range hot {
+		if _, err := bc.Get(ctx, k); err == nil {
+			hits++
+		}
+	}
+	assert.GreaterOrEqual(t, hits, 45)
+	assert.LessOrEqual(t, bc.Len(), 100)
+}
+
+func TestBoundedCache_MaxBytes(t *testing.T) {
+	var evicted []string
+	bc := NewBoundedCache(0, WithMaxBytes(30), WithShards(1), WithEvictionCallback(func(key, value string, reason EvictionReason) {
+		evicted = append(evicted, key)
+	}))
+	ctx := context.Background()
+
+	require.NoError(t, bc.Set(ctx, "a", strings.Repeat("x", 9), time.Minute))
+	require.NoError(t, bc.Set(ctx, "b", strings.Repeat("x", 9), time.Minute))
+	require.NoError(t, bc.Set(ctx, "c", strings.Repeat("x", 9), time.Minute))
+	assert.Empty(t, evicted)
+
+	require.NoError(t, bc.Set(ctx, "d", strings.Repeat("x", 9), time.Minute))
+	assert.Equal(t, []string{"a"}, evicted)
+
+	assert.ErrorIs(t, bc.Set(ctx, "big", strings.Repeat("x", 40), time.Minute), ErrEntryTooLarge)
+}
+
+func TestBoundedCache_MaxBytesAcrossShards(t *testing.T) {
+	var mutex sync.Mutex
+	var evicted []string
+	bc := NewBoundedCache(0, WithMaxBytes(1<<20), WithEvictionCallback(func(key, value string, reason EvictionReason) {
+		mutex.Lock()
+		evicted = append(evicted, key)
+		mutex.Unlock()
+	}))
+	require.Len(t, bc.shards, 16)
+	ctx := context.Background()
+
+	// Far more than a shard's share of the bound, but within the bound itself.
+	big := strings.Repeat("x", 600<<10)
+	require.NoError(t, bc.Set(ctx, "big1", big, time.Minute))
+	val, err := bc.Get(ctx, "big1")
+	require.NoError(t, err)
+	assert.Len(t, val, len(big))
+
+	// The second one only fits once the first, likely in another shard, is evicted.
+	require.NoError(t, bc.Set(ctx, "big2", big, time.Minute))
+	assert.Equal(t, []string{"big1"}, evicted)
+	assert.LessOrEqual(t, bc.bytes.Load(), int64(1<<20))
+
+	for i := 0; i < 1000; i++ {
+		key := strconv.Itoa(i)
+		require.NoError(t, bc.Set(ctx, key, strings.Repeat("v", 1<<10), time.Minute))
+		assert.LessOrEqual(t, bc.bytes.Load(), int64(1<<20))
+	}
+	assert.ErrorIs(t, bc.Set(ctx, "huge", strings.Repeat("x", 1<<20), time.Minute), ErrEntryTooLarge)
+}
+
+func TestBoundedCache_ExactEntryBound(t *testing.T) {
+	bc := NewBoundedCache(1001)
+	ctx := context.Background()
+	for i := 0; i < 5000; i++ {
+		require.NoError(t, bc.Set(ctx, strconv.Itoa(i), "v", time.Minute))
+	}
+	var shares int64
+	for _, s := range bc.shards {
+		shares += s.maxEntries
+	}
+	assert.Equal(t, int64(1001), shares)
+	assert.LessOrEqual(t, bc.Len(), 1001)
+}
+
+func TestBoundedCache_Sharding(t *testing.T) {
+	assert.Len(t, NewBoundedCache(10000).shards, 16)
+	assert.Len(t, NewBoundedCache(10000, WithShards(6)).shards, 4)
+	assert.Len(t, NewBoundedCache(32).shards, 4)
+	assert.Len(t, NewBoundedCache(0).shards, 16)
+}
+
+func TestBoundedCache_Concurrent(t *testing.T) {
+	for _, policy := range []EvictionPolicy{PolicyLRU, PolicyLFU, PolicyTinyLFU} {
+		bc := NewBoundedCache(1000, WithEvictionPolicy(policy))
+		ctx := context.Background()
+
+		var wg sync.WaitGroup
+		for g := 0; g < 8; g++ {
+			wg.Add(1)
+			go func(g int) {
+				defer wg.Done()
+				for i := 0; i < 2000; i++ {
+					key := strconv.Itoa((g*7919 + i) % 3000)
+					_ = bc.Set(ctx, key, key, time.Minute)
+					_, _ = bc.Get(ctx, key)
+					if i%10 == 0 {
+						_ = bc.Delete(ctx, key)
+					}
+				}
+			}(g)
+		}
+		wg.Wait()
+		assert.LessOrEqual(t, bc.Len(), 1000)
+	}
+}
+
+func benchmarkCache(b *testing.B, c Cache) {
+	ctx := context.Background()
+	keys := make([]string, 4096)
+	for i := range keys {
+		keys[i] = "key-" + strconv.Itoa(i)
+		_ = c.Set(ctx, keys[i], "value", time.Hour)
+	}
+
+	b.Run("Get", func(b *testing.B) {
+		b.RunParallel(func(pb *testing.PB) {
+			i := 0
+			for pb.Next() {
+				_, _ = c.Get(ctx, keys[i&4095])
+				i++
+			}
+		})
+	})
+	b.Run("Set", func(b *testing.B) {
+		b.RunParallel(func(pb *testing.PB) {
+			i := 0
+			for pb.Next() {
+				_ = c.Set(ctx, keys[i&4095], "value", time.Hour)
+				i++
+			}
+		})
+	})
+}
+
+func BenchmarkMemcache(b *testing.B) {
+	benchmarkCache(b, NewMemcache(time.Hour, 10*time.Minute))
+}
+
+func BenchmarkBoundedCache_LRU(b *testing.B) {
+	benchmarkCache(b, NewBoundedCache(8192))
+}
+
+func BenchmarkBoundedCache_TinyLFU(b *testing.B) {
+	benchmarkCache(b, NewBoundedCache(8192, WithEvictionPolicy(PolicyTinyLFU)))
+}
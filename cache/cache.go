@@ -2,11 +2,18 @@ package cache
 
 import (
 	"context"
+	"errors"
 	"time"
 )
 
+// ErrNotFound is returned by Get when the key does not exist or has expired.
+var ErrNotFound = errors.New("cache: key not found")
+
 type Cache interface {
+	// Get returns ErrNotFound when the key does not exist or has expired.
 	Get(ctx context.Context, key string) (string, error)
+	// Set stores value under key. An expiration of zero uses the backend default, which is no
+	// expiration unless the backend was configured otherwise, a negative expiration never expires.
 	Set(ctx context.Context, key string, value string, expiration time.Duration) error
 	Delete(ctx context.Context, key string) error
 }
@@ -0,0 +1,223 @@
+// Package cachetest provides a conformance suite for cache.Cache implementations.
+package cachetest
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Lumiaqian/go-sdk-core/cache"
+)
+
+// Factory returns a new, empty cache for every subtest. Use t.Cleanup to release it.
+type Factory func(t *testing.T) cache.Cache
+
+// Options tune the suite for backends with coarse expiry or size limits.
+type Options struct {
+	// ExpiryTTL is the short TTL used by the expiry tests, 50ms by default. Backends with second
+	// granularity, such as Redis with EXPIRE, should use at least a second.
+	ExpiryTTL time.Duration
+	// LargeValueSize is the size of the value in the large value test, 1 MiB by default.
+	LargeValueSize int
+	// SkipContextCancel skips the check that a canceled context fails every operation.
+	SkipContextCancel bool
+}
+
+// Run checks that the caches returned by newCache behave like the cache.Cache contract describes.
+func Run(t *testing.T, newCache Factory) {
+	RunWithOptions(t, newCache, Options{})
+}
+
+// RunWithOptions is Run with the suite tuned by opts.
+func RunWithOptions(t *testing.T, newCache Factory, opts Options) {
+	if opts.ExpiryTTL <= 0 {
+		opts.ExpiryTTL = 50 * time.Millisecond
+	}
+	if opts.LargeValueSize <= 0 {
+		opts.LargeValueSize = 1 << 20
+	}
+
+	t.Run("SetGet", func(t *testing.T) { testSetGet(t, newCache(t)) })
+	t.Run("NotFound", func(t *testing.T) { testNotFound(t, newCache(t)) })
+	t.Run("Overwrite", func(t *testing.T) { testOverwrite(t, newCache(t)) })
+	t.Run("Delete", func(t *testing.T) { testDelete(t, newCache(t)) })
+	t.Run("Expiry", func(t *testing.T) { testExpiry(t, newCache(t), opts.ExpiryTTL) })
+	t.Run("ZeroAndNegativeTTL", func(t *testing.T) { testZeroAndNegativeTTL(t, newCache(t), opts.ExpiryTTL) })
+	t.Run("Values", func(t *testing.T) { testValues(t, newCache(t), opts.LargeValueSize) })
+	if !opts.SkipContextCancel {
+		t.Run("ContextCancel", func(t *testing.T) { testContextCancel(t, newCache(t)) })
+	}
+	t.Run("Concurrent", func(t *testing.T) { testConcurrent(t, newCache(t)) })
+}
+
+func mustSet(t *testing.T, c cache.Cache, key, value string, ttl time.Duration) {
+	t.Helper()
+	if err := c.Set(context.Background(), key, value, ttl); err != nil {
+		t.Fatalf("Set(%q) returned error: %v", key, err)
+	}
+}
+
+func expectValue(t *testing.T, c cache.Cache, key, want string) {
+	t.Helper()
+	got, err := c.Get(context.Background(), key)
+	if err != nil {
+		t.Fatalf("Get(%q) returned error: %v", key, err)
+	}
+	if got != want {
+		t.Fatalf("Get(%q) = %q, want %q", key, truncate(got), truncate(want))
+	}
+}
+
+func expectNotFound(t *testing.T, c cache.Cache, key string) {
+	t.Helper()
+	got, err := c.Get(context.Background(), key)
+	if !errors.Is(err, cache.ErrNotFound) {
+		t.Fatalf("Get(%q) = %q, %v, want cache.ErrNotFound", key, truncate(got), err)
+	}
+}
+
+func testSetGet(t *testing.T, c cache.Cache) {
+	mustSet(t, c, "key", "value", time.Minute)
+	expectValue(t, c, "key", "value")
+}
+
+func testNotFound(t *testing.T, c cache.Cache) {
+	expectNotFound(t, c, "missing")
+}
+
+func testOverwrite(t *testing.T, c cache.Cache) {
+	mustSet(t, c, "key", "first", time.Minute)
+	mustSet(t, c, "key", "second", time.Minute)
+	expectValue(t, c, "key", "second")
+}
+
+func testDelete(t *testing.T, c cache.Cache) {
+	ctx := context.Background()
+	mustSet(t, c, "key", "value", time.Minute)
+	mustSet(t, c, "other", "value", time.Minute)
+
+	if err := c.Delete(ctx, "key"); err != nil {
+		t.Fatalf("Delete returned error: %v", err)
+	}
+	expectNotFound(t, c, "key")
+	expectValue(t, c, "other", "value")
+
+	if err := c.Delete(ctx, "missing"); err != nil {
+		t.Fatalf("Delete of a missing key returned error: %v", err)
+	}
+}
+
+func testExpiry(t *testing.T, c cache.Cache, ttl time.Duration) {
+	mustSet(t, c, "short", "value", ttl)
+	mustSet(t, c, "long", "value", time.Hour)
+	expectValue(t, c, "short", "value")
+
+	time.Sleep(ttl * 2)
+	expectNotFound(t, c, "short")
+	expectValue(t, c, "long", "value")
+
+	// Overwriting refreshes the expiry.
+	mustSet(t, c, "short", "again", time.Hour)
+	time.Sleep(ttl * 2)
+	expectValue(t, c, "short", "again")
+}
+
+func testZeroAndNegativeTTL(t *testing.T, c cache.Cache, ttl time.Duration) {
+	mustSet(t, c, "zero", "value", 0)
+	mustSet(t, c, "negative", "value", -1)
+	expectValue(t, c, "zero", "value")
+	expectValue(t, c, "negative", "value")
+
+	// A negative TTL never expires.
+	time.Sleep(ttl * 2)
+	expectValue(t, c, "negative", "value")
+}
+
+func testValues(t *testing.T, c cache.Cache, largeSize int) {
+	binary := make([]byte, 256)
+	for i := range binary {
+		binary[i] = byte(i)
+	}
+	values := map[string]string{
+		"empty":                            "",
+		"binary":                           string(binary),
+		"unicode":                          "令牌 🔑",
+		"large":                            strings.Repeat("x", largeSize),
+		"key with spaces/and:separators?&": "special",
+	}
+
+	for key, value := range values {
+		mustSet(t, c, key, value, time.Minute)
+	}
+	for key, value := range values {
+		expectValue(t, c, key, value)
+	}
+}
+
+func testContextCancel(t *testing.T, c cache.Cache) {
+	mustSet(t, c, "key", "value", time.Minute)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := c.Get(ctx, "key"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Get with a canceled context returned %v, want context.Canceled", err)
+	}
+	if err := c.Set(ctx, "key", "changed", time.Minute); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Set with a canceled context returned %v, want context.Canceled", err)
+	}
+	if err := c.Delete(ctx, "key"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Delete with a canceled context returned %v, want context.Canceled", err)
+	}
+	expectValue(t, c, "key", "value")
+}
+
+func testConcurrent(t *testing.T, c cache.Cache) {
+	const goroutines, iterations = 8, 50
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, goroutines)
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < iterations; i++ {
+				own := "own-" + strconv.Itoa(g) + "-" + strconv.Itoa(i)
+				if err := c.Set(ctx, own, own, time.Minute); err != nil {
+					errs <- err
+					return
+				}
+				if got, err := c.Get(ctx, own); err != nil || got != own {
+					errs <- errors.New("lost own write for " + own)
+					return
+				}
+				if err := c.Set(ctx, "shared", strconv.Itoa(g), time.Minute); err != nil {
+					errs <- err
+					return
+				}
+				if _, err := c.Get(ctx, "shared"); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Fatal(err)
+	}
+}
+
+func truncate(s string) string {
+	if len(s) > 64 {
+		return s[:64] + "..."
+	}
+	return s
+}
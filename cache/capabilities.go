@@ -0,0 +1,188 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// ErrNotSupported is returned by helpers for operations that cannot be emulated on a backend.
+var ErrNotSupported = errors.New("cache: operation not supported")
+
+// NoExpiration is the TTL reported for entries that never expire.
+const NoExpiration time.Duration = -1
+
+// The interfaces below are optional capabilities a Cache backend may implement. Use the helper
+// functions of the same name, which detect support and otherwise fall back to plain Get/Set/Delete.
+// Wrappers such as Namespaced implement every capability and return ErrNotSupported from the ones
+// the wrapped cache lacks, the helpers then fall back as well.
+
+type TTLCache interface {
+	// TTL returns the remaining lifetime of key, NoExpiration if it never expires or ErrNotFound.
+	TTL(ctx context.Context, key string) (time.Duration, error)
+}
+
+type SetNXCache interface {
+	// SetNX stores value only if key does not exist and reports whether it did.
+	SetNX(ctx context.Context, key string, value string, expiration time.Duration) (bool, error)
+}
+
+type CASCache interface {
+	// CompareAndSwap replaces the value of key with newValue only if it currently equals oldValue.
+	CompareAndSwap(ctx context.Context, key string, oldValue, newValue string, expiration time.Duration) (bool, error)
+}
+
+type IncrCache interface {
+	// Incr adds delta to the integer stored at key and returns the result. A missing key starts at
+	// zero and gets expiration, an existing key keeps its expiry.
+	Incr(ctx context.Context, key string, delta int64, expiration time.Duration) (int64, error)
+}
+
+type BatchCache interface {
+	// MGet returns the values of the keys that exist, missing keys are left out of the map.
+	MGet(ctx context.Context, keys []string) (map[string]string, error)
+	MSet(ctx context.Context, items map[string]string, expiration time.Duration) error
+	MDelete(ctx context.Context, keys []string) error
+}
+
+// TTL returns the remaining lifetime of key, or ErrNotSupported if c cannot report it.
+func TTL(ctx context.Context, c Cache, key string) (time.Duration, error) {
+	if tc, ok := c.(TTLCache); ok {
+		return tc.TTL(ctx, key)
+	}
+	return 0, ErrNotSupported
+}
+
+// SetNX stores value if key does not exist. The fallback for backends without SetNXCache is a
+// Get followed by a Set and is not atomic.
+func SetNX(ctx context.Context, c Cache, key string, value string, expiration time.Duration) (bool, error) {
+	if nc, ok := c.(SetNXCache); ok {
+		if ok, err := nc.SetNX(ctx, key, value, expiration); !errors.Is(err, ErrNotSupported) {
+			return ok, err
+		}
+	}
+
+	_, err := c.Get(ctx, key)
+	if err == nil {
+		return false, nil
+	}
+	if !errors.Is(err, ErrNotFound) {
+		return false, err
+	}
+	return true, c.Set(ctx, key, value, expiration)
+}
+
+// CompareAndSwap replaces oldValue with newValue. The fallback for backends without CASCache is not atomic.
+func CompareAndSwap(ctx context.Context, c Cache, key string, oldValue, newValue string, expiration time.Duration) (bool, error) {
+	if cc, ok := c.(CASCache); ok {
+		if ok, err := cc.CompareAndSwap(ctx, key, oldValue, newValue, expiration); !errors.Is(err, ErrNotSupported) {
+			return ok, err
+		}
+	}
+
+	current, err := c.Get(ctx, key)
+	if errors.Is(err, ErrNotFound) {
+		return false, nil
+	}
+	if err != nil || current != oldValue {
+		return false, err
+	}
+	return true, c.Set(ctx, key, newValue, expiration)
+}
+
+// Incr adds delta to the integer at key. The fallback for backends without IncrCache is not atomic
+// and, unless the backend implements TTLCache, resets the expiry on every call.
+func Incr(ctx context.Context, c Cache, key string, delta int64, expiration time.Duration) (int64, error) {
+	if ic, ok := c.(IncrCache); ok {
+		if n, err := ic.Incr(ctx, key, delta, expiration); !errors.Is(err, ErrNotSupported) {
+			return n, err
+		}
+	}
+
+	current, err := c.Get(ctx, key)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return 0, err
+	}
+	n, err := addToInteger(current, err == nil, delta)
+	if err != nil {
+		return 0, err
+	}
+	if ttl, ttlErr := TTL(ctx, c, key); ttlErr == nil {
+		expiration = ttl
+	}
+	return n, c.Set(ctx, key, strconv.FormatInt(n, 10), expiration)
+}
+
+// MGet returns the values of the keys that exist.
+func MGet(ctx context.Context, c Cache, keys []string) (map[string]string, error) {
+	if bc, ok := c.(BatchCache); ok {
+		if values, err := bc.MGet(ctx, keys); !errors.Is(err, ErrNotSupported) {
+			return values, err
+		}
+	}
+
+	values := make(map[string]string, len(keys))
+	for _, key := range keys {
+		value, err := c.Get(ctx, key)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		values[key] = value
+	}
+	return values, nil
+}
+
+func MSet(ctx context.Context, c Cache, items map[string]string, expiration time.Duration) error {
+	if bc, ok := c.(BatchCache); ok {
+		if err := bc.MSet(ctx, items, expiration); !errors.Is(err, ErrNotSupported) {
+			return err
+		}
+	}
+
+	for key, value := range items {
+		if err := c.Set(ctx, key, value, expiration); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func MDelete(ctx context.Context, c Cache, keys []string) error {
+	if bc, ok := c.(BatchCache); ok {
+		if err := bc.MDelete(ctx, keys); !errors.Is(err, ErrNotSupported) {
+			return err
+		}
+	}
+
+	for _, key := range keys {
+		if err := c.Delete(ctx, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func addToInteger(current string, exists bool, delta int64) (int64, error) {
+	if !exists {
+		return delta, nil
+	}
+	n, err := strconv.ParseInt(current, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("cache: value is not an integer: %w", err)
+	}
+	return n + delta, nil
+}
+
+// remainingTTL converts an absolute expiry, zero meaning none, to the value reported by TTL, which
+// is negative (NoExpiration) for entries that never expire.
+func remainingTTL(expiresAt, now time.Time) time.Duration {
+	if expiresAt.IsZero() {
+		return NoExpiration
+	}
+	return expiresAt.Sub(now)
+}
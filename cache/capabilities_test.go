@@ -0,0 +1,120 @@
+package cache
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// plainCache hides every optional capability of the wrapped cache.
+type plainCache struct {
+	Cache
+}
+
+func capabilityBackends(t *testing.T) map[string]Cache {
+	fc, err := NewFileCache(filepath.Join(t.TempDir(), "cache.json"))
+	require.NoError(t, err)
+	t.Cleanup(func() { fc.Close() })
+
+	return map[string]Cache{
+		"memcache": NewMemcache(0, time.Minute),
+		"bounded":  NewBoundedCache(100),
+		"file":     fc,
+		"fallback": plainCache{NewMemcache(0, time.Minute)},
+	}
+}
+
+func TestCapabilities(t *testing.T) {
+	ctx := context.Background()
+	for name, c := range capabilityBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			ok, err := SetNX(ctx, c, "nx", "first", time.Hour)
+			require.NoError(t, err)
+			assert.True(t, ok)
+			ok, err = SetNX(ctx, c, "nx", "second", time.Hour)
+			require.NoError(t, err)
+			assert.False(t, ok)
+			val, err := c.Get(ctx, "nx")
+			require.NoError(t, err)
+			assert.Equal(t, "first", val)
+
+			ok, err = CompareAndSwap(ctx, c, "nx", "other", "third", time.Hour)
+			require.NoError(t, err)
+			assert.False(t, ok)
+			ok, err = CompareAndSwap(ctx, c, "nx", "first", "third", time.Hour)
+			require.NoError(t, err)
+			assert.True(t, ok)
+			ok, err = CompareAndSwap(ctx, c, "missing", "", "x", time.Hour)
+			require.NoError(t, err)
+			assert.False(t, ok)
+
+			n, err := Incr(ctx, c, "counter", 2, time.Hour)
+			require.NoError(t, err)
+			assert.Equal(t, int64(2), n)
+			n, err = Incr(ctx, c, "counter", -5, time.Minute)
+			require.NoError(t, err)
+			assert.Equal(t, int64(-3), n)
+			_, err = Incr(ctx, c, "nx", 1, time.Hour)
+			assert.Error(t, err)
+
+			require.NoError(t, MSet(ctx, c, map[string]string{"a": "1", "b": "2"}, time.Hour))
+			values, err := MGet(ctx, c, []string{"a", "b", "missing"})
+			require.NoError(t, err)
+			assert.Equal(t, map[string]string{"a": "1", "b": "2"}, values)
+			require.NoError(t, MDelete(ctx, c, []string{"a", "b"}))
+			values, err = MGet(ctx, c, []string{"a", "b"})
+			require.NoError(t, err)
+			assert.Empty(t, values)
+
+			ttl, err := TTL(ctx, c, "counter")
+			if name == "fallback" {
+				assert.ErrorIs(t, err, ErrNotSupported)
+				return
+			}
+			require.NoError(t, err)
+			// Incr kept the expiry of the first call.
+			assert.Greater(t, ttl, 59*time.Minute)
+			assert.LessOrEqual(t, ttl, time.Hour)
+
+			require.NoError(t, c.Set(ctx, "forever", "v", NoExpiration))
+			ttl, err = TTL(ctx, c, "forever")
+			require.NoError(t, err)
+			assert.Equal(t, NoExpiration, ttl)
+
+			_, err = TTL(ctx, c, "missing")
+			assert.ErrorIs(t, err, ErrNotFound)
+		})
+	}
+}
+
+func TestCapabilities_AtomicIncr(t *testing.T) {
+	ctx := context.Background()
+	for name, c := range capabilityBackends(t) {
+		if name == "fallback" {
+			continue
+		}
+		t.Run(name, func(t *testing.T) {
+			var wg sync.WaitGroup
+			for i := 0; i < 8; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for j := 0; j < 25; j++ {
+						_, err := Incr(ctx, c, "hits", 1, time.Minute)
+						assert.NoError(t, err)
+					}
+				}()
+			}
+			wg.Wait()
+
+			val, err := c.Get(ctx, "hits")
+			require.NoError(t, err)
+			assert.Equal(t, "200", val)
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+)
+
+// Codec converts values to and from the bytes stored in a Cache.
+type Codec interface {
+	// Name identifies the encoding, it is stored with every entry written by Typed and must not contain ':'.
+	Name() string
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+}
+
+var (
+	JSONCodec Codec = jsonCodec{}
+	GobCodec  Codec = gobCodec{}
+	// RawCodec stores []byte and string values as is.
+	RawCodec Codec = rawCodec{}
+)
+
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string                       { return "json" }
+func (jsonCodec) Marshal(v any) ([]byte, error)      { return json.Marshal(v) }
+func (jsonCodec) Unmarshal(data []byte, v any) error { return json.Unmarshal(data, v) }
+
+type gobCodec struct{}
+
+func (gobCodec) Name() string { return "gob" }
+
+func (gobCodec) Marshal(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gobCodec) Unmarshal(data []byte, v any) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+type rawCodec struct{}
+
+func (rawCodec) Name() string { return "raw" }
+
+func (rawCodec) Marshal(v any) ([]byte, error) {
+	switch val := v.(type) {
+	case []byte:
+		return val, nil
+	case string:
+		return []byte(val), nil
+	default:
+		return nil, fmt.Errorf("cache: raw codec cannot marshal %T", v)
+	}
+}
+
+func (rawCodec) Unmarshal(data []byte, v any) error {
+	switch ptr := v.(type) {
+	case *[]byte:
+		*ptr = append([]byte(nil), data...)
+	case *string:
+		*ptr = string(data)
+	default:
+		return fmt.Errorf("cache: raw codec cannot unmarshal into %T", v)
+	}
+	return nil
+}
+
+type versionedCodec struct {
+	Codec
+	name string
+}
+
+// VersionedCodec tags codec with a schema version. Bumping the version when the cached type changes
+// makes entries written by older deployments read as misses instead of decoding into the wrong shape.
+func VersionedCodec(codec Codec, version string) Codec {
+	return versionedCodec{Codec: codec, name: codec.Name() + "@" + version}
+}
+
+func (c versionedCodec) Name() string {
+	return c.name
+}
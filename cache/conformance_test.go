@@ -0,0 +1,74 @@
+package cache_test
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Lumiaqian/go-sdk-core/cache"
+	"github.com/Lumiaqian/go-sdk-core/cache/cachetest"
+	"github.com/Lumiaqian/go-sdk-core/metrics"
+)
+
+func TestMemcache_Conformance(t *testing.T) {
+	cachetest.Run(t, func(t *testing.T) cache.Cache {
+		return cache.NewMemcache(5*time.Minute, 10*time.Minute)
+	})
+}
+
+func TestBoundedCache_Conformance(t *testing.T) {
+	for name, policy := range map[string]cache.EvictionPolicy{"LRU": cache.PolicyLRU, "LFU": cache.PolicyLFU, "TinyLFU": cache.PolicyTinyLFU} {
+		t.Run(name, func(t *testing.T) {
+			cachetest.Run(t, func(t *testing.T) cache.Cache {
+				return cache.NewBoundedCache(10000, cache.WithEvictionPolicy(policy))
+			})
+		})
+	}
+}
+
+func TestFileCache_Conformance(t *testing.T) {
+	for name, layout := range map[string]cache.FileLayout{"SingleFile": cache.LayoutSingleFile, "Directory": cache.LayoutDirectory} {
+		t.Run(name, func(t *testing.T) {
+			cachetest.Run(t, func(t *testing.T) cache.Cache {
+				fc, err := cache.NewFileCache(filepath.Join(t.TempDir(), "cache"), cache.WithFileLayout(layout))
+				if err != nil {
+					t.Fatal(err)
+				}
+				t.Cleanup(func() { fc.Close() })
+				return fc
+			})
+		})
+	}
+}
+
+func TestDecorators_Conformance(t *testing.T) {
+	backend := func() cache.Cache { return cache.NewMemcache(0, time.Minute) }
+
+	t.Run("Encrypted", func(t *testing.T) {
+		cachetest.Run(t, func(t *testing.T) cache.Cache {
+			ec, err := cache.NewEncryptedCache(backend(), "k1", map[string][]byte{"k1": bytes.Repeat([]byte{7}, 32)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			return ec
+		})
+	})
+	t.Run("Tiered", func(t *testing.T) {
+		cachetest.Run(t, func(t *testing.T) cache.Cache {
+			tc := cache.NewTieredCache(backend(), backend(), cache.WithMaxLocalTTL(time.Second))
+			t.Cleanup(tc.Close)
+			return tc
+		})
+	})
+	t.Run("Namespaced", func(t *testing.T) {
+		cachetest.Run(t, func(t *testing.T) cache.Cache {
+			return cache.NewNamespaced(backend(), "sdk", "tenant")
+		})
+	})
+	t.Run("Instrumented", func(t *testing.T) {
+		cachetest.Run(t, func(t *testing.T) cache.Cache {
+			return cache.NewInstrumented(backend(), metrics.NewRegistry())
+		})
+	})
+}
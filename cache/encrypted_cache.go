@@ -0,0 +1,108 @@
+package cache
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const encryptedValuePrefix = "enc1:"
+
+var ErrDecrypt = errors.New("cache: value cannot be decrypted")
+
+// EncryptedCache encrypts values with AES-GCM before handing them to the wrapped cache.
+// Each value embeds the ID of the key it was written with, so values written with older
+// keys stay readable after the current key is rotated. The cache key is authenticated as
+// additional data, a ciphertext copied to another key fails to decrypt.
+type EncryptedCache struct {
+	cache     Cache
+	currentID string
+	aeads     map[string]cipher.AEAD
+}
+
+// NewEncryptedCache wraps cache using keys, a map of key ID to 16, 24 or 32 byte AES key.
+// New values are written with currentKeyID, the other keys are only used for decryption.
+func NewEncryptedCache(cache Cache, currentKeyID string, keys map[string][]byte) (*EncryptedCache, error) {
+	if _, ok := keys[currentKeyID]; !ok {
+		return nil, fmt.Errorf("cache: current key id %q has no key", currentKeyID)
+	}
+
+	aeads := make(map[string]cipher.AEAD, len(keys))
+	for id, key := range keys {
+		if id == "" || strings.Contains(id, ":") {
+			return nil, fmt.Errorf("cache: invalid key id %q", id)
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, fmt.Errorf("cache: key %q: %w", id, err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		aeads[id] = aead
+	}
+
+	return &EncryptedCache{
+		cache:     cache,
+		currentID: currentKeyID,
+		aeads:     aeads,
+	}, nil
+}
+
+func (c *EncryptedCache) Set(ctx context.Context, key string, value string, expiration time.Duration) error {
+	aead := c.aeads[c.currentID]
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(value)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(value), additionalData(c.currentID, key))
+
+	encoded := encryptedValuePrefix + c.currentID + ":" + base64.RawStdEncoding.EncodeToString(sealed)
+	return c.cache.Set(ctx, key, encoded, expiration)
+}
+
+func (c *EncryptedCache) Get(ctx context.Context, key string) (string, error) {
+	encoded, err := c.cache.Get(ctx, key)
+	if err != nil {
+		return "", err
+	}
+
+	rest, ok := strings.CutPrefix(encoded, encryptedValuePrefix)
+	if !ok {
+		return "", ErrDecrypt
+	}
+	id, payload, ok := strings.Cut(rest, ":")
+	if !ok {
+		return "", ErrDecrypt
+	}
+	aead, ok := c.aeads[id]
+	if !ok {
+		return "", fmt.Errorf("%w: unknown key id %q", ErrDecrypt, id)
+	}
+	sealed, err := base64.RawStdEncoding.DecodeString(payload)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return "", ErrDecrypt
+	}
+
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, additionalData(id, key))
+	if err != nil {
+		return "", ErrDecrypt
+	}
+	return string(plaintext), nil
+}
+
+func (c *EncryptedCache) Delete(ctx context.Context, key string) error {
+	return c.cache.Delete(ctx, key)
+}
+
+func additionalData(keyID, cacheKey string) []byte {
+	return []byte(keyID + "\x00" + cacheKey)
+}
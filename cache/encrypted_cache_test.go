@@ -0,0 +1,89 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncryptedCache_Set_Get(t *testing.T) {
+	backend := NewMemcache(5*time.Minute, 10*time.Minute)
+	ec, err := NewEncryptedCache(backend, "k1", map[string][]byte{"k1": bytes.Repeat([]byte{1}, 32)})
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	require.NoError(t, ec.Set(ctx, "token", "secret-token", time.Minute))
+
+	raw, err := backend.Get(ctx, "token")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(raw, "enc1:k1:"))
+	assert.NotContains(t, raw, "secret-token")
+
+	val, err := ec.Get(ctx, "token")
+	require.NoError(t, err)
+	assert.Equal(t, "secret-token", val)
+
+	require.NoError(t, ec.Delete(ctx, "token"))
+	_, err = ec.Get(ctx, "token")
+	assert.Error(t, err)
+}
+
+func TestEncryptedCache_KeyRotation(t *testing.T) {
+	backend := NewMemcache(5*time.Minute, 10*time.Minute)
+	oldKey, newKey := bytes.Repeat([]byte{1}, 32), bytes.Repeat([]byte{2}, 16)
+	ctx := context.Background()
+
+	before, err := NewEncryptedCache(backend, "k1", map[string][]byte{"k1": oldKey})
+	require.NoError(t, err)
+	require.NoError(t, before.Set(ctx, "old", "old-value", time.Minute))
+
+	after, err := NewEncryptedCache(backend, "k2", map[string][]byte{"k1": oldKey, "k2": newKey})
+	require.NoError(t, err)
+	val, err := after.Get(ctx, "old")
+	require.NoError(t, err)
+	assert.Equal(t, "old-value", val)
+
+	require.NoError(t, after.Set(ctx, "new", "new-value", time.Minute))
+	raw, err := backend.Get(ctx, "new")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(raw, "enc1:k2:"))
+
+	// Instances that do not know the new key cannot read it.
+	_, err = before.Get(ctx, "new")
+	assert.ErrorIs(t, err, ErrDecrypt)
+}
+
+func TestEncryptedCache_BindsCiphertextToKey(t *testing.T) {
+	backend := NewMemcache(5*time.Minute, 10*time.Minute)
+	ec, err := NewEncryptedCache(backend, "k1", map[string][]byte{"k1": bytes.Repeat([]byte{1}, 32)})
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	require.NoError(t, ec.Set(ctx, "tenant-a", "token-a", time.Minute))
+	raw, err := backend.Get(ctx, "tenant-a")
+	require.NoError(t, err)
+
+	require.NoError(t, backend.Set(ctx, "tenant-b", raw, time.Minute))
+	_, err = ec.Get(ctx, "tenant-b")
+	assert.ErrorIs(t, err, ErrDecrypt)
+
+	require.NoError(t, backend.Set(ctx, "plain", "not encrypted", time.Minute))
+	_, err = ec.Get(ctx, "plain")
+	assert.ErrorIs(t, err, ErrDecrypt)
+}
+
+func TestNewEncryptedCache_Validation(t *testing.T) {
+	backend := NewMemcache(5*time.Minute, 10*time.Minute)
+
+	_, err := NewEncryptedCache(backend, "missing", map[string][]byte{"k1": bytes.Repeat([]byte{1}, 32)})
+	assert.Error(t, err)
+	_, err = NewEncryptedCache(backend, "k1", map[string][]byte{"k1": []byte("short")})
+	assert.Error(t, err)
+	_, err = NewEncryptedCache(backend, "a:b", map[string][]byte{"a:b": bytes.Repeat([]byte{1}, 32)})
+	assert.Error(t, err)
+}
@@ -0,0 +1,244 @@
+package cache
+
+import (
+	"container/list"
+	"hash/maphash"
+)
+
+type lruPolicy struct {
+	entries *list.List
+}
+
+func newLRUPolicy() *lruPolicy {
+	return &lruPolicy{entries: list.New()}
+}
+
+func (p *lruPolicy) record(key string) {}
+
+func (p *lruPolicy) add(e *boundedEntry) {
+	e.element = p.entries.PushFront(e)
+}
+
+func (p *lruPolicy) access(e *boundedEntry) {
+	p.entries.MoveToFront(e.element)
+}
+
+func (p *lruPolicy) remove(e *boundedEntry) {
+	p.entries.Remove(e.element)
+}
+
+func (p *lruPolicy) victim() *boundedEntry {
+	return back(p.entries)
+}
+
+func (p *lruPolicy) settle() {}
+
+// lfuPolicy keeps one LRU list per access count. A new entry is only ranked in settle, otherwise
+// its count of one would make it the victim of its own insert.
+type lfuPolicy struct {
+	buckets map[int]*list.List
+	minFreq int
+	pending *boundedEntry
+}
+
+func newLFUPolicy() *lfuPolicy {
+	return &lfuPolicy{buckets: make(map[int]*list.List)}
+}
+
+func (p *lfuPolicy) record(key string) {}
+
+func (p *lfuPolicy) add(e *boundedEntry) {
+	e.freq = 1
+	p.pending = e
+}
+
+func (p *lfuPolicy) access(e *boundedEntry) {
+	p.remove(e)
+	e.freq++
+	p.push(e)
+}
+
+func (p *lfuPolicy) remove(e *boundedEntry) {
+	bucket := p.buckets[e.freq]
+	bucket.Remove(e.element)
+	if bucket.Len() == 0 {
+		delete(p.buckets, e.freq)
+	}
+}
+
+func (p *lfuPolicy) victim() *boundedEntry {
+	if _, ok := p.buckets[p.minFreq]; !ok {
+		// The minimum moved up after an access or removal, find the new one.
+		p.minFreq = 0
+		for freq := range p.buckets {
+			if p.minFreq == 0 || freq < p.minFreq {
+				p.minFreq = freq
+			}
+		}
+		if p.minFreq == 0 {
+			return nil
+		}
+	}
+	return back(p.buckets[p.minFreq])
+}
+
+func (p *lfuPolicy) settle() {
+	if p.pending != nil {
+		p.push(p.pending)
+		p.minFreq = 1
+		p.pending = nil
+	}
+}
+
+func (p *lfuPolicy) push(e *boundedEntry) {
+	bucket, ok := p.buckets[e.freq]
+	if !ok {
+		bucket = list.New()
+		p.buckets[e.freq] = bucket
+	}
+	e.element = bucket.PushFront(e)
+}
+
+// tinyLFUPolicy admits entries leaving the window into the main space only if the sketch
+// estimates them as more frequent than the main space's LRU victim.
+type tinyLFUPolicy struct {
+	window *list.List
+	main   *list.List
+	sketch *frequencySketch
+}
+
+func newTinyLFUPolicy(maxEntries int64) *tinyLFUPolicy {
+	return &tinyLFUPolicy{
+		window: list.New(),
+		main:   list.New(),
+		sketch: newFrequencySketch(maxEntries),
+	}
+}
+
+func (p *tinyLFUPolicy) record(key string) {
+	p.sketch.increment(key)
+}
+
+func (p *tinyLFUPolicy) add(e *boundedEntry) {
+	e.window = true
+	e.element = p.window.PushFront(e)
+}
+
+func (p *tinyLFUPolicy) access(e *boundedEntry) {
+	if e.window {
+		p.window.MoveToFront(e.element)
+	} else {
+		p.main.MoveToFront(e.element)
+	}
+}
+
+func (p *tinyLFUPolicy) remove(e *boundedEntry) {
+	if e.window {
+		p.window.Remove(e.element)
+	} else {
+		p.main.Remove(e.element)
+	}
+}
+
+func (p *tinyLFUPolicy) victim() *boundedEntry {
+	if p.window.Len() > p.windowCap() || p.main.Len() == 0 {
+		candidate := back(p.window)
+		if candidate == nil {
+			return back(p.main)
+		}
+		victim := back(p.main)
+		if victim == nil {
+			return candidate
+		}
+		if p.sketch.estimate(candidate.key) > p.sketch.estimate(victim.key) {
+			p.promote(candidate)
+			return victim
+		}
+		return candidate
+	}
+	return back(p.main)
+}
+
+func (p *tinyLFUPolicy) settle() {
+	for p.window.Len() > p.windowCap() {
+		p.promote(back(p.window))
+	}
+}
+
+// windowCap keeps the window at 1% of the entries, as in the W-TinyLFU paper.
+func (p *tinyLFUPolicy) windowCap() int {
+	return max(1, (p.window.Len()+p.main.Len())/100)
+}
+
+func (p *tinyLFUPolicy) promote(e *boundedEntry) {
+	p.window.Remove(e.element)
+	e.window = false
+	e.element = p.main.PushFront(e)
+}
+
+// frequencySketch is a count-min sketch with 4 bit saturating counters that are halved
+// periodically so that old popularity fades.
+type frequencySketch struct {
+	seed      maphash.Seed
+	rows      [4][]uint8
+	mask      uint64
+	additions int
+	resetAt   int
+}
+
+func newFrequencySketch(maxEntries int64) *frequencySketch {
+	width := uint64(64)
+	for int64(width) < maxEntries*2 {
+		width *= 2
+	}
+	s := &frequencySketch{
+		seed:    maphash.MakeSeed(),
+		mask:    width - 1,
+		resetAt: int(width) * 10,
+	}
+	for i := range s.rows {
+		s.rows[i] = make([]uint8, width)
+	}
+	return s
+}
+
+func (s *frequencySketch) increment(key string) {
+	h1, h2 := s.hashes(key)
+	for i := range s.rows {
+		idx := (h1 + uint64(i)*h2) & s.mask
+		if s.rows[i][idx] < 15 {
+			s.rows[i][idx]++
+		}
+	}
+
+	s.additions++
+	if s.additions >= s.resetAt {
+		for i := range s.rows {
+			for j := range s.rows[i] {
+				s.rows[i][j] /= 2
+			}
+		}
+		s.additions /= 2
+	}
+}
+
+func (s *frequencySketch) estimate(key string) uint8 {
+	h1, h2 := s.hashes(key)
+	est := uint8(15)
+	for i := range s.rows {
+		est = min(est, s.rows[i][(h1+uint64(i)*h2)&s.mask])
+	}
+	return est
+}
+
+func (s *frequencySketch) hashes(key string) (uint64, uint64) {
+	h := maphash.String(s.seed, key)
+	return h, h>>32 | 1
+}
+
+func back(l *list.List) *boundedEntry {
+	if el := l.Back(); el != nil {
+		return el.Value.(*boundedEntry)
+	}
+	return nil
+}
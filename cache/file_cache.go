@@ -0,0 +1,450 @@
+package cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type FileLayout int
+
+const (
+	// LayoutSingleFile keeps all entries in one JSON file, suited to a handful of tokens.
+	LayoutSingleFile FileLayout = iota
+	// LayoutDirectory stores every key in its own file below a directory.
+	LayoutDirectory
+)
+
+const (
+	fileLockPollInterval = 5 * time.Millisecond
+	fileEntrySuffix      = ".json"
+	fileTempPattern      = ".tmp-*"
+)
+
+// FileCache persists entries and their expiry on disk so they survive process restarts.
+// Writes are atomic through rename and serialized across processes by a lock file, a corrupted
+// file reads as empty and is moved aside to <name>.corrupt on the next write.
+type FileCache struct {
+	path     string
+	layout   FileLayout
+	fileMode os.FileMode
+	now      func() time.Time
+
+	mutex    sync.RWMutex
+	lockPath string
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+type fileEntry struct {
+	Key string `json:"key,omitempty"`
+	// Value is stored as bytes so that binary values survive the JSON encoding.
+	Value     []byte `json:"value"`
+	ExpiresAt int64  `json:"expires_at,omitempty"`
+}
+
+type fileSnapshot struct {
+	Version int                   `json:"version"`
+	Entries map[string]*fileEntry `json:"entries"`
+}
+
+type fileCacheConfig struct {
+	layout             FileLayout
+	compactionInterval time.Duration
+	fileMode           os.FileMode
+}
+
+type FileOption func(*fileCacheConfig)
+
+func WithFileLayout(layout FileLayout) FileOption {
+	return func(c *fileCacheConfig) {
+		c.layout = layout
+	}
+}
+
+// WithCompactionInterval removes expired entries in the background every interval until Close.
+func WithCompactionInterval(interval time.Duration) FileOption {
+	return func(c *fileCacheConfig) {
+		c.compactionInterval = interval
+	}
+}
+
+// WithFileMode sets the permissions of the files written, 0600 by default since they usually hold secrets.
+func WithFileMode(mode os.FileMode) FileOption {
+	return func(c *fileCacheConfig) {
+		c.fileMode = mode
+	}
+}
+
+// NewFileCache opens a cache at path, a file for LayoutSingleFile and a directory for LayoutDirectory.
+// Missing parent directories are created.
+func NewFileCache(path string, opts ...FileOption) (*FileCache, error) {
+	config := fileCacheConfig{fileMode: 0o600}
+	for _, opt := range opts {
+		opt(&config)
+	}
+
+	dir := filepath.Dir(path)
+	lockPath := path + ".lock"
+	if config.layout == LayoutDirectory {
+		dir = path
+		lockPath = filepath.Join(path, ".lock")
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	lockFile, err := os.OpenFile(lockPath, os.O_CREATE|os.O_RDWR, config.fileMode)
+	if err != nil {
+		return nil, err
+	}
+	if err := lockFile.Close(); err != nil {
+		return nil, err
+	}
+
+	c := &FileCache{
+		path:     path,
+		layout:   config.layout,
+		fileMode: config.fileMode,
+		now:      time.Now,
+		lockPath: lockPath,
+	}
+	if config.compactionInterval > 0 {
+		c.stop = make(chan struct{})
+		c.done = make(chan struct{})
+		go c.compactLoop(config.compactionInterval)
+	}
+	return c, nil
+}
+
+func (c *FileCache) Get(ctx context.Context, key string) (string, error) {
+	var entry *fileEntry
+	err := c.withLock(ctx, false, func() error {
+		var err error
+		entry, err = c.read(key)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	if entry == nil || c.expired(entry) {
+		return "", ErrNotFound
+	}
+	return string(entry.Value), nil
+}
+
+func (c *FileCache) Set(ctx context.Context, key string, value string, expiration time.Duration) error {
+	entry := c.newEntry(key, value, expiration)
+	return c.withLock(ctx, true, func() error {
+		return c.write(key, entry)
+	})
+}
+
+func (c *FileCache) Delete(ctx context.Context, key string) error {
+	return c.withLock(ctx, true, func() error {
+		if c.layout == LayoutDirectory {
+			err := os.Remove(c.entryPath(key))
+			if errors.Is(err, os.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		snapshot := c.readSnapshot(true)
+		if _, ok := snapshot.Entries[key]; !ok {
+			return nil
+		}
+		delete(snapshot.Entries, key)
+		return c.writeJSON(c.path, snapshot)
+	})
+}
+
+func (c *FileCache) TTL(ctx context.Context, key string) (time.Duration, error) {
+	var entry *fileEntry
+	err := c.withLock(ctx, false, func() error {
+		var err error
+		entry, err = c.read(key)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	if entry == nil || c.expired(entry) {
+		return 0, ErrNotFound
+	}
+	if entry.ExpiresAt == 0 {
+		return NoExpiration, nil
+	}
+	return time.Unix(0, entry.ExpiresAt).Sub(c.now()), nil
+}
+
+func (c *FileCache) SetNX(ctx context.Context, key string, value string, expiration time.Duration) (bool, error) {
+	stored := false
+	err := c.update(ctx, key, func(current *fileEntry) *fileEntry {
+		if current != nil {
+			return nil
+		}
+		stored = true
+		return c.newEntry(key, value, expiration)
+	})
+	return stored && err == nil, err
+}
+
+func (c *FileCache) CompareAndSwap(ctx context.Context, key string, oldValue, newValue string, expiration time.Duration) (bool, error) {
+	swapped := false
+	err := c.update(ctx, key, func(current *fileEntry) *fileEntry {
+		if current == nil || string(current.Value) != oldValue {
+			return nil
+		}
+		swapped = true
+		return c.newEntry(key, newValue, expiration)
+	})
+	return swapped && err == nil, err
+}
+
+func (c *FileCache) Incr(ctx context.Context, key string, delta int64, expiration time.Duration) (int64, error) {
+	var (
+		n      int64
+		incErr error
+	)
+	err := c.update(ctx, key, func(current *fileEntry) *fileEntry {
+		if current == nil {
+			n = delta
+			return c.newEntry(key, strconv.FormatInt(n, 10), expiration)
+		}
+		if n, incErr = addToInteger(string(current.Value), true, delta); incErr != nil {
+			return nil
+		}
+		current.Value = []byte(strconv.FormatInt(n, 10))
+		return current
+	})
+	if err == nil {
+		err = incErr
+	}
+	return n, err
+}
+
+// Compact removes expired and unreadable entries along with temporary files left by crashed writers.
+func (c *FileCache) Compact(ctx context.Context) error {
+	return c.withLock(ctx, true, func() error {
+		if c.layout == LayoutDirectory {
+			return c.compactDirectory()
+		}
+
+		snapshot := c.readSnapshot(true)
+		before := len(snapshot.Entries)
+		for key, entry := range snapshot.Entries {
+			if entry == nil || c.expired(entry) {
+				delete(snapshot.Entries, key)
+			}
+		}
+		if len(snapshot.Entries) == before {
+			return nil
+		}
+		return c.writeJSON(c.path, snapshot)
+	})
+}
+
+// Close stops background compaction.
+func (c *FileCache) Close() error {
+	if c.stop != nil {
+		close(c.stop)
+		<-c.done
+		c.stop = nil
+	}
+	return nil
+}
+
+func (c *FileCache) compactLoop(interval time.Duration) {
+	defer close(c.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-ticker.C:
+			_ = c.Compact(context.Background())
+		}
+	}
+}
+
+func (c *FileCache) compactDirectory() error {
+	entries, err := os.ReadDir(c.path)
+	if err != nil {
+		return err
+	}
+	for _, de := range entries {
+		name := de.Name()
+		full := filepath.Join(c.path, name)
+		switch {
+		case strings.HasPrefix(name, ".tmp-"):
+			if info, err := de.Info(); err == nil && c.now().Sub(info.ModTime()) > time.Minute {
+				_ = os.Remove(full)
+			}
+		case strings.HasSuffix(name, fileEntrySuffix):
+			var entry fileEntry
+			if err := readJSON(full, &entry); err != nil || c.expired(&entry) {
+				_ = os.Remove(full)
+			}
+		}
+	}
+	return nil
+}
+
+// update calls fn with the live entry for key, nil if missing or expired, and writes the entry
+// fn returns unless it is nil, all under the exclusive lock.
+func (c *FileCache) update(ctx context.Context, key string, fn func(current *fileEntry) *fileEntry) error {
+	return c.withLock(ctx, true, func() error {
+		current, err := c.read(key)
+		if err != nil {
+			return err
+		}
+		if current != nil && c.expired(current) {
+			current = nil
+		}
+		if next := fn(current); next != nil {
+			return c.write(key, next)
+		}
+		return nil
+	})
+}
+
+func (c *FileCache) newEntry(key, value string, expiration time.Duration) *fileEntry {
+	entry := &fileEntry{Key: key, Value: []byte(value)}
+	if expiration > 0 {
+		entry.ExpiresAt = c.now().Add(expiration).UnixNano()
+	}
+	return entry
+}
+
+func (c *FileCache) write(key string, entry *fileEntry) error {
+	if c.layout == LayoutDirectory {
+		return c.writeJSON(c.entryPath(key), entry)
+	}
+	snapshot := c.readSnapshot(true)
+	snapshot.Entries[key] = entry
+	return c.writeJSON(c.path, snapshot)
+}
+
+// withLock runs fn holding the in-process mutex and the cross-process file lock, polling for the
+// latter until ctx is done. Every acquisition opens its own descriptor: flock belongs to the open
+// file, so concurrent readers sharing one would drop each other's lock when the first unlocks.
+func (c *FileCache) withLock(ctx context.Context, exclusive bool, fn func() error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if exclusive {
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+	} else {
+		c.mutex.RLock()
+		defer c.mutex.RUnlock()
+	}
+
+	lockFile, err := os.OpenFile(c.lockPath, os.O_CREATE|os.O_RDWR, c.fileMode)
+	if err != nil {
+		return err
+	}
+	defer lockFile.Close()
+
+	for {
+		locked, err := tryLockFile(lockFile, exclusive)
+		if err != nil {
+			return err
+		}
+		if locked {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(fileLockPollInterval):
+		}
+	}
+	defer unlockFile(lockFile)
+
+	return fn()
+}
+
+func (c *FileCache) read(key string) (*fileEntry, error) {
+	if c.layout == LayoutDirectory {
+		var entry fileEntry
+		err := readJSON(c.entryPath(key), &entry)
+		if err != nil || entry.Key != key {
+			// Missing and corrupted files are both misses.
+			return nil, nil
+		}
+		return &entry, nil
+	}
+	return c.readSnapshot(false).Entries[key], nil
+}
+
+// readSnapshot returns the single file contents, or an empty snapshot if the file is missing or corrupted.
+// Before a write a corrupted file is moved aside so that it is not destroyed.
+func (c *FileCache) readSnapshot(forWrite bool) *fileSnapshot {
+	var snapshot fileSnapshot
+	err := readJSON(c.path, &snapshot)
+	if forWrite && err != nil && !errors.Is(err, os.ErrNotExist) {
+		_ = os.Rename(c.path, c.path+".corrupt")
+	}
+	if err != nil || snapshot.Entries == nil {
+		snapshot = fileSnapshot{Entries: make(map[string]*fileEntry)}
+	}
+	snapshot.Version = 1
+	return &snapshot
+}
+
+func (c *FileCache) writeJSON(path string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), fileTempPattern)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), c.fileMode); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (c *FileCache) entryPath(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(c.path, hex.EncodeToString(sum[:])+fileEntrySuffix)
+}
+
+func (c *FileCache) expired(entry *fileEntry) bool {
+	return entry.ExpiresAt != 0 && c.now().UnixNano() > entry.ExpiresAt
+}
+
+func readJSON(path string, v any) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
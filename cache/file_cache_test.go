@@ -0,0 +1,166 @@
+package cache
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func fileCachePath(t *testing.T, layout FileLayout) string {
+	if layout == LayoutDirectory {
+		return filepath.Join(t.TempDir(), "cache.d")
+	}
+	return filepath.Join(t.TempDir(), "cache.json")
+}
+
+func TestFileCache_Set_Get_Delete(t *testing.T) {
+	for _, layout := range []FileLayout{LayoutSingleFile, LayoutDirectory} {
+		t.Run(strconv.Itoa(int(layout)), func(t *testing.T) {
+			path := fileCachePath(t, layout)
+			fc, err := NewFileCache(path, WithFileLayout(layout))
+			require.NoError(t, err)
+			defer fc.Close()
+			ctx := context.Background()
+
+			require.NoError(t, fc.Set(ctx, "token", "value", time.Hour))
+			require.NoError(t, fc.Set(ctx, "binary", "\x00\xff\xfe", time.Hour))
+
+			// A second instance, e.g. the next CLI invocation, sees the entries.
+			other, err := NewFileCache(path, WithFileLayout(layout))
+			require.NoError(t, err)
+			defer other.Close()
+			val, err := other.Get(ctx, "token")
+			require.NoError(t, err)
+			assert.Equal(t, "value", val)
+			val, err = other.Get(ctx, "binary")
+			require.NoError(t, err)
+			assert.Equal(t, "\x00\xff\xfe", val)
+
+			require.NoError(t, fc.Delete(ctx, "token"))
+			require.NoError(t, fc.Delete(ctx, "token"))
+			_, err = other.Get(ctx, "token")
+			assert.ErrorIs(t, err, ErrNotFound)
+
+			canceled, cancel := context.WithCancel(ctx)
+			cancel()
+			_, err = fc.Get(canceled, "binary")
+			assert.ErrorIs(t, err, context.Canceled)
+		})
+	}
+}
+
+func TestFileCache_ExpiryAndCompaction(t *testing.T) {
+	for _, layout := range []FileLayout{LayoutSingleFile, LayoutDirectory} {
+		t.Run(strconv.Itoa(int(layout)), func(t *testing.T) {
+			path := fileCachePath(t, layout)
+			fc, err := NewFileCache(path, WithFileLayout(layout))
+			require.NoError(t, err)
+			defer fc.Close()
+			ctx := context.Background()
+			now := time.Unix(1700000000, 0)
+			fc.now = func() time.Time { return now }
+
+			require.NoError(t, fc.Set(ctx, "short", "v", time.Minute))
+			require.NoError(t, fc.Set(ctx, "forever", "v", 0))
+
+			now = now.Add(2 * time.Minute)
+			_, err = fc.Get(ctx, "short")
+			assert.ErrorIs(t, err, ErrNotFound)
+			_, err = fc.Get(ctx, "forever")
+			assert.NoError(t, err)
+
+			require.NoError(t, fc.Compact(ctx))
+			if layout == LayoutDirectory {
+				_, err := os.Stat(fc.entryPath("short"))
+				assert.ErrorIs(t, err, os.ErrNotExist)
+				_, err = os.Stat(fc.entryPath("forever"))
+				assert.NoError(t, err)
+			} else {
+				snapshot := fc.readSnapshot(false)
+				assert.Len(t, snapshot.Entries, 1)
+				assert.Contains(t, snapshot.Entries, "forever")
+			}
+		})
+	}
+}
+
+func TestFileCache_BackgroundCompaction(t *testing.T) {
+	path := fileCachePath(t, LayoutDirectory)
+	fc, err := NewFileCache(path, WithFileLayout(LayoutDirectory), WithCompactionInterval(10*time.Millisecond))
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	require.NoError(t, fc.Set(ctx, "short", "v", 5*time.Millisecond))
+	assert.Eventually(t, func() bool {
+		_, err := os.Stat(fc.entryPath("short"))
+		return os.IsNotExist(err)
+	}, time.Second, 10*time.Millisecond)
+	require.NoError(t, fc.Close())
+}
+
+func TestFileCache_CorruptedFile(t *testing.T) {
+	path := fileCachePath(t, LayoutSingleFile)
+	require.NoError(t, os.WriteFile(path, []byte("{not json"), 0o600))
+
+	fc, err := NewFileCache(path)
+	require.NoError(t, err)
+	defer fc.Close()
+	ctx := context.Background()
+
+	_, err = fc.Get(ctx, "token")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	require.NoError(t, fc.Set(ctx, "token", "value", time.Hour))
+	val, err := fc.Get(ctx, "token")
+	require.NoError(t, err)
+	assert.Equal(t, "value", val)
+
+	corrupt, err := os.ReadFile(path + ".corrupt")
+	require.NoError(t, err)
+	assert.Equal(t, "{not json", string(corrupt))
+
+	dir := fileCachePath(t, LayoutDirectory)
+	dc, err := NewFileCache(dir, WithFileLayout(LayoutDirectory))
+	require.NoError(t, err)
+	defer dc.Close()
+	require.NoError(t, os.WriteFile(dc.entryPath("token"), []byte("garbage"), 0o600))
+	_, err = dc.Get(ctx, "token")
+	assert.ErrorIs(t, err, ErrNotFound)
+	require.NoError(t, dc.Compact(ctx))
+	_, err = os.Stat(dc.entryPath("token"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestFileCache_ConcurrentInstances(t *testing.T) {
+	path := fileCachePath(t, LayoutSingleFile)
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		fc, err := NewFileCache(path)
+		require.NoError(t, err)
+		defer fc.Close()
+
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				assert.NoError(t, fc.Set(ctx, strconv.Itoa(i)+"-"+strconv.Itoa(j), "v", time.Hour))
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	// No write was lost to a read-modify-write race.
+	fc, err := NewFileCache(path)
+	require.NoError(t, err)
+	defer fc.Close()
+	assert.Len(t, fc.readSnapshot(false).Entries, 80)
+}
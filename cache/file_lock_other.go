@@ -0,0 +1,37 @@
+//go:build !unix
+
+package cache
+
+import (
+	"errors"
+	"os"
+	"time"
+)
+
+// staleLockAge is how old a sentinel may get before it is considered left behind by a crashed process.
+const staleLockAge = 30 * time.Second
+
+// tryLockFile falls back to an exclusive sentinel file next to f on platforms without flock.
+// Shared locks are exclusive as well.
+//
+// A sentinel older than staleLockAge is taken to be left behind by a crashed process and removed.
+// There is no heartbeat, so a holder that keeps the lock longer than that loses it to the next
+// process; operations on this fallback must stay well below 30 seconds.
+func tryLockFile(f *os.File, exclusive bool) (bool, error) {
+	sentinel := f.Name() + ".held"
+	s, err := os.OpenFile(sentinel, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err == nil {
+		return true, s.Close()
+	}
+	if !errors.Is(err, os.ErrExist) {
+		return false, err
+	}
+	if info, statErr := os.Stat(sentinel); statErr == nil && time.Since(info.ModTime()) > staleLockAge {
+		_ = os.Remove(sentinel)
+	}
+	return false, nil
+}
+
+func unlockFile(f *os.File) error {
+	return os.Remove(f.Name() + ".held")
+}
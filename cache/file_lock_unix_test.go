@@ -0,0 +1,45 @@
+//go:build unix
+
+package cache
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileCache_ReaderKeepsLockWhenAnotherReaderFinishes(t *testing.T) {
+	fc, err := NewFileCache(filepath.Join(t.TempDir(), "cache.json"))
+	require.NoError(t, err)
+	defer fc.Close()
+	ctx := context.Background()
+
+	// Stands in for a writer in another process.
+	other, err := os.OpenFile(fc.lockPath, os.O_RDWR, 0)
+	require.NoError(t, err)
+	defer other.Close()
+
+	secondDone := make(chan struct{})
+	err = fc.withLock(ctx, false, func() error {
+		go func() {
+			defer close(secondDone)
+			assert.NoError(t, fc.withLock(ctx, false, func() error { return nil }))
+		}()
+		<-secondDone
+
+		locked, err := tryLockFile(other, true)
+		require.NoError(t, err)
+		assert.False(t, locked, "the first reader lost its lock when the second one unlocked")
+		return nil
+	})
+	require.NoError(t, err)
+
+	locked, err := tryLockFile(other, true)
+	require.NoError(t, err)
+	assert.True(t, locked)
+	require.NoError(t, unlockFile(other))
+}
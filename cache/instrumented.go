@@ -0,0 +1,253 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/Lumiaqian/go-sdk-core/log"
+	"github.com/Lumiaqian/go-sdk-core/metrics"
+)
+
+const (
+	MetricCacheOperationsTotal   = "sdk_cache_operations_total"
+	MetricCacheOperationDuration = "sdk_cache_operation_duration_seconds"
+)
+
+// Instrumented records the outcome and latency of every operation on the wrapped cache, labelled
+// by operation and key prefix, and optionally logs slow operations.
+//
+// Its capability methods return ErrNotSupported when the wrapped cache lacks the capability, so a
+// non-atomic fallback never passes for an atomic operation. The helpers then fall back through Get
+// and Set, which are recorded as such; unsupported operations are not recorded.
+type Instrumented struct {
+	cache         Cache
+	recorder      metrics.Recorder
+	name          string
+	keyPrefix     func(key string) string
+	logger        log.Logger
+	slowThreshold time.Duration
+}
+
+type InstrumentedOption func(*Instrumented)
+
+// WithCacheName sets the cache label, useful when several caches report to one recorder.
+func WithCacheName(name string) InstrumentedOption {
+	return func(c *Instrumented) {
+		c.name = name
+	}
+}
+
+// WithKeyPrefixFunc derives the prefix label from a key. Keep its output low cardinality,
+// the default takes everything before the first ':' and is empty for keys without one.
+func WithKeyPrefixFunc(fn func(key string) string) InstrumentedOption {
+	return func(c *Instrumented) {
+		c.keyPrefix = fn
+	}
+}
+
+// WithSlowLog logs operations that take at least threshold.
+func WithSlowLog(logger log.Logger, threshold time.Duration) InstrumentedOption {
+	return func(c *Instrumented) {
+		c.logger = logger
+		c.slowThreshold = threshold
+	}
+}
+
+func NewInstrumented(cache Cache, recorder metrics.Recorder, opts ...InstrumentedOption) *Instrumented {
+	if registry, ok := recorder.(*metrics.Registry); ok {
+		registry.SetHelp(MetricCacheOperationsTotal, "Cache operations by result: hit, miss, ok or error.")
+		registry.SetHelp(MetricCacheOperationDuration, "Latency of cache operations.")
+	}
+
+	c := &Instrumented{
+		cache:     cache,
+		recorder:  recorder,
+		name:      "default",
+		keyPrefix: firstSegment,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+func (c *Instrumented) Get(ctx context.Context, key string) (string, error) {
+	start := time.Now()
+	value, err := c.cache.Get(ctx, key)
+	c.observe(ctx, "get", key, start, lookupResult(err == nil, err))
+	return value, err
+}
+
+func (c *Instrumented) Set(ctx context.Context, key string, value string, expiration time.Duration) error {
+	start := time.Now()
+	err := c.cache.Set(ctx, key, value, expiration)
+	c.observe(ctx, "set", key, start, writeResult(err))
+	return err
+}
+
+func (c *Instrumented) Delete(ctx context.Context, key string) error {
+	start := time.Now()
+	err := c.cache.Delete(ctx, key)
+	c.observe(ctx, "delete", key, start, writeResult(err))
+	return err
+}
+
+func (c *Instrumented) TTL(ctx context.Context, key string) (time.Duration, error) {
+	start := time.Now()
+	ttl, err := TTL(ctx, c.cache, key)
+	c.observe(ctx, "ttl", key, start, lookupResult(err == nil, err))
+	return ttl, err
+}
+
+func (c *Instrumented) SetNX(ctx context.Context, key string, value string, expiration time.Duration) (bool, error) {
+	nc, ok := c.cache.(SetNXCache)
+	if !ok {
+		return false, ErrNotSupported
+	}
+	start := time.Now()
+	ok, err := nc.SetNX(ctx, key, value, expiration)
+	c.observe(ctx, "setnx", key, start, writeResult(err))
+	return ok, err
+}
+
+func (c *Instrumented) CompareAndSwap(ctx context.Context, key string, oldValue, newValue string, expiration time.Duration) (bool, error) {
+	cc, ok := c.cache.(CASCache)
+	if !ok {
+		return false, ErrNotSupported
+	}
+	start := time.Now()
+	ok, err := cc.CompareAndSwap(ctx, key, oldValue, newValue, expiration)
+	c.observe(ctx, "cas", key, start, writeResult(err))
+	return ok, err
+}
+
+func (c *Instrumented) Incr(ctx context.Context, key string, delta int64, expiration time.Duration) (int64, error) {
+	ic, ok := c.cache.(IncrCache)
+	if !ok {
+		return 0, ErrNotSupported
+	}
+	start := time.Now()
+	n, err := ic.Incr(ctx, key, delta, expiration)
+	c.observe(ctx, "incr", key, start, writeResult(err))
+	return n, err
+}
+
+func (c *Instrumented) MGet(ctx context.Context, keys []string) (map[string]string, error) {
+	bc, ok := c.cache.(BatchCache)
+	if !ok {
+		return nil, ErrNotSupported
+	}
+	start := time.Now()
+	values, err := bc.MGet(ctx, keys)
+	if errors.Is(err, ErrNotSupported) {
+		return values, err
+	}
+	for _, key := range keys {
+		_, found := values[key]
+		c.count("mget", key, lookupResult(found, err))
+	}
+	c.timing(ctx, "mget", batchKey(keys), start)
+	return values, err
+}
+
+func (c *Instrumented) MSet(ctx context.Context, items map[string]string, expiration time.Duration) error {
+	bc, ok := c.cache.(BatchCache)
+	if !ok {
+		return ErrNotSupported
+	}
+	start := time.Now()
+	err := bc.MSet(ctx, items, expiration)
+	key := ""
+	for k := range items {
+		key = k
+		break
+	}
+	c.observe(ctx, "mset", key, start, writeResult(err))
+	return err
+}
+
+func (c *Instrumented) MDelete(ctx context.Context, keys []string) error {
+	bc, ok := c.cache.(BatchCache)
+	if !ok {
+		return ErrNotSupported
+	}
+	start := time.Now()
+	err := bc.MDelete(ctx, keys)
+	c.observe(ctx, "mdelete", batchKey(keys), start, writeResult(err))
+	return err
+}
+
+// observe records an operation. An empty result marks an operation the wrapped cache does not
+// support, which is neither counted nor timed.
+func (c *Instrumented) observe(ctx context.Context, op, key string, start time.Time, result string) {
+	if result == "" {
+		return
+	}
+	c.count(op, key, result)
+	c.timing(ctx, op, key, start)
+}
+
+func (c *Instrumented) count(op, key, result string) {
+	c.recorder.IncCounter(MetricCacheOperationsTotal, metrics.Labels{
+		"cache":  c.name,
+		"op":     op,
+		"prefix": c.keyPrefix(key),
+		"result": result,
+	})
+}
+
+func (c *Instrumented) timing(ctx context.Context, op, key string, start time.Time) {
+	elapsed := time.Since(start)
+	prefix := c.keyPrefix(key)
+	c.recorder.ObserveHistogram(MetricCacheOperationDuration, metrics.Labels{
+		"cache":  c.name,
+		"op":     op,
+		"prefix": prefix,
+	}, elapsed.Seconds())
+
+	if c.logger != nil && elapsed >= c.slowThreshold {
+		c.logger.Log(ctx, log.WARN, "msg", "slow cache operation", "cache", c.name, "op", op,
+			"prefix", prefix, "duration", elapsed.String())
+	}
+}
+
+func lookupResult(found bool, err error) string {
+	switch {
+	case found:
+		return "hit"
+	case err == nil || errors.Is(err, ErrNotFound):
+		return "miss"
+	case errors.Is(err, ErrNotSupported):
+		return ""
+	default:
+		return "error"
+	}
+}
+
+func writeResult(err error) string {
+	switch {
+	case err == nil:
+		return "ok"
+	case errors.Is(err, ErrNotSupported):
+		return ""
+	default:
+		return "error"
+	}
+}
+
+func firstSegment(key string) string {
+	prefix, _, found := strings.Cut(key, ":")
+	if !found {
+		return ""
+	}
+	return prefix
+}
+
+func batchKey(keys []string) string {
+	if len(keys) == 0 {
+		return ""
+	}
+	return keys[0]
+}
@@ -0,0 +1,114 @@
+package cache
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Lumiaqian/go-sdk-core/log"
+	"github.com/Lumiaqian/go-sdk-core/metrics"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type slowCache struct {
+	Cache
+	delay time.Duration
+}
+
+func (c slowCache) Get(ctx context.Context, key string) (string, error) {
+	time.Sleep(c.delay)
+	return c.Cache.Get(ctx, key)
+}
+
+type recordingLogger struct {
+	entries [][]any
+}
+
+func (l *recordingLogger) Log(ctx context.Context, level log.Level, keyvals ...any) {
+	l.entries = append(l.entries, keyvals)
+}
+
+func TestInstrumented_Metrics(t *testing.T) {
+	ctx := context.Background()
+	registry := metrics.NewRegistry()
+	ic := NewInstrumented(NewMemcache(0, time.Minute), registry, WithCacheName("tokens"))
+
+	require.NoError(t, ic.Set(ctx, "wechat:token", "v", time.Minute))
+	_, err := ic.Get(ctx, "wechat:token")
+	require.NoError(t, err)
+	_, err = ic.Get(ctx, "wechat:missing")
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, err = ic.Get(ctx, "plainkey")
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, err = MGet(ctx, ic, []string{"wechat:token", "wechat:other"})
+	require.NoError(t, err)
+	_, err = Incr(ctx, ic, "wechat:count", 1, time.Minute)
+	require.NoError(t, err)
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = ic.Get(canceled, "wechat:token")
+	assert.Error(t, err)
+
+	var sb strings.Builder
+	require.NoError(t, registry.WriteText(&sb))
+	out := sb.String()
+	assert.Contains(t, out, `sdk_cache_operations_total{cache="tokens",op="get",prefix="wechat",result="hit"} 1`)
+	assert.Contains(t, out, `sdk_cache_operations_total{cache="tokens",op="get",prefix="wechat",result="miss"} 1`)
+	assert.Contains(t, out, `sdk_cache_operations_total{cache="tokens",op="get",prefix="wechat",result="error"} 1`)
+	assert.Contains(t, out, `sdk_cache_operations_total{cache="tokens",op="get",prefix="",result="miss"} 1`)
+	assert.Contains(t, out, `sdk_cache_operations_total{cache="tokens",op="set",prefix="wechat",result="ok"} 1`)
+	assert.Contains(t, out, `sdk_cache_operations_total{cache="tokens",op="mget",prefix="wechat",result="hit"} 1`)
+	assert.Contains(t, out, `sdk_cache_operations_total{cache="tokens",op="mget",prefix="wechat",result="miss"} 1`)
+	assert.Contains(t, out, `sdk_cache_operations_total{cache="tokens",op="incr",prefix="wechat",result="ok"} 1`)
+	assert.Contains(t, out, `sdk_cache_operation_duration_seconds_count{cache="tokens",op="get",prefix="wechat"} 3`)
+}
+
+func TestInstrumented_OnlyWrappedCapabilities(t *testing.T) {
+	ctx := context.Background()
+	registry := metrics.NewRegistry()
+	// slowCache exposes only Get, Set and Delete.
+	ic := NewInstrumented(slowCache{Cache: NewMemcache(0, time.Minute)}, registry)
+
+	_, err := ic.SetNX(ctx, "app:lock", "1", time.Minute)
+	assert.ErrorIs(t, err, ErrNotSupported)
+	_, err = ic.Incr(ctx, "app:count", 1, time.Minute)
+	assert.ErrorIs(t, err, ErrNotSupported)
+
+	// The helpers fall back through Get and Set.
+	ok, err := SetNX(ctx, ic, "app:lock", "1", time.Minute)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	_, err = TTL(ctx, ic, "app:lock")
+	assert.ErrorIs(t, err, ErrNotSupported)
+
+	var sb strings.Builder
+	require.NoError(t, registry.WriteText(&sb))
+	out := sb.String()
+	assert.Contains(t, out, `sdk_cache_operations_total{cache="default",op="get",prefix="app",result="miss"} 1`)
+	assert.Contains(t, out, `sdk_cache_operations_total{cache="default",op="set",prefix="app",result="ok"} 1`)
+	assert.NotContains(t, out, `op="setnx"`)
+	assert.NotContains(t, out, `op="ttl"`)
+	assert.NotContains(t, out, `result="error"`)
+}
+
+func TestInstrumented_SlowLog(t *testing.T) {
+	ctx := context.Background()
+	logger := &recordingLogger{}
+	backend := slowCache{Cache: NewMemcache(0, time.Minute), delay: 20 * time.Millisecond}
+	ic := NewInstrumented(backend, metrics.NewRegistry(),
+		WithSlowLog(logger, 10*time.Millisecond),
+		WithKeyPrefixFunc(func(key string) string { return "all" }))
+
+	require.NoError(t, ic.Set(ctx, "key", "v", time.Minute))
+	assert.Empty(t, logger.entries)
+
+	_, err := ic.Get(ctx, "key")
+	require.NoError(t, err)
+	require.Len(t, logger.entries, 1)
+	assert.Contains(t, logger.entries[0], "slow cache operation")
+	assert.Contains(t, logger.entries[0], "all")
+}
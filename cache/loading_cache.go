@@ -0,0 +1,232 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Lumiaqian/go-sdk-core/log"
+)
+
+// Loader produces the value for a key on a cache miss. Returning ErrNotFound marks the key as
+// absent, which is cached for the negative TTL if one is configured.
+type Loader func(ctx context.Context) (string, error)
+
+const loadingEntryPrefix = "ld1:"
+
+// LoadingCache is a read-through layer over a Cache. Concurrent loads of the same key are
+// collapsed into a single Loader call, and with a stale window configured an expired entry is
+// served while one goroutine reloads it in the background.
+type LoadingCache struct {
+	cache       Cache
+	staleWindow time.Duration
+	negativeTTL time.Duration
+	loadTimeout time.Duration
+	logger      log.Logger
+	now         func() time.Time
+
+	mutex  sync.Mutex
+	flight map[string]*loadCall
+}
+
+type loadCall struct {
+	done  chan struct{}
+	value string
+	err   error
+}
+
+type LoadingOption func(*LoadingCache)
+
+// WithStaleWindow keeps entries for window past their TTL and serves them while they are
+// reloaded in the background. The TTL passed to GetOrLoad is the soft TTL, TTL plus window the hard TTL.
+func WithStaleWindow(window time.Duration) LoadingOption {
+	return func(c *LoadingCache) {
+		c.staleWindow = window
+	}
+}
+
+// WithNegativeTTL caches ErrNotFound results from the loader for ttl.
+func WithNegativeTTL(ttl time.Duration) LoadingOption {
+	return func(c *LoadingCache) {
+		c.negativeTTL = ttl
+	}
+}
+
+// WithLoadTimeout bounds each loader call. Loads are shared between callers and do not stop when
+// one of them gives up, so this is the only limit on a slow loader.
+func WithLoadTimeout(timeout time.Duration) LoadingOption {
+	return func(c *LoadingCache) {
+		c.loadTimeout = timeout
+	}
+}
+
+// WithLoadingLogger logs failures of background reloads and of storing loaded values, which have
+// no caller to return them to.
+func WithLoadingLogger(logger log.Logger) LoadingOption {
+	return func(c *LoadingCache) {
+		c.logger = logger
+	}
+}
+
+func NewLoadingCache(cache Cache, opts ...LoadingOption) *LoadingCache {
+	c := &LoadingCache{
+		cache:  cache,
+		now:    time.Now,
+		flight: make(map[string]*loadCall),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// GetOrLoad returns the cached value for key, calling loader on a miss and caching its result for ttl.
+// A ttl of zero or less caches the value without expiry. Loader errors other than ErrNotFound are
+// returned to every waiting caller and never cached. The loader runs without the caller's
+// cancellation, so one caller giving up does not fail the others waiting on the same load.
+func (c *LoadingCache) GetOrLoad(ctx context.Context, key string, ttl time.Duration, loader Loader) (string, error) {
+	raw, err := c.cache.Get(ctx, key)
+	if err != nil && ctx.Err() != nil {
+		return "", ctx.Err()
+	}
+	if err == nil {
+		if entry, ok := decodeLoadingEntry(raw); ok {
+			if entry.negative {
+				return "", ErrNotFound
+			}
+			if !entry.freshUntil.IsZero() && c.now().After(entry.freshUntil) {
+				c.refresh(ctx, key, ttl, loader)
+			}
+			return entry.value, nil
+		}
+	}
+
+	call, _ := c.load(ctx, key, ttl, loader)
+	select {
+	case <-call.done:
+		return call.value, call.err
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// Delete removes key so that the next GetOrLoad calls the loader.
+func (c *LoadingCache) Delete(ctx context.Context, key string) error {
+	return c.cache.Delete(ctx, key)
+}
+
+func (c *LoadingCache) refresh(ctx context.Context, key string, ttl time.Duration, loader Loader) {
+	call, started := c.load(ctx, key, ttl, loader)
+	if !started || c.logger == nil {
+		return
+	}
+	go func() {
+		<-call.done
+		if call.err != nil && !errors.Is(call.err, ErrNotFound) {
+			c.logger.Log(ctx, log.WARN, "msg", "cache background reload failed", "key", key, "error", call.err)
+		}
+	}()
+}
+
+// load starts loader for key unless a load is already in flight, and returns the in-flight call.
+// The load is detached from ctx cancellation since other callers may be waiting on it.
+func (c *LoadingCache) load(ctx context.Context, key string, ttl time.Duration, loader Loader) (*loadCall, bool) {
+	c.mutex.Lock()
+	if call, ok := c.flight[key]; ok {
+		c.mutex.Unlock()
+		return call, false
+	}
+	call := &loadCall{done: make(chan struct{})}
+	c.flight[key] = call
+	c.mutex.Unlock()
+
+	ctx = context.WithoutCancel(ctx)
+	go func() {
+		if c.loadTimeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, c.loadTimeout)
+			defer cancel()
+		}
+		defer func() {
+			if r := recover(); r != nil {
+				call.value, call.err = "", fmt.Errorf("cache: loader panicked: %v", r)
+			}
+			c.mutex.Lock()
+			delete(c.flight, key)
+			c.mutex.Unlock()
+			close(call.done)
+		}()
+
+		call.value, call.err = loader(ctx)
+		switch {
+		case call.err == nil:
+			entry := loadingEntry{value: call.value}
+			expiration := time.Duration(-1)
+			if ttl > 0 {
+				entry.freshUntil = c.now().Add(ttl)
+				expiration = ttl + c.staleWindow
+			}
+			// The value loaded fine, so callers get it even if it could not be stored.
+			if err := c.cache.Set(ctx, key, entry.encode(), expiration); err != nil && c.logger != nil {
+				c.logger.Log(ctx, log.WARN, "msg", "cache store of loaded value failed", "key", key, "error", err)
+			}
+		case errors.Is(call.err, ErrNotFound) && c.negativeTTL > 0:
+			entry := loadingEntry{negative: true, freshUntil: c.now().Add(c.negativeTTL)}
+			_ = c.cache.Set(ctx, key, entry.encode(), c.negativeTTL)
+		}
+	}()
+
+	return call, true
+}
+
+type loadingEntry struct {
+	value      string
+	negative   bool
+	freshUntil time.Time
+}
+
+// encode lays the entry out as ld1:<fresh until, unix nanos>:<v|n>:<value>. Entries without
+// expiry have a fresh until of 0.
+func (e loadingEntry) encode() string {
+	kind := "v"
+	if e.negative {
+		kind = "n"
+	}
+	var nanos int64
+	if !e.freshUntil.IsZero() {
+		nanos = e.freshUntil.UnixNano()
+	}
+	return loadingEntryPrefix + strconv.FormatInt(nanos, 10) + ":" + kind + ":" + e.value
+}
+
+func decodeLoadingEntry(raw string) (loadingEntry, bool) {
+	rest, ok := strings.CutPrefix(raw, loadingEntryPrefix)
+	if !ok {
+		return loadingEntry{}, false
+	}
+	parts := strings.SplitN(rest, ":", 3)
+	if len(parts) != 3 {
+		return loadingEntry{}, false
+	}
+	nanos, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return loadingEntry{}, false
+	}
+	var freshUntil time.Time
+	if nanos != 0 {
+		freshUntil = time.Unix(0, nanos)
+	}
+
+	switch parts[1] {
+	case "v":
+		return loadingEntry{value: parts[2], freshUntil: freshUntil}, true
+	case "n":
+		return loadingEntry{negative: true, freshUntil: freshUntil}, true
+	default:
+		return loadingEntry{}, false
+	}
+}
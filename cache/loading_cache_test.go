@@ -0,0 +1,229 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadingCache_GetOrLoad_Singleflight(t *testing.T) {
+	lc := NewLoadingCache(NewMemcache(5*time.Minute, 10*time.Minute))
+	ctx := context.Background()
+
+	var calls atomic.Int32
+	release := make(chan struct{})
+	loader := func(ctx context.Context) (string, error) {
+		calls.Add(1)
+		<-release
+		return "loaded", nil
+	}
+
+	var wg sync.WaitGroup
+	results := make([]string, 10)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			val, err := lc.GetOrLoad(ctx, "key", time.Minute, loader)
+			assert.NoError(t, err)
+			results[i] = val
+		}(i)
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), calls.Load())
+	for _, val := range results {
+		assert.Equal(t, "loaded", val)
+	}
+
+	// Served from cache afterwards.
+	val, err := lc.GetOrLoad(ctx, "key", time.Minute, loader)
+	require.NoError(t, err)
+	assert.Equal(t, "loaded", val)
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+func TestLoadingCache_GetOrLoad_StaleWhileRevalidate(t *testing.T) {
+	lc := NewLoadingCache(NewMemcache(5*time.Minute, 10*time.Minute), WithStaleWindow(time.Hour))
+	now := time.Unix(1700000000, 0)
+	var nowMutex sync.Mutex
+	lc.now = func() time.Time {
+		nowMutex.Lock()
+		defer nowMutex.Unlock()
+		return now
+	}
+	ctx := context.Background()
+
+	val, err := lc.GetOrLoad(ctx, "key", time.Minute, func(ctx context.Context) (string, error) { return "v1", nil })
+	require.NoError(t, err)
+	assert.Equal(t, "v1", val)
+
+	nowMutex.Lock()
+	now = now.Add(2 * time.Minute)
+	nowMutex.Unlock()
+
+	reloaded := make(chan struct{})
+	val, err = lc.GetOrLoad(ctx, "key", time.Minute, func(ctx context.Context) (string, error) {
+		defer close(reloaded)
+		return "v2", nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "v1", val, "stale value is served while reloading")
+
+	<-reloaded
+	assert.Eventually(t, func() bool {
+		val, err := lc.GetOrLoad(ctx, "key", time.Minute, func(ctx context.Context) (string, error) { return "v3", nil })
+		return err == nil && val == "v2"
+	}, time.Second, 5*time.Millisecond)
+}
+
+func TestLoadingCache_GetOrLoad_ErrorsAreNotCached(t *testing.T) {
+	backend := NewMemcache(5*time.Minute, 10*time.Minute)
+	lc := NewLoadingCache(backend)
+	ctx := context.Background()
+
+	_, err := lc.GetOrLoad(ctx, "key", time.Minute, func(ctx context.Context) (string, error) {
+		return "", errors.New("upstream down")
+	})
+	assert.EqualError(t, err, "upstream down")
+	_, err = backend.Get(ctx, "key")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	_, err = lc.GetOrLoad(ctx, "key", time.Minute, func(ctx context.Context) (string, error) {
+		panic("boom")
+	})
+	assert.ErrorContains(t, err, "boom")
+
+	val, err := lc.GetOrLoad(ctx, "key", time.Minute, func(ctx context.Context) (string, error) { return "ok", nil })
+	require.NoError(t, err)
+	assert.Equal(t, "ok", val)
+}
+
+func TestLoadingCache_GetOrLoad_NegativeCaching(t *testing.T) {
+	lc := NewLoadingCache(NewMemcache(5*time.Minute, 10*time.Minute), WithNegativeTTL(time.Minute))
+	ctx := context.Background()
+
+	var calls atomic.Int32
+	loader := func(ctx context.Context) (string, error) {
+		calls.Add(1)
+		return "", ErrNotFound
+	}
+
+	for i := 0; i < 3; i++ {
+		_, err := lc.GetOrLoad(ctx, "missing", time.Minute, loader)
+		assert.ErrorIs(t, err, ErrNotFound)
+	}
+	assert.Equal(t, int32(1), calls.Load())
+
+	require.NoError(t, lc.Delete(ctx, "missing"))
+	_, err := lc.GetOrLoad(ctx, "missing", time.Minute, loader)
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.Equal(t, int32(2), calls.Load())
+}
+
+func TestLoadingCache_GetOrLoad_ContextCancel(t *testing.T) {
+	lc := NewLoadingCache(NewMemcache(5*time.Minute, 10*time.Minute))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := lc.GetOrLoad(ctx, "key", time.Minute, func(ctx context.Context) (string, error) { return "v", nil })
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+// failingSetCache rejects every write.
+type failingSetCache struct {
+	Cache
+}
+
+func (c failingSetCache) Set(ctx context.Context, key, value string, expiration time.Duration) error {
+	return errors.New("backend unavailable")
+}
+
+func TestLoadingCache_GetOrLoad_CallerCancelDoesNotFailOthers(t *testing.T) {
+	lc := NewLoadingCache(NewMemcache(5*time.Minute, 10*time.Minute))
+	started, release := make(chan struct{}), make(chan struct{})
+	loader := func(ctx context.Context) (string, error) {
+		close(started)
+		select {
+		case <-release:
+			return "loaded", nil
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+
+	firstCtx, cancelFirst := context.WithCancel(context.Background())
+	firstErr := make(chan error)
+	go func() {
+		_, err := lc.GetOrLoad(firstCtx, "key", time.Minute, loader)
+		firstErr <- err
+	}()
+	<-started
+
+	secondVal := make(chan string)
+	go func() {
+		val, err := lc.GetOrLoad(context.Background(), "key", time.Minute, loader)
+		assert.NoError(t, err)
+		secondVal <- val
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	cancelFirst()
+	assert.ErrorIs(t, <-firstErr, context.Canceled)
+	close(release)
+	assert.Equal(t, "loaded", <-secondVal)
+}
+
+func TestLoadingCache_GetOrLoad_LoadTimeout(t *testing.T) {
+	lc := NewLoadingCache(NewMemcache(5*time.Minute, 10*time.Minute), WithLoadTimeout(20*time.Millisecond))
+	_, err := lc.GetOrLoad(context.Background(), "key", time.Minute, func(ctx context.Context) (string, error) {
+		<-ctx.Done()
+		return "", ctx.Err()
+	})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestLoadingCache_GetOrLoad_SetFailureKeepsValue(t *testing.T) {
+	logger := &recordingLogger{}
+	lc := NewLoadingCache(failingSetCache{NewMemcache(5*time.Minute, 10*time.Minute)}, WithLoadingLogger(logger))
+
+	val, err := lc.GetOrLoad(context.Background(), "key", time.Minute, func(ctx context.Context) (string, error) {
+		return "loaded", nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "loaded", val)
+	require.Len(t, logger.entries, 1)
+	assert.Contains(t, logger.entries[0], "cache store of loaded value failed")
+}
+
+func TestLoadingCache_GetOrLoad_NoExpiry(t *testing.T) {
+	lc := NewLoadingCache(NewMemcache(0, 10*time.Minute), WithStaleWindow(time.Hour))
+	now := time.Unix(1700000000, 0)
+	lc.now = func() time.Time { return now }
+
+	var calls atomic.Int32
+	loader := func(ctx context.Context) (string, error) {
+		calls.Add(1)
+		return "forever", nil
+	}
+	for _, ttl := range []time.Duration{0, -1} {
+		key := "key" + ttl.String()
+		for i := 0; i < 3; i++ {
+			val, err := lc.GetOrLoad(context.Background(), key, ttl, loader)
+			require.NoError(t, err)
+			assert.Equal(t, "forever", val)
+			now = now.Add(24 * time.Hour)
+		}
+	}
+	time.Sleep(20 * time.Millisecond)
+	// One load per key, no background refreshes.
+	assert.Equal(t, int32(2), calls.Load())
+}
@@ -2,7 +2,9 @@ package cache
 
 import (
 	"context"
-	"errors"
+	"fmt"
+	"strconv"
+	"sync"
 	"time"
 
 	gocache "github.com/patrickmn/go-cache"
@@ -10,6 +12,8 @@ import (
 
 type Memcache struct {
 	cache *gocache.Cache
+	// mutex serializes writes so that the read-modify-write operations are atomic.
+	mutex sync.Mutex
 }
 
 func NewMemcache(defaultExpiration, cleanupInterval time.Duration) *Memcache {
@@ -23,6 +27,8 @@ func (g *Memcache) Set(ctx context.Context, key string, value string, expiration
 	case <-ctx.Done():
 		return ctx.Err()
 	default:
+		g.mutex.Lock()
+		defer g.mutex.Unlock()
 		g.cache.Set(key, value, expiration)
 		return nil
 	}
@@ -35,9 +41,13 @@ func (g *Memcache) Get(ctx context.Context, key string) (string, error) {
 	default:
 		val, found := g.cache.Get(key)
 		if !found {
-			return "", errors.New("key not found")
+			return "", ErrNotFound
 		}
-		return val.(string), nil
+		str, ok := val.(string)
+		if !ok {
+			return "", fmt.Errorf("cache: unexpected value type %T for key %q", val, key)
+		}
+		return str, nil
 	}
 }
 
@@ -46,7 +56,107 @@ func (g *Memcache) Delete(ctx context.Context, key string) error {
 	case <-ctx.Done():
 		return ctx.Err()
 	default:
+		g.mutex.Lock()
+		defer g.mutex.Unlock()
 		g.cache.Delete(key)
 		return nil
 	}
 }
+
+func (g *Memcache) TTL(ctx context.Context, key string) (time.Duration, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	_, expiresAt, found := g.cache.GetWithExpiration(key)
+	if !found {
+		return 0, ErrNotFound
+	}
+	return remainingTTL(expiresAt, time.Now()), nil
+}
+
+func (g *Memcache) SetNX(ctx context.Context, key string, value string, expiration time.Duration) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	return g.cache.Add(key, value, expiration) == nil, nil
+}
+
+func (g *Memcache) CompareAndSwap(ctx context.Context, key string, oldValue, newValue string, expiration time.Duration) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	current, found := g.cache.Get(key)
+	if !found || current != oldValue {
+		return false, nil
+	}
+	g.cache.Set(key, newValue, expiration)
+	return true, nil
+}
+
+func (g *Memcache) Incr(ctx context.Context, key string, delta int64, expiration time.Duration) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	current, expiresAt, found := g.cache.GetWithExpiration(key)
+	str, _ := current.(string)
+	n, err := addToInteger(str, found, delta)
+	if err != nil {
+		return 0, err
+	}
+	if found {
+		expiration = NoExpiration
+		if !expiresAt.IsZero() {
+			// Keep the remaining lifetime, at least a nanosecond so it cannot turn into "never".
+			expiration = max(time.Until(expiresAt), time.Nanosecond)
+		}
+	}
+	g.cache.Set(key, strconv.FormatInt(n, 10), expiration)
+	return n, nil
+}
+
+func (g *Memcache) MGet(ctx context.Context, keys []string) (map[string]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	values := make(map[string]string, len(keys))
+	for _, key := range keys {
+		if val, found := g.cache.Get(key); found {
+			if str, ok := val.(string); ok {
+				values[key] = str
+			}
+		}
+	}
+	return values, nil
+}
+
+func (g *Memcache) MSet(ctx context.Context, items map[string]string, expiration time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	for key, value := range items {
+		g.cache.Set(key, value, expiration)
+	}
+	return nil
+}
+
+func (g *Memcache) MDelete(ctx context.Context, keys []string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	for _, key := range keys {
+		g.cache.Delete(key)
+	}
+	return nil
+}
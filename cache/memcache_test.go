@@ -33,7 +33,7 @@ func TestMemcache_Set_Get_Delete(t *testing.T) {
 
 	// Test Get with non-existing key
 	_, err = mc.Get(ctx, "nonExistingKey")
-	assert.Error(t, err)
+	assert.ErrorIs(t, err, ErrNotFound)
 
 	// Test Delete
 	err = mc.Delete(ctx, key)
@@ -0,0 +1,305 @@
+package cache
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	namespaceSeparator = ":"
+	tagKeyPrefix       = "#tag:"
+	taggedValuePrefix  = "tg1:"
+	// plainValueEscape is prepended to plain values that could be mistaken for a tagged entry.
+	plainValueEscape = "\x00"
+)
+
+// namespaceEscaper is applied to namespace parts, keys and tags alike, so none of them can contain
+// a separator or start with the "#" of the tag key prefix.
+var namespaceEscaper = strings.NewReplacer("%", "%25", ":", "%3A", "#", "%23")
+
+// Namespaced prefixes every key so that several SDKs, tenants or environments can share one backend
+// without collisions. Keys are escaped like namespace parts, so any string is a valid key.
+//
+// Entries written with SetWithTags can be invalidated as a group with InvalidateTags. Every tag has a
+// random version stored in the cache, a tagged entry records the versions it was written under and
+// reads as a miss once any of them changed or disappeared.
+//
+// Its capability methods return ErrNotSupported when the wrapped cache lacks the capability, so a
+// non-atomic fallback never passes for an atomic operation; the helpers then fall back on Get and Set.
+type Namespaced struct {
+	cache  Cache
+	prefix string
+}
+
+// NewNamespaced creates a namespace from parts, e.g. NewNamespaced(c, "wechat", tenantID, "prod").
+func NewNamespaced(cache Cache, parts ...string) *Namespaced {
+	return &Namespaced{cache: cache, prefix: joinNamespace(parts)}
+}
+
+// Namespace returns a child namespace sharing the same backend.
+func (n *Namespaced) Namespace(parts ...string) *Namespaced {
+	return &Namespaced{cache: n.cache, prefix: n.prefix + joinNamespace(parts)}
+}
+
+// Prefix returns the string prepended to every key.
+func (n *Namespaced) Prefix() string {
+	return n.prefix
+}
+
+func (n *Namespaced) Get(ctx context.Context, key string) (string, error) {
+	raw, err := n.cache.Get(ctx, n.key(key))
+	if err != nil {
+		return "", err
+	}
+	return n.decode(ctx, raw)
+}
+
+// decode returns the value of a stored entry, or ErrNotFound for a tagged entry that was invalidated.
+func (n *Namespaced) decode(ctx context.Context, raw string) (string, error) {
+	if value, ok := strings.CutPrefix(raw, plainValueEscape); ok {
+		return value, nil
+	}
+	tags, value, ok := decodeTagged(raw)
+	if !ok {
+		return raw, nil
+	}
+	valid, err := n.tagsValid(ctx, tags)
+	if err != nil {
+		return "", err
+	}
+	if !valid {
+		return "", ErrNotFound
+	}
+	return value, nil
+}
+
+func (n *Namespaced) Set(ctx context.Context, key string, value string, expiration time.Duration) error {
+	return n.cache.Set(ctx, n.key(key), encodePlain(value), expiration)
+}
+
+func (n *Namespaced) Delete(ctx context.Context, key string) error {
+	return n.cache.Delete(ctx, n.key(key))
+}
+
+// SetWithTags stores value like Set and attaches tags for group invalidation.
+func (n *Namespaced) SetWithTags(ctx context.Context, key string, value string, expiration time.Duration, tags ...string) error {
+	if len(tags) == 0 {
+		return n.Set(ctx, key, value, expiration)
+	}
+
+	versions, err := n.tagVersions(ctx, tags)
+	if err != nil {
+		return err
+	}
+	for _, tag := range tags {
+		if _, ok := versions[tag]; ok {
+			continue
+		}
+		version := newTagVersion()
+		if _, err := SetNX(ctx, n.cache, n.tagKey(tag), version, NoExpiration); err != nil {
+			return err
+		}
+		// Another writer may have won the race, read back the version that is stored.
+		current, err := n.cache.Get(ctx, n.tagKey(tag))
+		if err != nil {
+			return err
+		}
+		versions[tag] = current
+	}
+
+	return n.cache.Set(ctx, n.key(key), encodeTagged(versions, value), expiration)
+}
+
+// InvalidateTags makes every entry written with any of tags read as a miss.
+func (n *Namespaced) InvalidateTags(ctx context.Context, tags ...string) error {
+	items := make(map[string]string, len(tags))
+	for _, tag := range tags {
+		items[n.tagKey(tag)] = newTagVersion()
+	}
+	return MSet(ctx, n.cache, items, NoExpiration)
+}
+
+func (n *Namespaced) TTL(ctx context.Context, key string) (time.Duration, error) {
+	return TTL(ctx, n.cache, n.key(key))
+}
+
+func (n *Namespaced) SetNX(ctx context.Context, key string, value string, expiration time.Duration) (bool, error) {
+	nc, ok := n.cache.(SetNXCache)
+	if !ok {
+		return false, ErrNotSupported
+	}
+	return nc.SetNX(ctx, n.key(key), encodePlain(value), expiration)
+}
+
+func (n *Namespaced) CompareAndSwap(ctx context.Context, key string, oldValue, newValue string, expiration time.Duration) (bool, error) {
+	cc, ok := n.cache.(CASCache)
+	if !ok {
+		return false, ErrNotSupported
+	}
+	return cc.CompareAndSwap(ctx, n.key(key), encodePlain(oldValue), encodePlain(newValue), expiration)
+}
+
+func (n *Namespaced) Incr(ctx context.Context, key string, delta int64, expiration time.Duration) (int64, error) {
+	ic, ok := n.cache.(IncrCache)
+	if !ok {
+		return 0, ErrNotSupported
+	}
+	return ic.Incr(ctx, n.key(key), delta, expiration)
+}
+
+func (n *Namespaced) MGet(ctx context.Context, keys []string) (map[string]string, error) {
+	bc, ok := n.cache.(BatchCache)
+	if !ok {
+		return nil, ErrNotSupported
+	}
+	prefixed := make([]string, len(keys))
+	for i, key := range keys {
+		prefixed[i] = n.key(key)
+	}
+	stored, err := bc.MGet(ctx, prefixed)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]string, len(stored))
+	for i, key := range keys {
+		raw, ok := stored[prefixed[i]]
+		if !ok {
+			continue
+		}
+		value, err := n.decode(ctx, raw)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		values[key] = value
+	}
+	return values, nil
+}
+
+func (n *Namespaced) MSet(ctx context.Context, items map[string]string, expiration time.Duration) error {
+	bc, ok := n.cache.(BatchCache)
+	if !ok {
+		return ErrNotSupported
+	}
+	prefixed := make(map[string]string, len(items))
+	for key, value := range items {
+		prefixed[n.key(key)] = encodePlain(value)
+	}
+	return bc.MSet(ctx, prefixed, expiration)
+}
+
+func (n *Namespaced) MDelete(ctx context.Context, keys []string) error {
+	bc, ok := n.cache.(BatchCache)
+	if !ok {
+		return ErrNotSupported
+	}
+	prefixed := make([]string, len(keys))
+	for i, key := range keys {
+		prefixed[i] = n.key(key)
+	}
+	return bc.MDelete(ctx, prefixed)
+}
+
+func (n *Namespaced) key(key string) string {
+	return n.prefix + namespaceEscaper.Replace(key)
+}
+
+func (n *Namespaced) tagKey(tag string) string {
+	return n.prefix + tagKeyPrefix + namespaceEscaper.Replace(tag)
+}
+
+func (n *Namespaced) tagVersions(ctx context.Context, tags []string) (map[string]string, error) {
+	keys := make([]string, len(tags))
+	for i, tag := range tags {
+		keys[i] = n.tagKey(tag)
+	}
+	stored, err := MGet(ctx, n.cache, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	versions := make(map[string]string, len(tags))
+	for _, tag := range tags {
+		if version, ok := stored[n.tagKey(tag)]; ok {
+			versions[tag] = version
+		}
+	}
+	return versions, nil
+}
+
+func (n *Namespaced) tagsValid(ctx context.Context, tags map[string]string) (bool, error) {
+	names := make([]string, 0, len(tags))
+	for tag := range tags {
+		names = append(names, tag)
+	}
+	current, err := n.tagVersions(ctx, names)
+	if err != nil {
+		return false, err
+	}
+	for tag, version := range tags {
+		if current[tag] != version {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func joinNamespace(parts []string) string {
+	var sb strings.Builder
+	for _, part := range parts {
+		sb.WriteString(namespaceEscaper.Replace(part))
+		sb.WriteString(namespaceSeparator)
+	}
+	return sb.String()
+}
+
+func newTagVersion() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// encodePlain escapes values that start like a tagged entry or an escaped value, so Get never
+// mistakes a plain value for a tagged one.
+func encodePlain(value string) string {
+	if strings.HasPrefix(value, taggedValuePrefix) || strings.HasPrefix(value, plainValueEscape) {
+		return plainValueEscape + value
+	}
+	return value
+}
+
+// encodeTagged lays a tagged entry out as tg1:<header length>:<header JSON><value>.
+func encodeTagged(versions map[string]string, value string) string {
+	header, _ := json.Marshal(versions)
+	return taggedValuePrefix + strconv.Itoa(len(header)) + ":" + string(header) + value
+}
+
+func decodeTagged(raw string) (map[string]string, string, bool) {
+	rest, ok := strings.CutPrefix(raw, taggedValuePrefix)
+	if !ok {
+		return nil, "", false
+	}
+	lengthStr, rest, ok := strings.Cut(rest, ":")
+	if !ok {
+		return nil, "", false
+	}
+	length, err := strconv.Atoi(lengthStr)
+	if err != nil || length < 0 || length > len(rest) {
+		return nil, "", false
+	}
+
+	var versions map[string]string
+	if err := json.Unmarshal([]byte(rest[:length]), &versions); err != nil {
+		return nil, "", false
+	}
+	return versions, rest[length:], true
+}
@@ -0,0 +1,212 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNamespaced_PrefixesKeys(t *testing.T) {
+	ctx := context.Background()
+	backend := NewMemcache(0, time.Minute)
+	wechat := NewNamespaced(backend, "wechat", "prod")
+	dingtalk := NewNamespaced(backend, "dingtalk", "prod")
+
+	require.NoError(t, wechat.Set(ctx, "access_token", "wx", time.Hour))
+	require.NoError(t, dingtalk.Set(ctx, "access_token", "dd", time.Hour))
+
+	val, err := wechat.Get(ctx, "access_token")
+	require.NoError(t, err)
+	assert.Equal(t, "wx", val)
+	val, err = dingtalk.Get(ctx, "access_token")
+	require.NoError(t, err)
+	assert.Equal(t, "dd", val)
+
+	raw, err := backend.Get(ctx, "wechat:prod:access_token")
+	require.NoError(t, err)
+	assert.Equal(t, "wx", raw)
+
+	// Separators inside parts cannot forge another namespace.
+	assert.NotEqual(t, NewNamespaced(backend, "a:b").Prefix(), NewNamespaced(backend, "a", "b").Prefix())
+	assert.Equal(t, "wechat:prod:tenant-1:", wechat.Namespace("tenant-1").Prefix())
+
+	require.NoError(t, wechat.Delete(ctx, "access_token"))
+	_, err = wechat.Get(ctx, "access_token")
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, err = dingtalk.Get(ctx, "access_token")
+	assert.NoError(t, err)
+}
+
+func TestNamespaced_KeysCannotCollide(t *testing.T) {
+	ctx := context.Background()
+	backend := NewMemcache(0, time.Minute)
+	ns := NewNamespaced(backend, "x")
+
+	// A key with a separator does not reach into a child namespace.
+	require.NoError(t, ns.Set(ctx, "a:b", "parent", time.Hour))
+	require.NoError(t, ns.Namespace("a").Set(ctx, "b", "child", time.Hour))
+	val, err := ns.Get(ctx, "a:b")
+	require.NoError(t, err)
+	assert.Equal(t, "parent", val)
+
+	// Neither a key nor a child namespace can overwrite a tag version.
+	require.NoError(t, ns.SetWithTags(ctx, "token", "t1", time.Hour, "app"))
+	require.NoError(t, ns.Set(ctx, "#tag:app", "forged", time.Hour))
+	require.NoError(t, ns.Namespace("#tag").Set(ctx, "app", "forged", time.Hour))
+	val, err = ns.Get(ctx, "token")
+	require.NoError(t, err)
+	assert.Equal(t, "t1", val)
+}
+
+func TestNamespaced_PlainValuesAreNotSniffed(t *testing.T) {
+	ctx := context.Background()
+	ns := NewNamespaced(NewMemcache(0, time.Minute), "x")
+
+	for _, value := range []string{`tg1:2:{}value`, "tg1:garbage", "\x00escaped", "plain"} {
+		require.NoError(t, ns.Set(ctx, "key", value, time.Hour))
+		val, err := ns.Get(ctx, "key")
+		require.NoError(t, err)
+		assert.Equal(t, value, val)
+	}
+
+	swapped, err := ns.CompareAndSwap(ctx, "key", "plain", "tg1:next", time.Hour)
+	require.NoError(t, err)
+	assert.True(t, swapped)
+	values, err := ns.MGet(ctx, []string{"key"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"key": "tg1:next"}, values)
+}
+
+func TestNamespaced_Capabilities(t *testing.T) {
+	ctx := context.Background()
+	backend := NewMemcache(0, time.Minute)
+	ns := NewNamespaced(backend, "sdk")
+
+	n, err := Incr(ctx, ns, "calls", 1, time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+	ttl, err := TTL(ctx, ns, "calls")
+	require.NoError(t, err)
+	assert.Greater(t, ttl, time.Duration(0))
+
+	ok, err := SetNX(ctx, ns, "lock", "me", time.Minute)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	_, err = backend.Get(ctx, "sdk:lock")
+	assert.NoError(t, err)
+
+	require.NoError(t, MSet(ctx, ns, map[string]string{"a": "1"}, time.Minute))
+	values, err := MGet(ctx, ns, []string{"a", "lock"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"a": "1", "lock": "me"}, values)
+	require.NoError(t, MDelete(ctx, ns, []string{"a"}))
+	_, err = backend.Get(ctx, "sdk:a")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestNamespaced_OnlyWrappedCapabilities(t *testing.T) {
+	ctx := context.Background()
+	// slowCache exposes only Get, Set and Delete.
+	ns := NewNamespaced(slowCache{Cache: NewMemcache(0, time.Minute)}, "sdk")
+
+	_, err := ns.SetNX(ctx, "lock", "me", time.Minute)
+	assert.ErrorIs(t, err, ErrNotSupported)
+	_, err = ns.CompareAndSwap(ctx, "lock", "me", "you", time.Minute)
+	assert.ErrorIs(t, err, ErrNotSupported)
+	_, err = ns.Incr(ctx, "calls", 1, time.Minute)
+	assert.ErrorIs(t, err, ErrNotSupported)
+	_, err = ns.MGet(ctx, []string{"lock"})
+	assert.ErrorIs(t, err, ErrNotSupported)
+
+	// The helpers fall back on the namespace's own Get and Set.
+	ok, err := SetNX(ctx, ns, "lock", "me", time.Minute)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	n, err := Incr(ctx, ns, "calls", 2, time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+	values, err := MGet(ctx, ns, []string{"lock", "calls", "missing"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"lock": "me", "calls": "2"}, values)
+}
+
+func TestNamespaced_BatchGetDropsInvalidatedEntries(t *testing.T) {
+	ctx := context.Background()
+	ns := NewNamespaced(NewMemcache(0, time.Minute), "sdk")
+	require.NoError(t, ns.SetWithTags(ctx, "a", "1", time.Minute, "dept"))
+	require.NoError(t, ns.Set(ctx, "b", "2", time.Minute))
+	require.NoError(t, ns.InvalidateTags(ctx, "dept"))
+
+	values, err := ns.MGet(ctx, []string{"a", "b"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"b": "2"}, values)
+}
+
+func TestNamespaced_TagInvalidation(t *testing.T) {
+	ctx := context.Background()
+	for name, backend := range map[string]Cache{
+		"memcache": NewMemcache(0, time.Minute),
+		"fallback": plainCache{NewMemcache(0, time.Minute)},
+	} {
+		t.Run(name, func(t *testing.T) {
+			ns := NewNamespaced(backend, "wechat")
+
+			require.NoError(t, ns.SetWithTags(ctx, "app1:token", "t1", time.Hour, "tenant:a", "app:1"))
+			require.NoError(t, ns.SetWithTags(ctx, "app1:ticket", "j1", time.Hour, "tenant:a", "app:1"))
+			require.NoError(t, ns.SetWithTags(ctx, "app2:token", "t2", time.Hour, "tenant:a", "app:2"))
+			require.NoError(t, ns.Set(ctx, "untagged", "u", time.Hour))
+
+			val, err := ns.Get(ctx, "app1:token")
+			require.NoError(t, err)
+			assert.Equal(t, "t1", val)
+
+			// Rotating app 1's secret drops everything tagged with it.
+			require.NoError(t, ns.InvalidateTags(ctx, "app:1"))
+			_, err = ns.Get(ctx, "app1:token")
+			assert.ErrorIs(t, err, ErrNotFound)
+			_, err = ns.Get(ctx, "app1:ticket")
+			assert.ErrorIs(t, err, ErrNotFound)
+			val, err = ns.Get(ctx, "app2:token")
+			require.NoError(t, err)
+			assert.Equal(t, "t2", val)
+
+			// New writes under the same tag are valid again.
+			require.NoError(t, ns.SetWithTags(ctx, "app1:token", "t1b", time.Hour, "app:1"))
+			val, err = ns.Get(ctx, "app1:token")
+			require.NoError(t, err)
+			assert.Equal(t, "t1b", val)
+
+			require.NoError(t, ns.InvalidateTags(ctx, "tenant:a"))
+			_, err = ns.Get(ctx, "app2:token")
+			assert.ErrorIs(t, err, ErrNotFound)
+			val, err = ns.Get(ctx, "app1:token")
+			require.NoError(t, err, "written without the tenant tag")
+			assert.Equal(t, "t1b", val)
+			val, err = ns.Get(ctx, "untagged")
+			require.NoError(t, err)
+			assert.Equal(t, "u", val)
+
+			// Tags are scoped to the namespace.
+			other := NewNamespaced(backend, "dingtalk")
+			require.NoError(t, other.SetWithTags(ctx, "token", "d", time.Hour, "app:1"))
+			require.NoError(t, ns.InvalidateTags(ctx, "app:1"))
+			_, err = other.Get(ctx, "token")
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestNamespaced_LostTagVersionIsMiss(t *testing.T) {
+	ctx := context.Background()
+	backend := NewMemcache(0, time.Minute)
+	ns := NewNamespaced(backend, "sdk")
+
+	require.NoError(t, ns.SetWithTags(ctx, "key", "value", time.Hour, "tenant:a"))
+	require.NoError(t, backend.Delete(ctx, "sdk:#tag:tenant%3Aa"))
+
+	_, err := ns.Get(ctx, "key")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
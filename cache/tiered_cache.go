@@ -0,0 +1,205 @@
+package cache
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+)
+
+// Invalidation tells other TieredCache instances to drop their local copy of Key.
+type Invalidation struct {
+	// Source identifies the publishing instance so it can ignore its own messages.
+	Source string
+	Key    string
+}
+
+// InvalidationBus carries invalidations between instances, typically over Redis pub/sub or a message queue.
+type InvalidationBus interface {
+	Publish(ctx context.Context, msg Invalidation) error
+	// Subscribe registers handler for every published message and returns a function that removes it.
+	Subscribe(handler func(ctx context.Context, msg Invalidation)) (unsubscribe func())
+}
+
+const defaultMaxLocalTTL = time.Minute
+
+// TieredCache reads through a local in-process cache to a shared remote cache. Writes go to both,
+// with the local copy kept for at most the max local TTL so that instances converge even
+// without an invalidation bus.
+type TieredCache struct {
+	local       Cache
+	remote      Cache
+	maxLocalTTL time.Duration
+	bus         InvalidationBus
+	id          string
+	unsubscribe func()
+}
+
+type TieredOption func(*TieredCache)
+
+// WithMaxLocalTTL caps how long entries live in the local tier, it defaults to one minute.
+func WithMaxLocalTTL(ttl time.Duration) TieredOption {
+	return func(c *TieredCache) {
+		if ttl > 0 {
+			c.maxLocalTTL = ttl
+		}
+	}
+}
+
+// WithInvalidationBus publishes every Set and Delete on bus and evicts local entries on messages from other instances.
+func WithInvalidationBus(bus InvalidationBus) TieredOption {
+	return func(c *TieredCache) {
+		c.bus = bus
+	}
+}
+
+func NewTieredCache(local, remote Cache, opts ...TieredOption) *TieredCache {
+	c := &TieredCache{
+		local:       local,
+		remote:      remote,
+		maxLocalTTL: defaultMaxLocalTTL,
+		id:          newInstanceID(),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.bus != nil {
+		c.unsubscribe = c.bus.Subscribe(c.onInvalidation)
+	}
+	return c
+}
+
+func (c *TieredCache) Get(ctx context.Context, key string) (string, error) {
+	value, err := c.local.Get(ctx, key)
+	if err == nil {
+		return value, nil
+	}
+	if ctx.Err() != nil {
+		return "", ctx.Err()
+	}
+
+	value, err = c.remote.Get(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	// Without TTL support the remaining remote lifetime is unknown and the copy lives for the max local TTL.
+	var deadline time.Time
+	if remaining, err := TTL(ctx, c.remote, key); err == nil && remaining > 0 {
+		deadline = time.Now().Add(remaining)
+	}
+	c.setLocal(ctx, key, value, deadline)
+	return value, nil
+}
+
+func (c *TieredCache) Set(ctx context.Context, key string, value string, expiration time.Duration) error {
+	// The deadline is taken before the remote write so that the local copy cannot outlive it.
+	var deadline time.Time
+	if expiration > 0 {
+		deadline = time.Now().Add(expiration)
+	}
+	if err := c.remote.Set(ctx, key, value, expiration); err != nil {
+		return err
+	}
+	if err := c.setLocal(ctx, key, value, deadline); err != nil {
+		return err
+	}
+	return c.publish(ctx, key)
+}
+
+func (c *TieredCache) Delete(ctx context.Context, key string) error {
+	remoteErr := c.remote.Delete(ctx, key)
+	localErr := c.local.Delete(ctx, key)
+	if err := errors.Join(remoteErr, localErr); err != nil {
+		return err
+	}
+	return c.publish(ctx, key)
+}
+
+// Close stops listening for invalidations.
+func (c *TieredCache) Close() {
+	if c.unsubscribe != nil {
+		c.unsubscribe()
+	}
+}
+
+// setLocal copies value to the local tier, or drops the local copy when the remote entry expires too soon to keep one.
+func (c *TieredCache) setLocal(ctx context.Context, key, value string, remoteDeadline time.Time) error {
+	ttl := c.localTTL(remoteDeadline, time.Now())
+	if ttl <= 0 {
+		return c.local.Delete(ctx, key)
+	}
+	return c.local.Set(ctx, key, value, ttl)
+}
+
+// localTTL caps the local lifetime at the max local TTL and keeps it strictly below the remaining
+// remote lifetime, with a margin for clock granularity. A zero deadline means the remote entry has no known expiry.
+func (c *TieredCache) localTTL(remoteDeadline, now time.Time) time.Duration {
+	if remoteDeadline.IsZero() {
+		return c.maxLocalTTL
+	}
+	remaining := remoteDeadline.Sub(now)
+	return min(remaining-max(remaining/10, time.Millisecond), c.maxLocalTTL)
+}
+
+func (c *TieredCache) publish(ctx context.Context, key string) error {
+	if c.bus == nil {
+		return nil
+	}
+	return c.bus.Publish(ctx, Invalidation{Source: c.id, Key: key})
+}
+
+func (c *TieredCache) onInvalidation(ctx context.Context, msg Invalidation) {
+	if msg.Source == c.id {
+		return
+	}
+	_ = c.local.Delete(ctx, msg.Key)
+}
+
+func newInstanceID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// MemoryBus is an in-process InvalidationBus, useful for tests and for several caches in one process.
+type MemoryBus struct {
+	mutex    sync.RWMutex
+	nextID   int
+	handlers map[int]func(ctx context.Context, msg Invalidation)
+}
+
+func NewMemoryBus() *MemoryBus {
+	return &MemoryBus{
+		handlers: make(map[int]func(ctx context.Context, msg Invalidation)),
+	}
+}
+
+func (b *MemoryBus) Publish(ctx context.Context, msg Invalidation) error {
+	b.mutex.RLock()
+	handlers := make([]func(ctx context.Context, msg Invalidation), 0, len(b.handlers))
+	for _, handler := range b.handlers {
+		handlers = append(handlers, handler)
+	}
+	b.mutex.RUnlock()
+
+	for _, handler := range handlers {
+		handler(ctx, msg)
+	}
+	return nil
+}
+
+func (b *MemoryBus) Subscribe(handler func(ctx context.Context, msg Invalidation)) func() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	id := b.nextID
+	b.nextID++
+	b.handlers[id] = handler
+
+	return func() {
+		b.mutex.Lock()
+		defer b.mutex.Unlock()
+		delete(b.handlers, id)
+	}
+}
@@ -0,0 +1,127 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTieredCache_ReadThrough(t *testing.T) {
+	ctx := context.Background()
+	local := NewMemcache(5*time.Minute, 10*time.Minute)
+	remote := NewMemcache(5*time.Minute, 10*time.Minute)
+	tc := NewTieredCache(local, remote)
+
+	require.NoError(t, remote.Set(ctx, "key", "remote-value", time.Hour))
+
+	val, err := tc.Get(ctx, "key")
+	require.NoError(t, err)
+	assert.Equal(t, "remote-value", val)
+
+	// The value was copied to the local tier.
+	val, err = local.Get(ctx, "key")
+	require.NoError(t, err)
+	assert.Equal(t, "remote-value", val)
+
+	_, err = tc.Get(ctx, "missing")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestTieredCache_SetWritesBothTiers(t *testing.T) {
+	ctx := context.Background()
+	local := NewMemcache(5*time.Minute, 10*time.Minute)
+	remote := NewMemcache(5*time.Minute, 10*time.Minute)
+	tc := NewTieredCache(local, remote, WithMaxLocalTTL(50*time.Millisecond))
+
+	require.NoError(t, tc.Set(ctx, "key", "value", time.Hour))
+	for _, c := range []Cache{local, remote} {
+		val, err := c.Get(ctx, "key")
+		require.NoError(t, err)
+		assert.Equal(t, "value", val)
+	}
+
+	now := time.Now()
+	assert.Equal(t, 50*time.Millisecond, tc.localTTL(now.Add(time.Hour), now))
+	assert.Equal(t, 36*time.Millisecond, tc.localTTL(now.Add(40*time.Millisecond), now))
+	assert.Equal(t, 9*time.Millisecond, tc.localTTL(now.Add(10*time.Millisecond), now))
+	assert.LessOrEqual(t, tc.localTTL(now.Add(time.Millisecond), now), time.Duration(0))
+	assert.Equal(t, 50*time.Millisecond, tc.localTTL(time.Time{}, now))
+
+	time.Sleep(80 * time.Millisecond)
+	_, err := local.Get(ctx, "key")
+	assert.ErrorIs(t, err, ErrNotFound)
+	val, err := tc.Get(ctx, "key")
+	require.NoError(t, err)
+	assert.Equal(t, "value", val)
+}
+
+func TestTieredCache_LocalCopyNeverOutlivesRemote(t *testing.T) {
+	ctx := context.Background()
+	local := NewMemcache(5*time.Minute, 10*time.Minute)
+	remote := NewMemcache(5*time.Minute, 10*time.Minute)
+	tc := NewTieredCache(local, remote, WithMaxLocalTTL(time.Hour))
+
+	require.NoError(t, tc.Set(ctx, "key", "value", 50*time.Millisecond))
+	localTTL, err := TTL(ctx, local, "key")
+	require.NoError(t, err)
+	remoteTTL, err := TTL(ctx, remote, "key")
+	require.NoError(t, err)
+	assert.Less(t, localTTL, remoteTTL)
+
+	// A copy made on read is capped by the remaining remote TTL too.
+	require.NoError(t, local.Delete(ctx, "key"))
+	_, err = tc.Get(ctx, "key")
+	require.NoError(t, err)
+	localTTL, err = TTL(ctx, local, "key")
+	require.NoError(t, err)
+	assert.Less(t, localTTL, 50*time.Millisecond)
+
+	time.Sleep(60 * time.Millisecond)
+	_, err = tc.Get(ctx, "key")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestTieredCache_CrossInstanceInvalidation(t *testing.T) {
+	ctx := context.Background()
+	remote := NewMemcache(5*time.Minute, 10*time.Minute)
+	bus := NewMemoryBus()
+
+	localA := NewMemcache(5*time.Minute, 10*time.Minute)
+	localB := NewMemcache(5*time.Minute, 10*time.Minute)
+	nodeA := NewTieredCache(localA, remote, WithInvalidationBus(bus))
+	nodeB := NewTieredCache(localB, remote, WithInvalidationBus(bus))
+	defer nodeA.Close()
+	defer nodeB.Close()
+
+	require.NoError(t, nodeA.Set(ctx, "token", "t1", time.Hour))
+	val, err := nodeB.Get(ctx, "token")
+	require.NoError(t, err)
+	assert.Equal(t, "t1", val)
+
+	// A new value on node A evicts node B's local copy but keeps node A's own.
+	require.NoError(t, nodeA.Set(ctx, "token", "t2", time.Hour))
+	_, err = localB.Get(ctx, "token")
+	assert.ErrorIs(t, err, ErrNotFound)
+	val, err = localA.Get(ctx, "token")
+	require.NoError(t, err)
+	assert.Equal(t, "t2", val)
+
+	val, err = nodeB.Get(ctx, "token")
+	require.NoError(t, err)
+	assert.Equal(t, "t2", val)
+
+	require.NoError(t, nodeA.Delete(ctx, "token"))
+	_, err = nodeB.Get(ctx, "token")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	// After Close node B no longer listens.
+	require.NoError(t, nodeB.Set(ctx, "other", "v", time.Hour))
+	nodeB.Close()
+	require.NoError(t, nodeA.Set(ctx, "other", "v2", time.Hour))
+	val, err = localB.Get(ctx, "other")
+	require.NoError(t, err)
+	assert.Equal(t, "v", val)
+}
@@ -0,0 +1,53 @@
+package cache
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// Typed stores values of type T in a string based Cache using a Codec.
+type Typed[T any] struct {
+	cache Cache
+	codec Codec
+}
+
+func NewTyped[T any](cache Cache, codec Codec) *Typed[T] {
+	return &Typed[T]{
+		cache: cache,
+		codec: codec,
+	}
+}
+
+func (t *Typed[T]) Set(ctx context.Context, key string, value T, expiration time.Duration) error {
+	data, err := t.codec.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return t.cache.Set(ctx, key, t.codec.Name()+":"+string(data), expiration)
+}
+
+// Get returns ErrNotFound when the key is missing, and also when the entry was written with a
+// different codec or cannot be decoded, so it is refilled like a regular miss.
+func (t *Typed[T]) Get(ctx context.Context, key string) (T, error) {
+	var value T
+
+	raw, err := t.cache.Get(ctx, key)
+	if err != nil {
+		return value, err
+	}
+
+	name, data, ok := strings.Cut(raw, ":")
+	if !ok || name != t.codec.Name() {
+		return value, ErrNotFound
+	}
+	if err := t.codec.Unmarshal([]byte(data), &value); err != nil {
+		var zero T
+		return zero, ErrNotFound
+	}
+	return value, nil
+}
+
+func (t *Typed[T]) Delete(ctx context.Context, key string) error {
+	return t.cache.Delete(ctx, key)
+}
@@ -0,0 +1,71 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type appTicket struct {
+	Ticket    string
+	ExpiresIn int64
+}
+
+func TestTyped_Codecs(t *testing.T) {
+	ctx := context.Background()
+	backend := NewMemcache(5*time.Minute, 10*time.Minute)
+
+	for _, codec := range []Codec{JSONCodec, GobCodec} {
+		t.Run(codec.Name(), func(t *testing.T) {
+			typed := NewTyped[appTicket](backend, codec)
+			require.NoError(t, typed.Set(ctx, "ticket", appTicket{Ticket: "t1", ExpiresIn: 7200}, time.Minute))
+
+			val, err := typed.Get(ctx, "ticket")
+			require.NoError(t, err)
+			assert.Equal(t, appTicket{Ticket: "t1", ExpiresIn: 7200}, val)
+
+			require.NoError(t, typed.Delete(ctx, "ticket"))
+			_, err = typed.Get(ctx, "ticket")
+			assert.ErrorIs(t, err, ErrNotFound)
+		})
+	}
+
+	t.Run("raw", func(t *testing.T) {
+		typed := NewTyped[[]byte](backend, RawCodec)
+		require.NoError(t, typed.Set(ctx, "blob", []byte{0, 1, 2}, time.Minute))
+		val, err := typed.Get(ctx, "blob")
+		require.NoError(t, err)
+		assert.Equal(t, []byte{0, 1, 2}, val)
+
+		_, err = RawCodec.Marshal(42)
+		assert.Error(t, err)
+	})
+}
+
+func TestTyped_MismatchIsMiss(t *testing.T) {
+	ctx := context.Background()
+	backend := NewMemcache(5*time.Minute, 10*time.Minute)
+
+	v1 := NewTyped[appTicket](backend, VersionedCodec(JSONCodec, "v1"))
+	require.NoError(t, v1.Set(ctx, "ticket", appTicket{Ticket: "t1"}, time.Minute))
+
+	// A new deployment with a bumped schema version ignores the old entry.
+	v2 := NewTyped[appTicket](backend, VersionedCodec(JSONCodec, "v2"))
+	_, err := v2.Get(ctx, "ticket")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	// Entries written by another codec or by hand are misses too.
+	_, err = NewTyped[appTicket](backend, GobCodec).Get(ctx, "ticket")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	require.NoError(t, backend.Set(ctx, "ticket", "json:{not json", time.Minute))
+	_, err = NewTyped[appTicket](backend, JSONCodec).Get(ctx, "ticket")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	require.NoError(t, backend.Set(ctx, "legacy", "plain value", time.Minute))
+	_, err = NewTyped[string](backend, JSONCodec).Get(ctx, "legacy")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
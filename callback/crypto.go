@@ -0,0 +1,168 @@
+// Package callback receives vendor callbacks such as WeChat message push and DingTalk event
+// subscriptions: it answers URL verification handshakes, checks signatures, rejects replays,
+// decrypts messages and dispatches them to handlers.
+package callback
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// blockSize is the PKCS#7 block size of the vendor scheme, 32 bytes rather than the AES block size.
+const blockSize = 32
+
+var (
+	ErrInvalidSignature = errors.New("callback: invalid signature")
+	ErrDecrypt          = errors.New("callback: message cannot be decrypted")
+	ErrNotEncrypted     = errors.New("callback: encryption is not configured")
+)
+
+// Crypto implements the message encryption shared by WeChat, WeCom and DingTalk callbacks. The
+// signature is the hex SHA-1 of token, timestamp, nonce and ciphertext, sorted and concatenated.
+// Messages are encrypted with AES-256-CBC, the IV being the first 16 bytes of the key, over
+// random(16) + big-endian uint32 length + message + receiveID, padded with PKCS#7 to 32 bytes.
+type Crypto struct {
+	token     string
+	key       []byte
+	receiveID string
+}
+
+// NewCrypto creates a Crypto from the token and the 43 character EncodingAESKey configured on the
+// vendor console. receiveID is the app ID, corp ID or suite key messages are addressed to; it is not
+// checked when empty. With an empty encodingAESKey only signatures are available, for callbacks
+// configured in plaintext mode.
+func NewCrypto(token, encodingAESKey, receiveID string) (*Crypto, error) {
+	if token == "" {
+		return nil, errors.New("callback: token cannot be empty")
+	}
+	c := &Crypto{token: token, receiveID: receiveID}
+	if encodingAESKey == "" {
+		return c, nil
+	}
+
+	if len(encodingAESKey) != 43 {
+		return nil, errors.New("callback: encoding AES key must be 43 characters")
+	}
+	key, err := base64.StdEncoding.DecodeString(encodingAESKey + "=")
+	if err != nil {
+		return nil, fmt.Errorf("callback: decode encoding AES key: %w", err)
+	}
+	c.key = key
+	return c, nil
+}
+
+// Signature signs the given values, e.g. timestamp, nonce and ciphertext, together with the token.
+func (c *Crypto) Signature(values ...string) string {
+	parts := append([]string{c.token}, values...)
+	sort.Strings(parts)
+	sum := sha1.Sum([]byte(strings.Join(parts, "")))
+	return hex.EncodeToString(sum[:])
+}
+
+// VerifySignature checks signature against the given values and the token.
+func (c *Crypto) VerifySignature(signature string, values ...string) error {
+	if subtle.ConstantTimeCompare([]byte(signature), []byte(c.Signature(values...))) != 1 {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// Encrypted reports whether the Crypto has an AES key.
+func (c *Crypto) Encrypted() bool {
+	return c.key != nil
+}
+
+// Encrypt encrypts msg and returns the base64 ciphertext.
+func (c *Crypto) Encrypt(msg []byte) (string, error) {
+	if c.key == nil {
+		return "", ErrNotEncrypted
+	}
+
+	plaintext := make([]byte, 20, 20+len(msg)+len(c.receiveID)+blockSize)
+	if _, err := rand.Read(plaintext[:16]); err != nil {
+		return "", err
+	}
+	binary.BigEndian.PutUint32(plaintext[16:20], uint32(len(msg)))
+	plaintext = append(plaintext, msg...)
+	plaintext = append(plaintext, c.receiveID...)
+	plaintext = pkcs7Pad(plaintext)
+
+	block, err := aes.NewCipher(c.key)
+	if err != nil {
+		return "", err
+	}
+	ciphertext := make([]byte, len(plaintext))
+	cipher.NewCBCEncrypter(block, c.key[:aes.BlockSize]).CryptBlocks(ciphertext, plaintext)
+	return base64.StdEncoding.EncodeToString(ciphertext), nil
+}
+
+// Decrypt decrypts a base64 ciphertext and returns the message. It fails with ErrDecrypt if the
+// message is malformed or addressed to another receiver.
+func (c *Crypto) Decrypt(encrypted string) ([]byte, error) {
+	if c.key == nil {
+		return nil, ErrNotEncrypted
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(encrypted)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDecrypt, err)
+	}
+	if len(ciphertext) == 0 || len(ciphertext)%aes.BlockSize != 0 {
+		return nil, fmt.Errorf("%w: ciphertext is not a multiple of the block size", ErrDecrypt)
+	}
+
+	block, err := aes.NewCipher(c.key)
+	if err != nil {
+		return nil, err
+	}
+	plaintext := make([]byte, len(ciphertext))
+	cipher.NewCBCDecrypter(block, c.key[:aes.BlockSize]).CryptBlocks(plaintext, ciphertext)
+
+	plaintext, err = pkcs7Unpad(plaintext)
+	if err != nil {
+		return nil, err
+	}
+	if len(plaintext) < 20 {
+		return nil, fmt.Errorf("%w: message too short", ErrDecrypt)
+	}
+	length := int(binary.BigEndian.Uint32(plaintext[16:20]))
+	if length > len(plaintext)-20 {
+		return nil, fmt.Errorf("%w: bad message length", ErrDecrypt)
+	}
+	msg, receiveID := plaintext[20:20+length], plaintext[20+length:]
+	if c.receiveID != "" && !bytes.Equal(receiveID, []byte(c.receiveID)) {
+		return nil, fmt.Errorf("%w: message is for receiver %q", ErrDecrypt, receiveID)
+	}
+	return msg, nil
+}
+
+func pkcs7Pad(b []byte) []byte {
+	n := blockSize - len(b)%blockSize
+	return append(b, bytes.Repeat([]byte{byte(n)}, n)...)
+}
+
+func pkcs7Unpad(b []byte) ([]byte, error) {
+	if len(b) == 0 {
+		return nil, fmt.Errorf("%w: empty message", ErrDecrypt)
+	}
+	n := int(b[len(b)-1])
+	if n == 0 || n > blockSize || n > len(b) {
+		return nil, fmt.Errorf("%w: bad padding", ErrDecrypt)
+	}
+	for _, p := range b[len(b)-n:] {
+		if int(p) != n {
+			return nil, fmt.Errorf("%w: bad padding", ErrDecrypt)
+		}
+	}
+	return b[:len(b)-n], nil
+}
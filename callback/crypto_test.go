@@ -0,0 +1,85 @@
+package callback
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// The URL verification sample from the WeCom callback documentation.
+const (
+	sampleToken     = "QDG6eK"
+	sampleAESKey    = "jWmYm7qr5nMoAUwZRjGtBxmz3KA1tkAj3ykkR6q2B2C"
+	sampleReceiveID = "wx5823bf96d3bd56c7"
+	sampleEchoStr   = "P9nAzCzyDtyTWESHep1vC5X9xho/qYX3Zpb4yKa9SKld1DsH3Iyt3tP3zNdtp+4RPcs8TgAE7OaBO+FZXvnaqQ=="
+)
+
+func newSampleCrypto(t *testing.T) *Crypto {
+	c, err := NewCrypto(sampleToken, sampleAESKey, sampleReceiveID)
+	require.NoError(t, err)
+	return c
+}
+
+func TestCrypto_PublishedSample(t *testing.T) {
+	c := newSampleCrypto(t)
+
+	assert.Equal(t, "5c45ff5e21c57e6ad56bac8758b79b1d9ac89fd3", c.Signature("1409659589", "263014780", sampleEchoStr))
+	assert.NoError(t, c.VerifySignature("5c45ff5e21c57e6ad56bac8758b79b1d9ac89fd3", "1409659589", "263014780", sampleEchoStr))
+	assert.ErrorIs(t, c.VerifySignature("5c45ff5e21c57e6ad56bac8758b79b1d9ac89fd3", "1409659589", "263014781", sampleEchoStr), ErrInvalidSignature)
+
+	msg, err := c.Decrypt(sampleEchoStr)
+	require.NoError(t, err)
+	assert.Equal(t, "1616140317555161061", string(msg))
+}
+
+func TestCrypto_RoundTrip(t *testing.T) {
+	c := newSampleCrypto(t)
+
+	for _, msg := range []string{"", "a", strings.Repeat("x", 12), strings.Repeat("y", 64), "<xml><Content>你好</Content></xml>"} {
+		encrypted, err := c.Encrypt([]byte(msg))
+		require.NoError(t, err)
+		decrypted, err := c.Decrypt(encrypted)
+		require.NoError(t, err)
+		assert.Equal(t, msg, string(decrypted))
+	}
+
+	other, err := NewCrypto(sampleToken, sampleAESKey, "wx0000000000000000")
+	require.NoError(t, err)
+	encrypted, err := other.Encrypt([]byte("hello"))
+	require.NoError(t, err)
+	_, err = c.Decrypt(encrypted)
+	assert.ErrorIs(t, err, ErrDecrypt)
+
+	_, err = c.Decrypt("not base64!")
+	assert.ErrorIs(t, err, ErrDecrypt)
+	_, err = c.Decrypt(sampleEchoStr[:24])
+	assert.ErrorIs(t, err, ErrDecrypt)
+}
+
+func TestPKCS7(t *testing.T) {
+	padded := pkcs7Pad(make([]byte, 32))
+	assert.Len(t, padded, 64)
+	unpadded, err := pkcs7Unpad(padded)
+	require.NoError(t, err)
+	assert.Len(t, unpadded, 32)
+
+	_, err = pkcs7Unpad([]byte{1, 2, 3, 0})
+	assert.ErrorIs(t, err, ErrDecrypt)
+	_, err = pkcs7Unpad([]byte{1, 2, 3, 2})
+	assert.ErrorIs(t, err, ErrDecrypt)
+}
+
+func TestNewCrypto_PlaintextMode(t *testing.T) {
+	c, err := NewCrypto("token", "", "")
+	require.NoError(t, err)
+	assert.False(t, c.Encrypted())
+	_, err = c.Encrypt([]byte("x"))
+	assert.ErrorIs(t, err, ErrNotEncrypted)
+
+	_, err = NewCrypto("token", "short", "")
+	assert.Error(t, err)
+	_, err = NewCrypto("", sampleAESKey, "")
+	assert.Error(t, err)
+}
@@ -0,0 +1,130 @@
+package callback
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+)
+
+// Format describes how a vendor wraps encrypted messages and how event types are read from them.
+type Format struct {
+	Name        string
+	ContentType string
+	// Unwrap returns the ciphertext of an encrypted body, or "" if the body is not encrypted.
+	Unwrap func(body []byte) (string, error)
+	// Wrap builds the body of an encrypted reply.
+	Wrap func(reply EncryptedReply) ([]byte, error)
+	// ParseEvent reads the type and ID of a decrypted message.
+	ParseEvent func(msg []byte) (*Event, error)
+	// HandshakeEvent is the type of URL verification events sent as regular callbacks. They are
+	// answered with Ack and not dispatched.
+	HandshakeEvent string
+	// Ack is the reply to callbacks the handler has nothing to reply to.
+	Ack []byte
+	// EncryptAck reports whether Ack must be encrypted like any other reply.
+	EncryptAck bool
+}
+
+// EncryptedReply holds the fields of an encrypted reply.
+type EncryptedReply struct {
+	Encrypt   string
+	Signature string
+	Timestamp string
+	Nonce     string
+}
+
+// WeChatXML is the XML format of WeChat Official Account, Mini Program and WeCom callbacks. Event
+// messages are typed by their Event field, e.g. subscribe, other messages by MsgType, e.g. text.
+var WeChatXML = Format{
+	Name:        "xml",
+	ContentType: "application/xml; charset=utf-8",
+	Unwrap: func(body []byte) (string, error) {
+		var envelope struct {
+			Encrypt string `xml:"Encrypt"`
+		}
+		if err := xml.Unmarshal(body, &envelope); err != nil {
+			return "", fmt.Errorf("callback: decode xml envelope: %w", err)
+		}
+		return envelope.Encrypt, nil
+	},
+	Wrap: func(reply EncryptedReply) ([]byte, error) {
+		type cdata struct {
+			Value string `xml:",cdata"`
+		}
+		return xml.Marshal(struct {
+			XMLName      xml.Name `xml:"xml"`
+			Encrypt      cdata    `xml:"Encrypt"`
+			MsgSignature cdata    `xml:"MsgSignature"`
+			TimeStamp    string   `xml:"TimeStamp"`
+			Nonce        cdata    `xml:"Nonce"`
+		}{
+			Encrypt:      cdata{reply.Encrypt},
+			MsgSignature: cdata{reply.Signature},
+			TimeStamp:    reply.Timestamp,
+			Nonce:        cdata{reply.Nonce},
+		})
+	},
+	ParseEvent: func(msg []byte) (*Event, error) {
+		var m struct {
+			MsgType      string `xml:"MsgType"`
+			Event        string `xml:"Event"`
+			MsgID        string `xml:"MsgId"`
+			FromUserName string `xml:"FromUserName"`
+			CreateTime   string `xml:"CreateTime"`
+		}
+		if err := xml.Unmarshal(msg, &m); err != nil {
+			return nil, fmt.Errorf("callback: decode xml message: %w", err)
+		}
+		event := &Event{Type: m.MsgType, ID: m.MsgID}
+		if m.MsgType == "event" {
+			event.Type = m.Event
+		}
+		if event.ID == "" && m.FromUserName != "" {
+			// Events carry no MsgId, WeChat suggests deduplicating them by sender and creation time.
+			event.ID = m.FromUserName + "#" + m.CreateTime + "#" + event.Type
+		}
+		return event, nil
+	},
+	Ack: []byte("success"),
+}
+
+// DingTalkJSON is the JSON format of DingTalk event subscriptions. Events are typed by their
+// EventType field, and URL verification arrives as a check_url event.
+var DingTalkJSON = Format{
+	Name:        "json",
+	ContentType: "application/json; charset=utf-8",
+	Unwrap: func(body []byte) (string, error) {
+		var envelope struct {
+			Encrypt string `json:"encrypt"`
+		}
+		if err := json.Unmarshal(body, &envelope); err != nil {
+			return "", fmt.Errorf("callback: decode json envelope: %w", err)
+		}
+		return envelope.Encrypt, nil
+	},
+	Wrap: func(reply EncryptedReply) ([]byte, error) {
+		return json.Marshal(map[string]string{
+			"msg_signature": reply.Signature,
+			"timeStamp":     reply.Timestamp,
+			"nonce":         reply.Nonce,
+			"encrypt":       reply.Encrypt,
+		})
+	},
+	ParseEvent: func(msg []byte) (*Event, error) {
+		var m struct {
+			EventType string `json:"EventType"`
+			EventID   string `json:"EventId"`
+		}
+		if err := json.Unmarshal(msg, &m); err != nil {
+			return nil, fmt.Errorf("callback: decode json message: %w", err)
+		}
+		if m.EventType == "" {
+			return nil, errors.New("callback: message has no EventType")
+		}
+		return &Event{Type: m.EventType, ID: m.EventID}, nil
+	},
+	HandshakeEvent: "check_url",
+	Ack:            []byte("success"),
+	EncryptAck:     true,
+}
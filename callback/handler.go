@@ -0,0 +1,376 @@
+package callback
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Lumiaqian/go-sdk-core/cache"
+	"github.com/Lumiaqian/go-sdk-core/log"
+)
+
+const (
+	defaultTimestampWindow = 5 * time.Minute
+	defaultMaxBodyBytes    = 1 << 20
+)
+
+var (
+	ErrMissingSignature = errors.New("callback: request is not signed")
+	ErrStaleTimestamp   = errors.New("callback: timestamp outside the allowed window")
+	ErrReplay           = errors.New("callback: nonce has already been used")
+)
+
+// Event is a decrypted callback message.
+type Event struct {
+	// Type is the event or message type, e.g. subscribe, text or user_add_org.
+	Type string
+	// ID identifies the message across vendor retries. It is empty if the vendor sends none.
+	ID string
+	// Raw is the decrypted message in the vendor format.
+	Raw []byte
+	// Format is the name of the Format the message arrived in, xml or json.
+	Format string
+}
+
+// Dispatcher handles decrypted events. A non-nil reply is sent back, encrypted if the callback was;
+// a nil reply sends the Format acknowledgement. An error answers with status 500 so the vendor retries.
+type Dispatcher interface {
+	Dispatch(ctx context.Context, event *Event) ([]byte, error)
+}
+
+type HandlerFunc func(ctx context.Context, event *Event) ([]byte, error)
+
+// Mux is a Dispatcher that routes events by type. Events without a handler are acknowledged.
+type Mux struct {
+	mu       sync.RWMutex
+	handlers map[string]HandlerFunc
+	fallback HandlerFunc
+}
+
+func NewMux() *Mux {
+	return &Mux{
+		handlers: make(map[string]HandlerFunc),
+	}
+}
+
+// Handle registers fn for events of the given type.
+func (m *Mux) Handle(eventType string, fn HandlerFunc) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.handlers[eventType] = fn
+}
+
+// HandleDefault registers fn for events no other handler is registered for.
+func (m *Mux) HandleDefault(fn HandlerFunc) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.fallback = fn
+}
+
+func (m *Mux) Dispatch(ctx context.Context, event *Event) ([]byte, error) {
+	m.mu.RLock()
+	fn, ok := m.handlers[event.Type]
+	if !ok {
+		fn = m.fallback
+	}
+	m.mu.RUnlock()
+
+	if fn == nil {
+		return nil, nil
+	}
+	return fn(ctx, event)
+}
+
+// Handler is an http.Handler for vendor callbacks. GET requests with an echostr parameter are
+// answered as URL verification handshakes; POST requests are verified, decrypted and dispatched.
+type Handler struct {
+	crypto          *Crypto
+	format          Format
+	dispatcher      Dispatcher
+	replayCache     cache.Cache
+	timestampWindow time.Duration
+	maxBodyBytes    int64
+	logger          *log.LogHelper
+	now             func() time.Time
+}
+
+type HandlerOption func(*Handler)
+
+// WithReplayCache records the timestamp and nonce of every callback in c and rejects callbacks
+// that reuse them. Share the cache between instances behind a load balancer.
+func WithReplayCache(c cache.Cache) HandlerOption {
+	return func(h *Handler) {
+		h.replayCache = c
+	}
+}
+
+// WithTimestampWindow is how far the callback timestamp may be from the local clock, 5 minutes by default.
+func WithTimestampWindow(window time.Duration) HandlerOption {
+	return func(h *Handler) {
+		h.timestampWindow = window
+	}
+}
+
+// WithMaxBodyBytes limits the size of callback bodies, 1 MiB by default.
+func WithMaxBodyBytes(n int64) HandlerOption {
+	return func(h *Handler) {
+		h.maxBodyBytes = n
+	}
+}
+
+func WithHandlerLogger(logger log.Logger) HandlerOption {
+	return func(h *Handler) {
+		if logger != nil {
+			h.logger = log.NewLogHelper(logger)
+		}
+	}
+}
+
+func NewHandler(crypto *Crypto, format Format, dispatcher Dispatcher, opts ...HandlerOption) *Handler {
+	h := &Handler{
+		crypto:          crypto,
+		format:          format,
+		dispatcher:      dispatcher,
+		timestampWindow: defaultTimestampWindow,
+		maxBodyBytes:    defaultMaxBodyBytes,
+		now:             time.Now,
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+// callbackError carries the HTTP status a failure is answered with.
+type callbackError struct {
+	status int
+	err    error
+}
+
+func (e *callbackError) Error() string { return e.err.Error() }
+func (e *callbackError) Unwrap() error { return e.err }
+
+func fail(status int, err error) error {
+	return &callbackError{status: status, err: err}
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	const plainText = "text/plain; charset=utf-8"
+	var body []byte
+	var err error
+	contentType := plainText
+	switch r.Method {
+	case http.MethodGet:
+		body, err = h.handshake(r)
+	case http.MethodPost:
+		var ack bool
+		body, ack, err = h.callback(r)
+		if !ack {
+			contentType = h.format.ContentType
+		}
+	default:
+		err = fail(http.StatusMethodNotAllowed, fmt.Errorf("callback: method %s not allowed", r.Method))
+	}
+
+	if err != nil {
+		status := http.StatusInternalServerError
+		var cbErr *callbackError
+		if errors.As(err, &cbErr) {
+			status = cbErr.status
+		}
+		h.logError(r.Context(), "callback_failed", err)
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Write(body)
+}
+
+// handshake answers URL verification: the plaintext of an encrypted echostr, or echostr itself in
+// plaintext mode.
+func (h *Handler) handshake(r *http.Request) ([]byte, error) {
+	q := r.URL.Query()
+	echo := q.Get("echostr")
+	if echo == "" {
+		return nil, fail(http.StatusBadRequest, errors.New("callback: verification request has no echostr"))
+	}
+
+	if signature := q.Get("msg_signature"); signature != "" {
+		if err := h.crypto.VerifySignature(signature, q.Get("timestamp"), q.Get("nonce"), echo); err != nil {
+			return nil, fail(http.StatusForbidden, err)
+		}
+		plaintext, err := h.crypto.Decrypt(echo)
+		if err != nil {
+			return nil, fail(http.StatusBadRequest, err)
+		}
+		return plaintext, nil
+	}
+	if signature := q.Get("signature"); signature != "" {
+		if err := h.crypto.VerifySignature(signature, q.Get("timestamp"), q.Get("nonce")); err != nil {
+			return nil, fail(http.StatusForbidden, err)
+		}
+		return []byte(echo), nil
+	}
+	return nil, fail(http.StatusForbidden, ErrMissingSignature)
+}
+
+// callback handles a callback and returns the response body, reporting whether it is a plain acknowledgement.
+func (h *Handler) callback(r *http.Request) ([]byte, bool, error) {
+	ctx := r.Context()
+	q := r.URL.Query()
+	timestamp, nonce := q.Get("timestamp"), q.Get("nonce")
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, h.maxBodyBytes+1))
+	if err != nil {
+		return nil, false, fail(http.StatusBadRequest, err)
+	}
+	if int64(len(body)) > h.maxBodyBytes {
+		return nil, false, fail(http.StatusRequestEntityTooLarge, errors.New("callback: body too large"))
+	}
+
+	msg, encrypted, err := h.open(q.Get("msg_signature"), q.Get("signature"), timestamp, nonce, body)
+	if err != nil {
+		return nil, false, err
+	}
+	if err := h.checkTimestamp(timestamp); err != nil {
+		return nil, false, fail(http.StatusForbidden, err)
+	}
+	replayKey, err := h.checkReplay(ctx, timestamp, nonce)
+	if err != nil {
+		return nil, false, err
+	}
+
+	event, err := h.format.ParseEvent(msg)
+	if err != nil {
+		return nil, false, fail(http.StatusBadRequest, err)
+	}
+	event.Raw = msg
+	event.Format = h.format.Name
+
+	var reply []byte
+	if h.format.HandshakeEvent == "" || event.Type != h.format.HandshakeEvent {
+		reply, err = h.dispatcher.Dispatch(ctx, event)
+		if err != nil {
+			// Let the vendor retry with the same nonce.
+			h.forgetReplay(ctx, replayKey)
+			return nil, false, fmt.Errorf("callback: handle %s event: %w", event.Type, err)
+		}
+	}
+
+	if reply == nil {
+		if !h.format.EncryptAck || !encrypted {
+			return h.format.Ack, true, nil
+		}
+		reply = h.format.Ack
+	}
+	if !encrypted {
+		return reply, false, nil
+	}
+	sealed, err := h.seal(reply)
+	return sealed, false, err
+}
+
+// open verifies the signature and returns the message, decrypted if the body is encrypted.
+func (h *Handler) open(msgSignature, signature, timestamp, nonce string, body []byte) ([]byte, bool, error) {
+	if msgSignature != "" {
+		ciphertext, err := h.format.Unwrap(body)
+		if err != nil {
+			return nil, false, fail(http.StatusBadRequest, err)
+		}
+		if ciphertext == "" {
+			return nil, false, fail(http.StatusBadRequest, errors.New("callback: signed body has no ciphertext"))
+		}
+		if err := h.crypto.VerifySignature(msgSignature, timestamp, nonce, ciphertext); err != nil {
+			return nil, false, fail(http.StatusForbidden, err)
+		}
+		msg, err := h.crypto.Decrypt(ciphertext)
+		if err != nil {
+			return nil, false, fail(http.StatusBadRequest, err)
+		}
+		return msg, true, nil
+	}
+
+	// Plaintext mode only signs the timestamp and nonce, refuse it once encryption is configured.
+	if signature == "" || h.crypto.Encrypted() {
+		return nil, false, fail(http.StatusForbidden, ErrMissingSignature)
+	}
+	if err := h.crypto.VerifySignature(signature, timestamp, nonce); err != nil {
+		return nil, false, fail(http.StatusForbidden, err)
+	}
+	return body, false, nil
+}
+
+func (h *Handler) checkTimestamp(timestamp string) error {
+	value, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: bad timestamp %q", ErrStaleTimestamp, timestamp)
+	}
+	// DingTalk sends milliseconds, WeChat seconds.
+	t := time.Unix(value, 0)
+	if value > 1e11 {
+		t = time.UnixMilli(value)
+	}
+	if d := h.now().Sub(t); d > h.timestampWindow || d < -h.timestampWindow {
+		return ErrStaleTimestamp
+	}
+	return nil
+}
+
+func (h *Handler) checkReplay(ctx context.Context, timestamp, nonce string) (string, error) {
+	if h.replayCache == nil {
+		return "", nil
+	}
+	key := "callback_nonce:" + timestamp + ":" + nonce
+	// Keep nonces for both sides of the window, a timestamp can be that far in the future.
+	ok, err := cache.SetNX(ctx, h.replayCache, key, "1", 2*h.timestampWindow)
+	if err != nil {
+		return "", fmt.Errorf("callback: record nonce: %w", err)
+	}
+	if !ok {
+		return "", fail(http.StatusForbidden, ErrReplay)
+	}
+	return key, nil
+}
+
+func (h *Handler) forgetReplay(ctx context.Context, key string) {
+	if key == "" {
+		return
+	}
+	if err := h.replayCache.Delete(ctx, key); err != nil {
+		h.logError(ctx, "callback_forget_nonce", err)
+	}
+}
+
+func (h *Handler) seal(reply []byte) ([]byte, error) {
+	ciphertext, err := h.crypto.Encrypt(reply)
+	if err != nil {
+		return nil, err
+	}
+	timestamp := strconv.FormatInt(h.now().Unix(), 10)
+	nonce := randomNonce()
+	return h.format.Wrap(EncryptedReply{
+		Encrypt:   ciphertext,
+		Signature: h.crypto.Signature(timestamp, nonce, ciphertext),
+		Timestamp: timestamp,
+		Nonce:     nonce,
+	})
+}
+
+func (h *Handler) logError(ctx context.Context, msg string, err error) {
+	if h.logger != nil {
+		h.logger.Error(ctx, "msg", msg, "error", err)
+	}
+}
+
+func randomNonce() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
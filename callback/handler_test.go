@@ -0,0 +1,213 @@
+package callback
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Lumiaqian/go-sdk-core/cache"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// signedRequest builds an encrypted callback the way the vendor sends it.
+func signedRequest(t *testing.T, c *Crypto, format Format, timestamp, nonce string, msg string) *http.Request {
+	ciphertext, err := c.Encrypt([]byte(msg))
+	require.NoError(t, err)
+
+	var body []byte
+	if format.Name == "xml" {
+		body = []byte("<xml><ToUserName><![CDATA[wx5823bf96d3bd56c7]]></ToUserName><Encrypt><![CDATA[" + ciphertext + "]]></Encrypt></xml>")
+	} else {
+		body, _ = json.Marshal(map[string]string{"encrypt": ciphertext})
+	}
+
+	q := url.Values{
+		"msg_signature": {c.Signature(timestamp, nonce, ciphertext)},
+		"timestamp":     {timestamp},
+		"nonce":         {nonce},
+	}
+	return httptest.NewRequest(http.MethodPost, "/callback?"+q.Encode(), strings.NewReader(string(body)))
+}
+
+func now() string {
+	return strconv.FormatInt(time.Now().Unix(), 10)
+}
+
+func serve(h http.Handler, req *http.Request) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+const textMessage = `<xml><ToUserName><![CDATA[toUser]]></ToUserName><FromUserName><![CDATA[fromUser]]></FromUserName>` +
+	`<CreateTime>1348831860</CreateTime><MsgType><![CDATA[text]]></MsgType><Content><![CDATA[hello]]></Content><MsgId>1234567890123456</MsgId></xml>`
+
+func TestHandler_WeChatXML(t *testing.T) {
+	c := newSampleCrypto(t)
+	mux := NewMux()
+	var got *Event
+	mux.Handle("text", func(ctx context.Context, event *Event) ([]byte, error) {
+		got = event
+		return []byte("<xml><MsgType><![CDATA[text]]></MsgType><Content><![CDATA[hi]]></Content></xml>"), nil
+	})
+	mux.Handle("subscribe", func(ctx context.Context, event *Event) ([]byte, error) {
+		got = event
+		return nil, nil
+	})
+	h := NewHandler(c, WeChatXML, mux)
+
+	rec := serve(h, signedRequest(t, c, WeChatXML, now(), "n1", textMessage))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "text", got.Type)
+	assert.Equal(t, "1234567890123456", got.ID)
+	assert.Equal(t, "xml", got.Format)
+	assert.Equal(t, textMessage, string(got.Raw))
+
+	// The reply is encrypted and signed.
+	var reply struct {
+		Encrypt      string `xml:"Encrypt"`
+		MsgSignature string `xml:"MsgSignature"`
+		TimeStamp    string `xml:"TimeStamp"`
+		Nonce        string `xml:"Nonce"`
+	}
+	require.NoError(t, xml.Unmarshal(rec.Body.Bytes(), &reply))
+	assert.NoError(t, c.VerifySignature(reply.MsgSignature, reply.TimeStamp, reply.Nonce, reply.Encrypt))
+	plaintext, err := c.Decrypt(reply.Encrypt)
+	require.NoError(t, err)
+	assert.Contains(t, string(plaintext), "<Content><![CDATA[hi]]></Content>")
+	assert.Equal(t, WeChatXML.ContentType, rec.Header().Get("Content-Type"))
+
+	// Events are typed by their Event field and acknowledged in plaintext.
+	subscribe := `<xml><FromUserName>user</FromUserName><CreateTime>123</CreateTime><MsgType>event</MsgType><Event>subscribe</Event></xml>`
+	rec = serve(h, signedRequest(t, c, WeChatXML, now(), "n2", subscribe))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "success", rec.Body.String())
+	assert.Equal(t, "subscribe", got.Type)
+	assert.Equal(t, "user#123#subscribe", got.ID)
+}
+
+func TestHandler_Handshake(t *testing.T) {
+	h := NewHandler(newSampleCrypto(t), WeChatXML, NewMux())
+
+	q := url.Values{
+		"msg_signature": {"5c45ff5e21c57e6ad56bac8758b79b1d9ac89fd3"},
+		"timestamp":     {"1409659589"},
+		"nonce":         {"263014780"},
+		"echostr":       {sampleEchoStr},
+	}
+	rec := serve(h, httptest.NewRequest(http.MethodGet, "/callback?"+q.Encode(), nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "1616140317555161061", rec.Body.String())
+
+	q.Set("nonce", "1")
+	rec = serve(h, httptest.NewRequest(http.MethodGet, "/callback?"+q.Encode(), nil))
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	// Plaintext mode signs timestamp and nonce only and echoes echostr.
+	plain, err := NewCrypto("token", "", "")
+	require.NoError(t, err)
+	h = NewHandler(plain, WeChatXML, NewMux())
+	q = url.Values{
+		"signature": {plain.Signature("1409659589", "263014780")},
+		"timestamp": {"1409659589"},
+		"nonce":     {"263014780"},
+		"echostr":   {"echo"},
+	}
+	rec = serve(h, httptest.NewRequest(http.MethodGet, "/callback?"+q.Encode(), nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "echo", rec.Body.String())
+}
+
+func TestHandler_DingTalkJSON(t *testing.T) {
+	c, err := NewCrypto("dingtoken", sampleAESKey, "dingcorpid")
+	require.NoError(t, err)
+	mux := NewMux()
+	var dispatched []string
+	mux.HandleDefault(func(ctx context.Context, event *Event) ([]byte, error) {
+		dispatched = append(dispatched, event.Type)
+		return nil, nil
+	})
+	h := NewHandler(c, DingTalkJSON, mux)
+	millis := strconv.FormatInt(time.Now().UnixMilli(), 10)
+
+	for i, msg := range []string{`{"EventType":"check_url"}`, `{"EventType":"user_add_org","UserId":["u1"],"CorpId":"dingcorpid"}`} {
+		rec := serve(h, signedRequest(t, c, DingTalkJSON, millis, "nonce"+strconv.Itoa(i), msg))
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		// DingTalk expects an encrypted success for every callback, including the handshake.
+		var reply map[string]string
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &reply))
+		assert.NoError(t, c.VerifySignature(reply["msg_signature"], reply["timeStamp"], reply["nonce"], reply["encrypt"]))
+		plaintext, err := c.Decrypt(reply["encrypt"])
+		require.NoError(t, err)
+		assert.Equal(t, "success", string(plaintext))
+	}
+	assert.Equal(t, []string{"user_add_org"}, dispatched)
+}
+
+func TestHandler_Rejections(t *testing.T) {
+	c := newSampleCrypto(t)
+	failures := 0
+	mux := NewMux()
+	mux.HandleDefault(func(ctx context.Context, event *Event) ([]byte, error) {
+		if failures > 0 {
+			failures--
+			return nil, errors.New("database unavailable")
+		}
+		return nil, nil
+	})
+	h := NewHandler(c, WeChatXML, mux, WithReplayCache(cache.NewMemcache(0, time.Minute)))
+
+	// Replays are rejected.
+	timestamp := now()
+	assert.Equal(t, http.StatusOK, serve(h, signedRequest(t, c, WeChatXML, timestamp, "n1", textMessage)).Code)
+	assert.Equal(t, http.StatusForbidden, serve(h, signedRequest(t, c, WeChatXML, timestamp, "n1", textMessage)).Code)
+
+	// A failed callback can be retried with the same nonce.
+	failures = 1
+	assert.Equal(t, http.StatusInternalServerError, serve(h, signedRequest(t, c, WeChatXML, timestamp, "n2", textMessage)).Code)
+	assert.Equal(t, http.StatusOK, serve(h, signedRequest(t, c, WeChatXML, timestamp, "n2", textMessage)).Code)
+
+	// Stale timestamps.
+	stale := strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+	assert.Equal(t, http.StatusForbidden, serve(h, signedRequest(t, c, WeChatXML, stale, "n3", textMessage)).Code)
+
+	// Tampered signatures.
+	req := signedRequest(t, c, WeChatXML, now(), "n4", textMessage)
+	q := req.URL.Query()
+	q.Set("nonce", "n5")
+	req.URL.RawQuery = q.Encode()
+	assert.Equal(t, http.StatusForbidden, serve(h, req).Code)
+
+	// Unsigned and plaintext callbacks when encryption is configured.
+	req = httptest.NewRequest(http.MethodPost, "/callback?signature="+c.Signature(now(), "n6")+"&timestamp="+now()+"&nonce=n6", strings.NewReader(textMessage))
+	assert.Equal(t, http.StatusForbidden, serve(h, req).Code)
+
+	assert.Equal(t, http.StatusMethodNotAllowed, serve(h, httptest.NewRequest(http.MethodPut, "/callback", nil)).Code)
+}
+
+func TestHandler_PlaintextMode(t *testing.T) {
+	c, err := NewCrypto("token", "", "")
+	require.NoError(t, err)
+	mux := NewMux()
+	mux.Handle("text", func(ctx context.Context, event *Event) ([]byte, error) {
+		return []byte("<xml><Content>hi</Content></xml>"), nil
+	})
+	h := NewHandler(c, WeChatXML, mux)
+
+	timestamp := now()
+	req := httptest.NewRequest(http.MethodPost, "/callback?signature="+c.Signature(timestamp, "n1")+"&timestamp="+timestamp+"&nonce=n1", strings.NewReader(textMessage))
+	rec := serve(h, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "<xml><Content>hi</Content></xml>", rec.Body.String())
+}
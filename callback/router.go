@@ -0,0 +1,397 @@
+package callback
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/Lumiaqian/go-sdk-core/cache"
+	"github.com/Lumiaqian/go-sdk-core/log"
+)
+
+var (
+	ErrQueueFull    = errors.New("callback: event queue is full")
+	ErrRouterClosed = errors.New("callback: router is closed")
+	// ErrEventInProgress answers a callback whose event is still being processed synchronously, so
+	// that the vendor retries it instead of the event counting as delivered.
+	ErrEventInProgress = errors.New("callback: event is being processed")
+)
+
+// Deduplication entry values. Synchronous events are pending while their handler runs and done
+// once it has succeeded.
+const (
+	dedupPending = "pending"
+	dedupDone    = "done"
+)
+
+// EventHandlerFunc processes an event. Unlike a HandlerFunc it cannot reply, so it can run after
+// the callback has been acknowledged.
+type EventHandlerFunc func(ctx context.Context, event *Event) error
+
+// FailureFunc receives an asynchronously processed event whose handler still failed after all
+// retries, e.g. to store it in a dead-letter queue.
+type FailureFunc func(ctx context.Context, event *Event, err error)
+
+// Router is a Dispatcher that decodes events into registered Go types, drops events it has already
+// processed and optionally processes them on a worker pool, acknowledging callbacks immediately.
+type Router struct {
+	mu       sync.RWMutex
+	handlers map[string]EventHandlerFunc
+	fallback EventHandlerFunc
+
+	dedup          cache.Cache
+	dedupTTL       time.Duration
+	workers        int
+	queue          chan job
+	retries        int
+	retryBackoff   time.Duration
+	onFailure      FailureFunc
+	handlerTimeout time.Duration
+	logger         *log.LogHelper
+
+	// queueMu guards sending on queue against Close closing it.
+	queueMu sync.RWMutex
+	closed  bool
+	// done is closed by Close to cut retry backoffs short.
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+type job struct {
+	ctx      context.Context
+	event    *Event
+	fn       EventHandlerFunc
+	dedupKey string
+}
+
+type RouterOption func(*Router)
+
+// WithDeduplication records processed event IDs in c for ttl and drops events seen before. Events
+// without an ID are identified by a hash of their content.
+//
+// Without WithAsync an event counts as processed only once its handler succeeds; a duplicate that
+// arrives while the handler runs is answered with ErrEventInProgress. That claim lasts for the
+// handler timeout, or ttl without one, so a process that dies mid-event blocks it no longer.
+func WithDeduplication(c cache.Cache, ttl time.Duration) RouterOption {
+	return func(r *Router) {
+		r.dedup = c
+		r.dedupTTL = ttl
+	}
+}
+
+// WithAsync processes events on workers goroutines. Up to queueSize events wait for a worker;
+// callbacks arriving when the queue is full are answered with an error so the vendor retries them.
+//
+// Queued events are acknowledged before they are processed, so delivery is at-most-once: the vendor
+// does not retry an event whose handler fails. Use WithRetry and WithFailureHandler to handle that.
+func WithAsync(workers, queueSize int) RouterOption {
+	return func(r *Router) {
+		r.workers = workers
+		r.queue = make(chan job, queueSize)
+	}
+}
+
+// WithRetry retries a failing asynchronous handler up to retries times, waiting backoff before the
+// first retry and doubling it for every further one. The worker is busy while it waits; Close stops
+// the waiting and hands the event to the failure handler.
+func WithRetry(retries int, backoff time.Duration) RouterOption {
+	return func(r *Router) {
+		r.retries = retries
+		r.retryBackoff = backoff
+	}
+}
+
+// WithFailureHandler calls fn for asynchronous events that still fail after all retries. Without it
+// such events are only logged.
+func WithFailureHandler(fn FailureFunc) RouterOption {
+	return func(r *Router) {
+		r.onFailure = fn
+	}
+}
+
+// WithHandlerTimeout bounds the context handlers run with.
+func WithHandlerTimeout(timeout time.Duration) RouterOption {
+	return func(r *Router) {
+		r.handlerTimeout = timeout
+	}
+}
+
+func WithRouterLogger(logger log.Logger) RouterOption {
+	return func(r *Router) {
+		if logger != nil {
+			r.logger = log.NewLogHelper(logger)
+		}
+	}
+}
+
+// NewRouter creates a Router. With WithAsync, call Close to stop the workers.
+func NewRouter(opts ...RouterOption) *Router {
+	r := &Router{
+		handlers: make(map[string]EventHandlerFunc),
+		done:     make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	for i := 0; i < r.workers; i++ {
+		r.wg.Add(1)
+		go r.work()
+	}
+	return r
+}
+
+// Handle registers fn for events of the given type.
+func (r *Router) Handle(eventType string, fn EventHandlerFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.handlers[eventType] = fn
+}
+
+// HandleDefault registers fn for events no other handler is registered for.
+func (r *Router) HandleDefault(fn EventHandlerFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.fallback = fn
+}
+
+// On registers fn for events of the given type, with the message decoded into a new T from the XML
+// or JSON format it arrived in.
+func On[T any](r *Router, eventType string, fn func(ctx context.Context, event *Event, payload *T) error) {
+	r.Handle(eventType, func(ctx context.Context, event *Event) error {
+		payload := new(T)
+		if err := decodeEvent(event, payload); err != nil {
+			return err
+		}
+		return fn(ctx, event, payload)
+	})
+}
+
+func decodeEvent(event *Event, v any) error {
+	var err error
+	switch event.Format {
+	case WeChatXML.Name:
+		err = xml.Unmarshal(event.Raw, v)
+	case DingTalkJSON.Name:
+		err = json.Unmarshal(event.Raw, v)
+	default:
+		return fmt.Errorf("callback: cannot decode %q events", event.Format)
+	}
+	if err != nil {
+		return fmt.Errorf("callback: decode %s event: %w", event.Type, err)
+	}
+	return nil
+}
+
+func (r *Router) Dispatch(ctx context.Context, event *Event) ([]byte, error) {
+	r.mu.RLock()
+	fn, ok := r.handlers[event.Type]
+	if !ok {
+		fn = r.fallback
+	}
+	r.mu.RUnlock()
+	if fn == nil {
+		r.log(ctx, log.DEBUG, "callback_event_unhandled", event, nil)
+		return nil, nil
+	}
+
+	if r.queue == nil {
+		return nil, r.dispatchSync(ctx, event, fn)
+	}
+
+	// Queued events are acknowledged right away, so they count as processed from the start.
+	dedupKey, fresh, err := r.claim(ctx, event, dedupDone, r.dedupTTL)
+	if err != nil {
+		return nil, err
+	}
+	if !fresh {
+		r.log(ctx, log.DEBUG, "callback_event_duplicate", event, nil)
+		return nil, nil
+	}
+
+	// The callback is answered before the handler runs, keep its values but not its cancellation.
+	j := job{ctx: context.WithoutCancel(ctx), event: event, fn: fn, dedupKey: dedupKey}
+	r.queueMu.RLock()
+	defer r.queueMu.RUnlock()
+	if r.closed {
+		r.release(ctx, dedupKey)
+		return nil, ErrRouterClosed
+	}
+	select {
+	case r.queue <- j:
+		return nil, nil
+	default:
+		r.release(ctx, dedupKey)
+		return nil, ErrQueueFull
+	}
+}
+
+// dispatchSync runs the handler of an event while the callback waits. The event is marked done
+// only after the handler succeeds, a failed one is released so that the vendor's retry runs it.
+func (r *Router) dispatchSync(ctx context.Context, event *Event, fn EventHandlerFunc) error {
+	pendingTTL := r.dedupTTL
+	if r.handlerTimeout > 0 {
+		pendingTTL = r.handlerTimeout
+	}
+	dedupKey, fresh, err := r.claim(ctx, event, dedupPending, pendingTTL)
+	if err != nil {
+		return err
+	}
+	if !fresh {
+		state, err := r.dedup.Get(ctx, dedupKey)
+		if err != nil && !errors.Is(err, cache.ErrNotFound) {
+			return fmt.Errorf("callback: read event state: %w", err)
+		}
+		if state == dedupPending {
+			r.log(ctx, log.DEBUG, "callback_event_in_progress", event, nil)
+			return ErrEventInProgress
+		}
+		r.log(ctx, log.DEBUG, "callback_event_duplicate", event, nil)
+		return nil
+	}
+
+	if err := r.run(ctx, job{ctx: ctx, event: event, fn: fn, dedupKey: dedupKey}); err != nil {
+		// The vendor retries the failed callback, which must not be dropped as a duplicate.
+		r.release(ctx, dedupKey)
+		return err
+	}
+	if dedupKey != "" {
+		if err := r.dedup.Set(context.WithoutCancel(ctx), dedupKey, dedupDone, r.dedupTTL); err != nil {
+			r.log(ctx, log.WARN, "callback_event_record_failed", event, err)
+		}
+	}
+	return nil
+}
+
+// Close stops queueing events and waits until queued events are processed or ctx is done. Events
+// waiting to be retried are not retried again.
+func (r *Router) Close(ctx context.Context) error {
+	r.queueMu.Lock()
+	if !r.closed {
+		if r.queue != nil {
+			close(r.queue)
+		}
+		close(r.done)
+	}
+	r.closed = true
+	r.queueMu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		r.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (r *Router) work() {
+	defer r.wg.Done()
+	for j := range r.queue {
+		r.runAsync(j)
+	}
+}
+
+// runAsync runs an acknowledged event with retries. An event that keeps failing goes to the failure
+// handler and is released from deduplication, so that it can be processed again if it is replayed.
+func (r *Router) runAsync(j job) {
+	backoff := r.retryBackoff
+	err := r.run(j.ctx, j)
+retry:
+	for attempt := 0; err != nil && attempt < r.retries; attempt++ {
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-r.done:
+			timer.Stop()
+			break retry
+		}
+		backoff *= 2
+		err = r.run(j.ctx, j)
+	}
+	if err == nil {
+		return
+	}
+
+	r.release(j.ctx, j.dedupKey)
+	if r.onFailure != nil {
+		r.onFailure(j.ctx, j.event, err)
+	} else {
+		r.log(j.ctx, log.ERROR, "callback_event_lost", j.event, err)
+	}
+}
+
+// run calls the handler, turning panics into errors.
+func (r *Router) run(ctx context.Context, j job) (err error) {
+	if r.handlerTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.handlerTimeout)
+		defer cancel()
+	}
+
+	defer func() {
+		if v := recover(); v != nil {
+			err = fmt.Errorf("callback: handler panicked: %v", v)
+			if r.logger != nil {
+				r.logger.Error(ctx, "msg", "callback_handler_panic", "type", j.event.Type, "id", j.event.ID,
+					"panic", v, "stack", string(debug.Stack()))
+			}
+		} else if err != nil {
+			r.log(ctx, log.ERROR, "callback_handler_failed", j.event, err)
+		}
+	}()
+	return j.fn(ctx, j.event)
+}
+
+// claim records the event for deduplication with value and reports whether it is seen for the
+// first time.
+func (r *Router) claim(ctx context.Context, event *Event, value string, ttl time.Duration) (string, bool, error) {
+	if r.dedup == nil {
+		return "", true, nil
+	}
+
+	id := event.ID
+	if id == "" {
+		sum := sha256.Sum256(event.Raw)
+		id = hex.EncodeToString(sum[:])
+	}
+	key := "callback_event:" + event.Type + ":" + id
+	ok, err := cache.SetNX(ctx, r.dedup, key, value, ttl)
+	if err != nil {
+		return "", false, fmt.Errorf("callback: record event: %w", err)
+	}
+	return key, ok, nil
+}
+
+func (r *Router) release(ctx context.Context, key string) {
+	if key == "" {
+		return
+	}
+	if err := r.dedup.Delete(context.WithoutCancel(ctx), key); err != nil {
+		r.log(ctx, log.WARN, "callback_event_release_failed", nil, err)
+	}
+}
+
+func (r *Router) log(ctx context.Context, level log.Level, msg string, event *Event, err error) {
+	if r.logger == nil {
+		return
+	}
+	keyvals := []any{"msg", msg}
+	if event != nil {
+		keyvals = append(keyvals, "type", event.Type, "id", event.ID)
+	}
+	if err != nil {
+		keyvals = append(keyvals, "error", err)
+	}
+	r.logger.Log(ctx, level, keyvals...)
+}
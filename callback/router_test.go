@@ -0,0 +1,279 @@
+package callback
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Lumiaqian/go-sdk-core/cache"
+	"github.com/Lumiaqian/go-sdk-core/log"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type textMessageEvent struct {
+	FromUserName string `xml:"FromUserName"`
+	Content      string `xml:"Content"`
+	MsgID        int64  `xml:"MsgId"`
+}
+
+type userAddOrgEvent struct {
+	EventType string   `json:"EventType"`
+	UserID    []string `json:"UserId"`
+}
+
+type memoryLogger struct {
+	mu      sync.Mutex
+	entries []string
+}
+
+func (l *memoryLogger) Log(ctx context.Context, level log.Level, keyvals ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries = append(l.entries, fmt.Sprint(keyvals...))
+}
+
+func (l *memoryLogger) Entries() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), l.entries...)
+}
+
+func TestRouter_TypedHandlers(t *testing.T) {
+	r := NewRouter()
+	var text *textMessageEvent
+	var added *userAddOrgEvent
+	On(r, "text", func(ctx context.Context, event *Event, payload *textMessageEvent) error {
+		text = payload
+		return nil
+	})
+	On(r, "user_add_org", func(ctx context.Context, event *Event, payload *userAddOrgEvent) error {
+		added = payload
+		return nil
+	})
+
+	reply, err := r.Dispatch(context.Background(), &Event{Type: "text", Raw: []byte(textMessage), Format: "xml"})
+	require.NoError(t, err)
+	assert.Nil(t, reply)
+	assert.Equal(t, &textMessageEvent{FromUserName: "fromUser", Content: "hello", MsgID: 1234567890123456}, text)
+
+	_, err = r.Dispatch(context.Background(), &Event{Type: "user_add_org", Raw: []byte(`{"EventType":"user_add_org","UserId":["u1","u2"]}`), Format: "json"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"u1", "u2"}, added.UserID)
+
+	_, err = r.Dispatch(context.Background(), &Event{Type: "text", Raw: []byte(`<xml>`), Format: "xml"})
+	assert.Error(t, err)
+
+	// Unhandled events are acknowledged.
+	_, err = r.Dispatch(context.Background(), &Event{Type: "unknown", Format: "xml"})
+	assert.NoError(t, err)
+}
+
+func TestRouter_Deduplication(t *testing.T) {
+	var calls atomic.Int32
+	fail := true
+	r := NewRouter(WithDeduplication(cache.NewMemcache(0, time.Minute), time.Hour))
+	r.HandleDefault(func(ctx context.Context, event *Event) error {
+		calls.Add(1)
+		if fail {
+			fail = false
+			return errors.New("temporary")
+		}
+		return nil
+	})
+
+	event := &Event{Type: "text", ID: "1", Format: "xml"}
+	_, err := r.Dispatch(context.Background(), event)
+	assert.Error(t, err)
+
+	// The failed event is processed again on retry, then dropped.
+	for i := 0; i < 3; i++ {
+		_, err = r.Dispatch(context.Background(), event)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, int32(2), calls.Load())
+
+	// Events without an ID are identified by their content.
+	for i := 0; i < 2; i++ {
+		_, err = r.Dispatch(context.Background(), &Event{Type: "user_add_org", Raw: []byte(`{"EventType":"user_add_org"}`), Format: "json"})
+		require.NoError(t, err)
+	}
+	assert.Equal(t, int32(3), calls.Load())
+}
+
+func TestRouter_Async(t *testing.T) {
+	logger := &memoryLogger{}
+	release := make(chan struct{})
+	var processed atomic.Int32
+	r := NewRouter(WithAsync(1, 1), WithRouterLogger(logger))
+	r.Handle("slow", func(ctx context.Context, event *Event) error {
+		<-release
+		processed.Add(1)
+		return nil
+	})
+	r.Handle("panic", func(ctx context.Context, event *Event) error {
+		panic("boom")
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	// The first event occupies the worker, the second waits in the queue.
+	_, err := r.Dispatch(ctx, &Event{Type: "slow"})
+	require.NoError(t, err)
+	require.Eventually(t, func() bool { return len(r.queue) == 0 }, time.Second, time.Millisecond)
+	_, err = r.Dispatch(ctx, &Event{Type: "slow"})
+	require.NoError(t, err)
+	_, err = r.Dispatch(ctx, &Event{Type: "slow"})
+	assert.ErrorIs(t, err, ErrQueueFull)
+
+	// Handlers outlive the callback request.
+	cancel()
+	close(release)
+	require.Eventually(t, func() bool { return processed.Load() == 2 }, time.Second, time.Millisecond)
+
+	_, err = r.Dispatch(context.Background(), &Event{Type: "panic"})
+	require.NoError(t, err)
+	require.NoError(t, r.Close(context.Background()))
+	assert.Contains(t, fmt.Sprint(logger.Entries()), "callback_handler_panic")
+
+	_, err = r.Dispatch(context.Background(), &Event{Type: "slow"})
+	assert.ErrorIs(t, err, ErrRouterClosed)
+}
+
+func TestRouter_AsyncRetryAndFailureHandler(t *testing.T) {
+	type failure struct {
+		id  string
+		err error
+	}
+	failures := make(chan failure, 1)
+	dedup := cache.NewMemcache(0, time.Minute)
+	r := NewRouter(WithAsync(1, 10), WithDeduplication(dedup, time.Hour), WithRetry(2, time.Millisecond),
+		WithFailureHandler(func(ctx context.Context, event *Event, err error) {
+			failures <- failure{id: event.ID, err: err}
+		}))
+
+	var flakyCalls, brokenCalls atomic.Int32
+	r.Handle("flaky", func(ctx context.Context, event *Event) error {
+		if flakyCalls.Add(1) < 3 {
+			return errors.New("temporarily unavailable")
+		}
+		return nil
+	})
+	r.Handle("broken", func(ctx context.Context, event *Event) error {
+		brokenCalls.Add(1)
+		return errors.New("always failing")
+	})
+
+	_, err := r.Dispatch(context.Background(), &Event{Type: "flaky", ID: "1"})
+	require.NoError(t, err)
+	_, err = r.Dispatch(context.Background(), &Event{Type: "broken", ID: "2"})
+	require.NoError(t, err)
+
+	select {
+	case f := <-failures:
+		assert.Equal(t, "2", f.id)
+		assert.EqualError(t, f.err, "always failing")
+	case <-time.After(time.Second):
+		t.Fatal("failure handler was not called")
+	}
+	require.NoError(t, r.Close(context.Background()))
+	assert.Equal(t, int32(3), flakyCalls.Load())
+	assert.Equal(t, int32(3), brokenCalls.Load())
+
+	// The succeeded event stays deduplicated, the lost one can be replayed.
+	_, err = dedup.Get(context.Background(), "callback_event:flaky:1")
+	assert.NoError(t, err)
+	_, err = dedup.Get(context.Background(), "callback_event:broken:2")
+	assert.ErrorIs(t, err, cache.ErrNotFound)
+}
+
+func TestRouter_SyncInFlightDuplicate(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	var calls atomic.Int32
+	r := NewRouter(WithDeduplication(cache.NewMemcache(0, time.Minute), time.Hour))
+	r.HandleDefault(func(ctx context.Context, event *Event) error {
+		if calls.Add(1) == 1 {
+			close(started)
+			<-release
+			return errors.New("temporary")
+		}
+		return nil
+	})
+
+	event := &Event{Type: "text", ID: "1", Format: "xml"}
+	first := make(chan error, 1)
+	go func() {
+		_, err := r.Dispatch(context.Background(), event)
+		first <- err
+	}()
+	<-started
+
+	// A retry arriving while the first attempt runs is not acknowledged.
+	_, err := r.Dispatch(context.Background(), event)
+	assert.ErrorIs(t, err, ErrEventInProgress)
+	close(release)
+	assert.Error(t, <-first)
+
+	// The failed first attempt does not lose the event.
+	_, err = r.Dispatch(context.Background(), event)
+	require.NoError(t, err)
+	_, err = r.Dispatch(context.Background(), event)
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), calls.Load())
+}
+
+func TestRouter_CloseInterruptsRetryBackoff(t *testing.T) {
+	failed := make(chan error, 1)
+	r := NewRouter(WithAsync(1, 1), WithRetry(3, time.Hour),
+		WithFailureHandler(func(ctx context.Context, event *Event, err error) {
+			failed <- err
+		}))
+	var calls atomic.Int32
+	r.HandleDefault(func(ctx context.Context, event *Event) error {
+		calls.Add(1)
+		return errors.New("always failing")
+	})
+
+	_, err := r.Dispatch(context.Background(), &Event{Type: "text"})
+	require.NoError(t, err)
+	require.Eventually(t, func() bool { return calls.Load() == 1 }, time.Second, time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.NoError(t, r.Close(ctx))
+	assert.EqualError(t, <-failed, "always failing")
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+func TestRouter_SyncPanic(t *testing.T) {
+	r := NewRouter()
+	r.HandleDefault(func(ctx context.Context, event *Event) error {
+		panic("boom")
+	})
+	_, err := r.Dispatch(context.Background(), &Event{Type: "text"})
+	assert.ErrorContains(t, err, "handler panicked: boom")
+}
+
+func TestRouter_WithHandler(t *testing.T) {
+	c := newSampleCrypto(t)
+	var calls atomic.Int32
+	r := NewRouter(WithDeduplication(cache.NewMemcache(0, time.Minute), time.Hour))
+	On(r, "text", func(ctx context.Context, event *Event, payload *textMessageEvent) error {
+		calls.Add(1)
+		return nil
+	})
+	h := NewHandler(c, WeChatXML, r)
+
+	// WeChat retries with a new nonce, the message ID catches the duplicate.
+	for _, nonce := range []string{"n1", "n2"} {
+		rec := serve(h, signedRequest(t, c, WeChatXML, now(), nonce, textMessage))
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "success", rec.Body.String())
+	}
+	assert.Equal(t, int32(1), calls.Load())
+}
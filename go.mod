@@ -1,6 +1,6 @@
 module github.com/Lumiaqian/go-sdk-core
 
-go 1.21.0
+go 1.23
 
 require (
 	github.com/patrickmn/go-cache v2.1.0+incompatible
@@ -4,6 +4,7 @@ import (
 	"context"
 
 	"github.com/Lumiaqian/go-sdk-core/log"
+	"github.com/Lumiaqian/go-sdk-core/trace"
 
 	"github.com/sirupsen/logrus"
 )
@@ -60,6 +61,12 @@ func (a *LogrusAdapter) Log(ctx context.Context, level log.Level, keyvals ...any
 		fields[key] = keyvals[i+1]
 	}
 
+	// Correlate entries with the span of the SDK call or incoming request that logged them.
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		fields["trace_id"] = sc.TraceID.String()
+		fields["span_id"] = sc.SpanID.String()
+	}
+
 	if len(fields) > 0 {
 		a.logrusLogger.WithFields(fields).Log(logrusLevel, msg)
 	} else {
@@ -6,6 +6,7 @@ import (
 	"testing"
 
 	"github.com/Lumiaqian/go-sdk-core/log"
+	"github.com/Lumiaqian/go-sdk-core/trace"
 
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
@@ -61,3 +62,23 @@ func TestLogrusAdapter_Log(t *testing.T) {
 		assert.Contains(t, buf.String(), "\"of\":\"keyvals\"")
 	})
 }
+
+func TestLogrusAdapter_TraceContext(t *testing.T) {
+	var buf bytes.Buffer
+	logrusLogger := logrus.New()
+	logrusLogger.SetOutput(&buf)
+	logrusLogger.SetFormatter(&logrus.JSONFormatter{})
+	adapter := NewLogrusAdapter(logrusLogger)
+
+	exporter := trace.NewInMemoryExporter()
+	ctx, span := trace.NewTracer(exporter).Start(context.Background(), "operation")
+	defer span.End()
+
+	adapter.Log(ctx, log.INFO, "msg", "traced")
+	assert.Contains(t, buf.String(), `"trace_id":"`+span.SpanContext().TraceID.String()+`"`)
+	assert.Contains(t, buf.String(), `"span_id":"`+span.SpanContext().SpanID.String()+`"`)
+
+	buf.Reset()
+	adapter.Log(context.Background(), log.INFO, "msg", "untraced")
+	assert.NotContains(t, buf.String(), "trace_id")
+}
@@ -0,0 +1,14 @@
+package metrics
+
+// Labels are the dimensions of a single series, e.g. {"event": "cache_hit"}.
+type Labels map[string]string
+
+// Recorder receives measurements from the SDK packages. Implementations must be safe for concurrent use.
+type Recorder interface {
+	IncCounter(name string, labels Labels)
+	ObserveHistogram(name string, labels Labels, value float64)
+	SetGauge(name string, labels Labels, value float64)
+}
+
+// DefaultBuckets are the histogram buckets used when none were configured, in seconds.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
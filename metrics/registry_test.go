@@ -0,0 +1,99 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistry_WriteText(t *testing.T) {
+	r := NewRegistry()
+	r.SetHelp("requests_total", "Total requests.")
+	r.SetBuckets("latency_seconds", []float64{1, 0.1})
+
+	r.IncCounter("requests_total", Labels{"method": "GET", "host": "api.example.com"})
+	r.IncCounter("requests_total", Labels{"host": "api.example.com", "method": "GET"})
+	r.IncCounter("requests_total", Labels{"method": "POST", "host": "api.example.com"})
+	r.SetGauge("expiry", nil, 1700000000)
+	r.ObserveHistogram("latency_seconds", Labels{"route": "/x"}, 0.05)
+	r.ObserveHistogram("latency_seconds", Labels{"route": "/x"}, 0.5)
+	r.ObserveHistogram("latency_seconds", Labels{"route": "/x"}, 2)
+
+	// A different type for an existing name is dropped.
+	r.SetGauge("requests_total", nil, 10)
+
+	var sb strings.Builder
+	require.NoError(t, r.WriteText(&sb))
+
+	expected := `# TYPE expiry gauge
+expiry 1.7e+09
+# TYPE latency_seconds histogram
+latency_seconds_bucket{route="/x",le="0.1"} 1
+latency_seconds_bucket{route="/x",le="1"} 2
+latency_seconds_bucket{route="/x",le="+Inf"} 3
+latency_seconds_sum{route="/x"} 2.55
+latency_seconds_count{route="/x"} 3
+# HELP requests_total Total requests.
+# TYPE requests_total counter
+requests_total{host="api.example.com",method="GET"} 2
+requests_total{host="api.example.com",method="POST"} 1
+`
+	assert.Equal(t, expected, sb.String())
+}
+
+func TestRegistry_EscapesLabelValues(t *testing.T) {
+	r := NewRegistry()
+	r.IncCounter("c", Labels{"v": "a\"b\\c\nd"})
+
+	var sb strings.Builder
+	require.NoError(t, r.WriteText(&sb))
+	assert.Contains(t, sb.String(), `c{v="a\"b\\c\nd"} 1`)
+}
+
+func TestRegistry_ServeHTTP(t *testing.T) {
+	r := NewRegistry()
+	r.IncCounter("c", nil)
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", rec.Header().Get("Content-Type"))
+	assert.Equal(t, "# TYPE c counter\nc 1\n", rec.Body.String())
+}
+
+// blockingWriter stalls until released, like a scraper that stopped reading.
+type blockingWriter struct {
+	release chan struct{}
+}
+
+func (w blockingWriter) Write(p []byte) (int, error) {
+	<-w.release
+	return len(p), nil
+}
+
+func TestRegistry_SlowWriterDoesNotBlockRecording(t *testing.T) {
+	r := NewRegistry()
+	r.IncCounter("c", nil)
+
+	w := blockingWriter{release: make(chan struct{})}
+	done := make(chan error)
+	go func() { done <- r.WriteText(w) }()
+
+	recorded := make(chan struct{})
+	go func() {
+		r.IncCounter("c", nil)
+		close(recorded)
+	}()
+	select {
+	case <-recorded:
+	case <-time.After(time.Second):
+		t.Fatal("IncCounter blocked behind a stalled writer")
+	}
+	close(w.release)
+	require.NoError(t, <-done)
+}
@@ -0,0 +1,200 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+const defaultBatchConcurrency = 8
+
+// ErrBatchAborted is the error of batch items that were not started because an earlier item failed
+// in fail-fast mode.
+var ErrBatchAborted = errors.New("rest: batch aborted")
+
+// BatchResult is the outcome of one batch item.
+type BatchResult[T any] struct {
+	Value T
+	Err   error
+}
+
+// BatchError reports the failed items of a batch.
+type BatchError struct {
+	Failed int
+	Total  int
+	// Err is the first failure, the one that aborted the batch in fail-fast mode.
+	Err error
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("rest: %d of %d batch items failed: %v", e.Failed, e.Total, e.Err)
+}
+
+func (e *BatchError) Unwrap() error {
+	return e.Err
+}
+
+type batchConfig struct {
+	concurrency int
+	failFast    bool
+	check       func(*HttpResponse) error
+}
+
+type BatchOption func(*batchConfig)
+
+// WithConcurrency runs at most n items at a time, 8 by default.
+func WithConcurrency(n int) BatchOption {
+	return func(c *batchConfig) {
+		c.concurrency = n
+	}
+}
+
+// WithFailFast cancels outstanding items after the first failure. By default every item runs.
+func WithFailFast() BatchOption {
+	return func(c *batchConfig) {
+		c.failFast = true
+	}
+}
+
+// WithResponseCheck turns responses into item failures for Batch.Do, e.g. with CheckStatus.
+func WithResponseCheck(check func(*HttpResponse) error) BatchOption {
+	return func(c *batchConfig) {
+		c.check = check
+	}
+}
+
+// CheckStatus fails responses with a status code of 400 or above.
+func CheckStatus(resp *HttpResponse) error {
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("rest: unexpected status %d: %s", resp.StatusCode, resp.Body)
+	}
+	return nil
+}
+
+// BatchMap calls fn for every item on a bounded pool of goroutines and returns the results in the
+// order of items. The error is nil or a *BatchError. When ctx is canceled, items that have not
+// started fail with the context error.
+func BatchMap[I, O any](ctx context.Context, items []I, fn func(ctx context.Context, item I) (O, error), opts ...BatchOption) ([]BatchResult[O], error) {
+	config := batchConfig{concurrency: defaultBatchConcurrency}
+	for _, opt := range opts {
+		opt(&config)
+	}
+	return batchMap(ctx, items, fn, config)
+}
+
+func batchMap[I, O any](parent context.Context, items []I, fn func(ctx context.Context, item I) (O, error), config batchConfig) ([]BatchResult[O], error) {
+	results := make([]BatchResult[O], len(items))
+	if len(items) == 0 {
+		return results, nil
+	}
+	ctx, cancel := context.WithCancel(parent)
+	defer cancel()
+
+	var mu sync.Mutex
+	var firstErr error
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < min(max(config.concurrency, 1), len(items)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				value, err := fn(ctx, items[i])
+				results[i] = BatchResult[O]{Value: value, Err: err}
+				if err == nil {
+					continue
+				}
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = err
+					if config.failFast {
+						cancel()
+					}
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	started := 0
+feed:
+	for ; started < len(items) && ctx.Err() == nil; started++ {
+		select {
+		case indexes <- started:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(indexes)
+	wg.Wait()
+
+	skipped := parent.Err()
+	if skipped == nil {
+		skipped = ErrBatchAborted
+	}
+	for i := started; i < len(items); i++ {
+		results[i].Err = skipped
+	}
+
+	failed := 0
+	for _, r := range results {
+		if r.Err != nil {
+			failed++
+		}
+	}
+	if failed == 0 {
+		return results, nil
+	}
+	if firstErr == nil {
+		firstErr = skipped
+	}
+	return results, &BatchError{Failed: failed, Total: len(items), Err: firstErr}
+}
+
+// BatchRequest is one request of a Batch.
+type BatchRequest struct {
+	Method  string
+	URL     string
+	Headers map[string]string
+	// Payload is the request payload, an empty one when nil. Its readers are consumed, so a
+	// payload cannot be shared between requests.
+	Payload *RequestPayload
+}
+
+// Batch sends many requests through a Client with bounded concurrency. Requests pass through the
+// client middleware, so rate limiting and token middleware apply to every request.
+type Batch struct {
+	client Client
+	config batchConfig
+}
+
+func NewBatch(client Client, opts ...BatchOption) *Batch {
+	b := &Batch{
+		client: client,
+		config: batchConfig{concurrency: defaultBatchConcurrency},
+	}
+	for _, opt := range opts {
+		opt(&b.config)
+	}
+	return b
+}
+
+// Do sends requests and returns their responses in order. A failed item keeps its response when
+// the failure comes from the response check.
+func (b *Batch) Do(ctx context.Context, requests []BatchRequest) ([]BatchResult[*HttpResponse], error) {
+	return batchMap(ctx, requests, func(ctx context.Context, req BatchRequest) (*HttpResponse, error) {
+		payload := req.Payload
+		if payload == nil {
+			payload = &RequestPayload{}
+		}
+		resp, err := b.client.DoRequest(ctx, req.Method, req.URL, req.Headers, payload)
+		if err != nil {
+			return nil, err
+		}
+		if b.config.check != nil {
+			return resp, b.config.check(resp)
+		}
+		return resp, nil
+	}, b.config)
+}
@@ -0,0 +1,142 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBatchMap_OrderAndConcurrency(t *testing.T) {
+	var inFlight, maxInFlight atomic.Int32
+	items := numbers(50)
+	results, err := BatchMap(context.Background(), items, func(ctx context.Context, item int) (string, error) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			m := maxInFlight.Load()
+			if n <= m || maxInFlight.CompareAndSwap(m, n) {
+				break
+			}
+		}
+		time.Sleep(time.Duration(50-item) * 20 * time.Microsecond)
+		return strconv.Itoa(item), nil
+	}, WithConcurrency(4))
+
+	require.NoError(t, err)
+	require.Len(t, results, 50)
+	for i, r := range results {
+		assert.Equal(t, strconv.Itoa(i), r.Value)
+	}
+	assert.LessOrEqual(t, maxInFlight.Load(), int32(4))
+}
+
+func TestBatchMap_BestEffort(t *testing.T) {
+	boom := errors.New("boom")
+	var calls atomic.Int32
+	results, err := BatchMap(context.Background(), numbers(10), func(ctx context.Context, item int) (int, error) {
+		calls.Add(1)
+		if item%3 == 0 {
+			return 0, boom
+		}
+		return item * 2, nil
+	}, WithConcurrency(2))
+
+	var batchErr *BatchError
+	require.ErrorAs(t, err, &batchErr)
+	assert.Equal(t, 4, batchErr.Failed)
+	assert.Equal(t, 10, batchErr.Total)
+	assert.ErrorIs(t, err, boom)
+	assert.Equal(t, int32(10), calls.Load())
+	assert.Equal(t, 14, results[7].Value)
+	assert.ErrorIs(t, results[9].Err, boom)
+}
+
+func TestBatchMap_FailFast(t *testing.T) {
+	boom := errors.New("boom")
+	var calls atomic.Int32
+	results, err := BatchMap(context.Background(), numbers(100), func(ctx context.Context, item int) (int, error) {
+		calls.Add(1)
+		if item == 5 {
+			return 0, boom
+		}
+		select {
+		case <-time.After(time.Millisecond):
+			return item, nil
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+	}, WithConcurrency(2), WithFailFast())
+
+	var batchErr *BatchError
+	require.ErrorAs(t, err, &batchErr)
+	assert.ErrorIs(t, err, boom)
+	assert.Less(t, calls.Load(), int32(100))
+	assert.ErrorIs(t, results[99].Err, ErrBatchAborted)
+	assert.NoError(t, results[0].Err)
+}
+
+func TestBatchMap_ContextCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	results, err := BatchMap(ctx, numbers(100), func(ctx context.Context, item int) (int, error) {
+		if item == 10 {
+			cancel()
+		}
+		return item, ctx.Err()
+	}, WithConcurrency(1))
+
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.NoError(t, results[0].Err)
+	assert.ErrorIs(t, results[99].Err, context.Canceled)
+
+	results, err = BatchMap(context.Background(), []int{}, func(ctx context.Context, item int) (int, error) { return item, nil })
+	assert.NoError(t, err)
+	assert.Empty(t, results)
+}
+
+type countingMiddleware struct {
+	calls atomic.Int32
+}
+
+func (m *countingMiddleware) Handle(ctx context.Context, req *http.Request, next MiddlewareHandler) (*http.Response, error) {
+	m.calls.Add(1)
+	return next(ctx, req)
+}
+
+func TestBatch_Do(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("user") == "missing" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(r.URL.Query().Get("user")))
+	}))
+	defer server.Close()
+
+	client := NewDefaultHttpClient()
+	middleware := &countingMiddleware{}
+	client.Use(middleware)
+
+	users := []string{"alice", "missing", "bob"}
+	requests := make([]BatchRequest, len(users))
+	for i, user := range users {
+		requests[i] = BatchRequest{Method: http.MethodGet, URL: server.URL + "/users?user=" + user}
+	}
+
+	results, err := NewBatch(client, WithConcurrency(2), WithResponseCheck(CheckStatus)).Do(context.Background(), requests)
+	var batchErr *BatchError
+	require.ErrorAs(t, err, &batchErr)
+	assert.Equal(t, 1, batchErr.Failed)
+	assert.Equal(t, "alice", string(results[0].Value.Body))
+	assert.Equal(t, "bob", string(results[2].Value.Body))
+	assert.Equal(t, http.StatusNotFound, results[1].Value.StatusCode)
+	assert.Error(t, results[1].Err)
+	assert.Equal(t, int32(3), middleware.calls.Load())
+}
@@ -0,0 +1,253 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Lumiaqian/go-sdk-core/cache"
+	"github.com/Lumiaqian/go-sdk-core/rest"
+)
+
+const defaultRevalidationWindow = 24 * time.Hour
+
+// CachingMiddleware stores successful GET responses in a cache.Cache. Freshness comes from the
+// response Cache-Control max-age or Expires headers, or from a route TTL for APIs that send no cache
+// headers. Stale entries with an ETag or Last-Modified are revalidated with a conditional request.
+// Entries are keyed by the Authorization header as well, so responses are never shared across
+// credentials; register the middleware after any middleware that sets that header.
+type CachingMiddleware struct {
+	cache              cache.Cache
+	routes             []routeTTL
+	varyHeaders        []string
+	revalidationWindow time.Duration
+	now                func() time.Time
+}
+
+type routeTTL struct {
+	pathPrefix string
+	ttl        time.Duration
+}
+
+type CachingOption func(*CachingMiddleware)
+
+// WithRouteTTL caches responses for paths starting with pathPrefix for ttl when the response has no
+// cache headers. The longest matching prefix wins.
+func WithRouteTTL(pathPrefix string, ttl time.Duration) CachingOption {
+	return func(m *CachingMiddleware) {
+		m.routes = append(m.routes, routeTTL{pathPrefix: pathPrefix, ttl: ttl})
+	}
+}
+
+// WithVaryHeaders stores separate entries per value of the given request headers, e.g. Accept-Language.
+func WithVaryHeaders(headers ...string) CachingOption {
+	return func(m *CachingMiddleware) {
+		for _, h := range headers {
+			m.varyHeaders = append(m.varyHeaders, http.CanonicalHeaderKey(h))
+		}
+	}
+}
+
+// WithRevalidationWindow is how long stale entries with validators are kept for revalidation, 24 hours by default.
+func WithRevalidationWindow(window time.Duration) CachingOption {
+	return func(m *CachingMiddleware) {
+		m.revalidationWindow = window
+	}
+}
+
+func NewCachingMiddleware(c cache.Cache, opts ...CachingOption) *CachingMiddleware {
+	m := &CachingMiddleware{
+		cache:              c,
+		revalidationWindow: defaultRevalidationWindow,
+		now:                time.Now,
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+type cachedResponse struct {
+	StatusCode   int         `json:"status_code"`
+	Header       http.Header `json:"header"`
+	Body         []byte      `json:"body"`
+	FreshUntil   time.Time   `json:"fresh_until"`
+	ETag         string      `json:"etag,omitempty"`
+	LastModified string      `json:"last_modified,omitempty"`
+}
+
+func (m *CachingMiddleware) Handle(ctx context.Context, req *http.Request, next rest.MiddlewareHandler) (*http.Response, error) {
+	if req.Method != http.MethodGet || hasDirective(req.Header, "no-store") {
+		return next(ctx, req)
+	}
+
+	key := m.cacheKey(req)
+	entry := m.load(ctx, key)
+	if entry != nil && m.now().Before(entry.FreshUntil) && !hasDirective(req.Header, "no-cache") {
+		return entry.response(req), nil
+	}
+
+	outgoing := req
+	if entry != nil && (entry.ETag != "" || entry.LastModified != "") {
+		outgoing = req.Clone(ctx)
+		if entry.ETag != "" {
+			outgoing.Header.Set("If-None-Match", entry.ETag)
+		}
+		if entry.LastModified != "" {
+			outgoing.Header.Set("If-Modified-Since", entry.LastModified)
+		}
+	}
+
+	resp, err := next(ctx, outgoing)
+	if err != nil || resp == nil {
+		return resp, err
+	}
+
+	if resp.StatusCode == http.StatusNotModified && entry != nil && outgoing != req {
+		resp.Body.Close()
+		// Headers sent with the 304 update the stored ones, e.g. a new max-age.
+		for k, v := range resp.Header {
+			entry.Header[k] = v
+		}
+		if ttl, ok := m.freshness(req, entry.Header); ok {
+			entry.FreshUntil = m.now().Add(ttl)
+			m.store(ctx, key, entry)
+		}
+		return entry.response(req), nil
+	}
+
+	if resp.StatusCode != http.StatusOK || hasDirective(resp.Header, "no-store") {
+		return resp, nil
+	}
+	ttl, cacheable := m.freshness(req, resp.Header)
+	etag, lastModified := resp.Header.Get("ETag"), resp.Header.Get("Last-Modified")
+	if !cacheable && etag == "" && lastModified == "" {
+		return resp, nil
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return resp, err
+	}
+
+	m.store(ctx, key, &cachedResponse{
+		StatusCode:   resp.StatusCode,
+		Header:       resp.Header.Clone(),
+		Body:         body,
+		FreshUntil:   m.now().Add(ttl),
+		ETag:         etag,
+		LastModified: lastModified,
+	})
+	return resp, nil
+}
+
+// freshness returns how long a response may be served without revalidation and whether the
+// headers or a route allow caching at all.
+func (m *CachingMiddleware) freshness(req *http.Request, header http.Header) (time.Duration, bool) {
+	directives := cacheControl(header)
+	if _, ok := directives["no-cache"]; ok {
+		return 0, true
+	}
+	if v, ok := directives["max-age"]; ok {
+		if seconds, err := strconv.Atoi(v); err == nil && seconds >= 0 {
+			return time.Duration(seconds) * time.Second, true
+		}
+	}
+	if expires := header.Get("Expires"); expires != "" {
+		if t, err := http.ParseTime(expires); err == nil {
+			return max(t.Sub(m.now()), 0), true
+		}
+		return 0, true
+	}
+
+	best := -1
+	var ttl time.Duration
+	for _, r := range m.routes {
+		if strings.HasPrefix(req.URL.Path, r.pathPrefix) && len(r.pathPrefix) > best {
+			best, ttl = len(r.pathPrefix), r.ttl
+		}
+	}
+	return ttl, best >= 0
+}
+
+func (m *CachingMiddleware) cacheKey(req *http.Request) string {
+	h := sha256.New()
+	h.Write([]byte(req.Method + " " + req.URL.String()))
+	h.Write([]byte("\nAuthorization:" + strings.Join(req.Header.Values("Authorization"), ",")))
+	for _, name := range m.varyHeaders {
+		h.Write([]byte("\n" + name + ":" + strings.Join(req.Header.Values(name), ",")))
+	}
+	// The URL and Authorization header may carry an access token, only their hash ends up in the key.
+	return "http_response:" + hex.EncodeToString(h.Sum(nil))
+}
+
+func (m *CachingMiddleware) load(ctx context.Context, key string) *cachedResponse {
+	raw, err := m.cache.Get(ctx, key)
+	if err != nil {
+		return nil
+	}
+	var entry cachedResponse
+	if err := json.Unmarshal([]byte(raw), &entry); err != nil {
+		return nil
+	}
+	if entry.Header == nil {
+		entry.Header = http.Header{}
+	}
+	return &entry
+}
+
+func (m *CachingMiddleware) store(ctx context.Context, key string, entry *cachedResponse) {
+	expiration := entry.FreshUntil.Sub(m.now())
+	if entry.ETag != "" || entry.LastModified != "" {
+		expiration += m.revalidationWindow
+	}
+	if expiration <= 0 {
+		return
+	}
+	raw, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	_ = m.cache.Set(ctx, key, string(raw), expiration)
+}
+
+func (e *cachedResponse) response(req *http.Request) *http.Response {
+	return &http.Response{
+		Status:        strconv.Itoa(e.StatusCode) + " " + http.StatusText(e.StatusCode),
+		StatusCode:    e.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        e.Header.Clone(),
+		Body:          io.NopCloser(bytes.NewReader(e.Body)),
+		ContentLength: int64(len(e.Body)),
+		Request:       req,
+	}
+}
+
+func cacheControl(header http.Header) map[string]string {
+	directives := make(map[string]string)
+	for _, line := range header.Values("Cache-Control") {
+		for _, part := range strings.Split(line, ",") {
+			name, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+			if name != "" {
+				directives[strings.ToLower(name)] = strings.Trim(value, `"`)
+			}
+		}
+	}
+	return directives
+}
+
+func hasDirective(header http.Header, directive string) bool {
+	_, ok := cacheControl(header)[directive]
+	return ok
+}
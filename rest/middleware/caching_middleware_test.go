@@ -0,0 +1,186 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Lumiaqian/go-sdk-core/cache"
+	"github.com/Lumiaqian/go-sdk-core/rest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newCachingClient(opts ...CachingOption) (*rest.DefaultHttpClient, *CachingMiddleware) {
+	m := NewCachingMiddleware(cache.NewMemcache(0, time.Minute), opts...)
+	client := rest.NewDefaultHttpClient()
+	client.Use(m)
+	return client, m
+}
+
+func get(t *testing.T, client rest.Client, url string, headers map[string]string) *rest.HttpResponse {
+	resp, err := client.DoRequest(context.Background(), http.MethodGet, url, headers, &rest.RequestPayload{})
+	require.NoError(t, err)
+	return resp
+}
+
+func TestCachingMiddleware_MaxAge(t *testing.T) {
+	var hits atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		switch r.URL.Path {
+		case "/config":
+			w.Header().Set("Cache-Control", "public, max-age=60")
+		case "/secret":
+			w.Header().Set("Cache-Control", "no-store")
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"path":"` + r.URL.Path + `"}`))
+	}))
+	defer server.Close()
+
+	client, m := newCachingClient()
+	now := time.Now()
+	m.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		resp := get(t, client, server.URL+"/config", nil)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.JSONEq(t, `{"path":"/config"}`, string(resp.Body))
+		assert.Equal(t, "application/json", resp.ContentType)
+	}
+	assert.Equal(t, int32(1), hits.Load())
+
+	// Requests may opt out.
+	get(t, client, server.URL+"/config", map[string]string{"Cache-Control": "no-store"})
+	assert.Equal(t, int32(2), hits.Load())
+
+	now = now.Add(61 * time.Second)
+	get(t, client, server.URL+"/config", nil)
+	assert.Equal(t, int32(3), hits.Load())
+
+	get(t, client, server.URL+"/secret", nil)
+	get(t, client, server.URL+"/secret", nil)
+	get(t, client, server.URL+"/no-headers", nil)
+	get(t, client, server.URL+"/no-headers", nil)
+	assert.Equal(t, int32(7), hits.Load())
+
+	// Other methods are never cached.
+	_, err := client.DoRequest(context.Background(), http.MethodPost, server.URL+"/config", nil, &rest.RequestPayload{})
+	require.NoError(t, err)
+	assert.Equal(t, int32(8), hits.Load())
+}
+
+func TestCachingMiddleware_ETagRevalidation(t *testing.T) {
+	var hits, notModified atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			notModified.Add(1)
+			w.Header().Set("Cache-Control", "max-age=30")
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Write([]byte("departments"))
+	}))
+	defer server.Close()
+
+	client, m := newCachingClient()
+	now := time.Now()
+	m.now = func() time.Time { return now }
+
+	resp := get(t, client, server.URL+"/departments", nil)
+	assert.Equal(t, "departments", string(resp.Body))
+
+	// no-cache: stored, but revalidated before every use.
+	resp = get(t, client, server.URL+"/departments", nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "departments", string(resp.Body))
+	assert.Equal(t, int32(2), hits.Load())
+	assert.Equal(t, int32(1), notModified.Load())
+
+	// The 304 carried max-age=30, so the entry is fresh now.
+	get(t, client, server.URL+"/departments", nil)
+	assert.Equal(t, int32(2), hits.Load())
+
+	now = now.Add(31 * time.Second)
+	resp = get(t, client, server.URL+"/departments", nil)
+	assert.Equal(t, "departments", string(resp.Body))
+	assert.Equal(t, int32(3), hits.Load())
+	assert.Equal(t, int32(2), notModified.Load())
+}
+
+func TestCachingMiddleware_LastModified(t *testing.T) {
+	lastModified := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC).Format(http.TimeFormat)
+	var conditional atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-Modified-Since") == lastModified {
+			conditional.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Last-Modified", lastModified)
+		w.Write([]byte("certificates"))
+	}))
+	defer server.Close()
+
+	client, _ := newCachingClient()
+	get(t, client, server.URL, nil)
+	resp := get(t, client, server.URL, nil)
+	assert.Equal(t, "certificates", string(resp.Body))
+	assert.Equal(t, int32(1), conditional.Load())
+}
+
+func TestCachingMiddleware_RouteTTLAndVary(t *testing.T) {
+	var hits atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Write([]byte(r.URL.Path + ":" + r.Header.Get("Accept-Language")))
+	}))
+	defer server.Close()
+
+	client, _ := newCachingClient(
+		WithRouteTTL("/cgi-bin", 0),
+		WithRouteTTL("/cgi-bin/department", time.Minute),
+		WithVaryHeaders("accept-language"),
+	)
+
+	zh := map[string]string{"Accept-Language": "zh-CN"}
+	en := map[string]string{"Accept-Language": "en"}
+	assert.Equal(t, "/cgi-bin/department/list:zh-CN", string(get(t, client, server.URL+"/cgi-bin/department/list", zh).Body))
+	assert.Equal(t, "/cgi-bin/department/list:zh-CN", string(get(t, client, server.URL+"/cgi-bin/department/list", zh).Body))
+	assert.Equal(t, int32(1), hits.Load())
+
+	assert.Equal(t, "/cgi-bin/department/list:en", string(get(t, client, server.URL+"/cgi-bin/department/list", en).Body))
+	assert.Equal(t, int32(2), hits.Load())
+
+	// The shorter prefix has a zero TTL.
+	get(t, client, server.URL+"/cgi-bin/user/get", zh)
+	get(t, client, server.URL+"/cgi-bin/user/get", zh)
+	assert.Equal(t, int32(4), hits.Load())
+}
+
+func TestCachingMiddleware_AuthorizationIsPartOfKey(t *testing.T) {
+	var hits atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Write([]byte(r.Header.Get("Authorization")))
+	}))
+	defer server.Close()
+
+	client, _ := newCachingClient()
+	alice := map[string]string{"Authorization": "Bearer alice"}
+	bob := map[string]string{"Authorization": "Bearer bob"}
+	assert.Equal(t, "Bearer alice", string(get(t, client, server.URL+"/me", alice).Body))
+	assert.Equal(t, "Bearer bob", string(get(t, client, server.URL+"/me", bob).Body))
+	assert.Equal(t, "Bearer alice", string(get(t, client, server.URL+"/me", alice).Body))
+	assert.Equal(t, "", string(get(t, client, server.URL+"/me", nil).Body))
+	assert.Equal(t, int32(3), hits.Load())
+}
@@ -0,0 +1,159 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Lumiaqian/go-sdk-core/metrics"
+	"github.com/Lumiaqian/go-sdk-core/rest"
+)
+
+const (
+	MetricHTTPRequestsTotal   = "sdk_http_client_requests_total"
+	MetricHTTPRequestDuration = "sdk_http_client_request_duration_seconds"
+)
+
+// MetricsMiddleware counts requests and records their latency, labelled by method, host, route
+// template and status class (2xx, 4xx, 5xx, or error when no response was received).
+//
+// The route is the first matching template, otherwise the path with identifier-like segments
+// replaced by {id}, so that raw URLs do not blow up the number of series. Identifiers made only of
+// letters cannot be told apart from route segments; APIs that use them should set templates and
+// WithUnmatchedRoute.
+type MetricsMiddleware struct {
+	recorder  metrics.Recorder
+	templates [][]string
+	unmatched string
+}
+
+type MetricsOption func(*MetricsMiddleware)
+
+// WithRouteTemplates sets the route templates to label requests with. A {name} segment matches any
+// single path segment and a trailing * matches the rest of the path, e.g. /v3/pay/transactions/id/{id}.
+func WithRouteTemplates(templates ...string) MetricsOption {
+	return func(m *MetricsMiddleware) {
+		for _, t := range templates {
+			m.templates = append(m.templates, splitPath(t))
+		}
+	}
+}
+
+// WithUnmatchedRoute labels requests that match no template with route, e.g. "unmatched", instead
+// of the path with identifiers replaced.
+func WithUnmatchedRoute(route string) MetricsOption {
+	return func(m *MetricsMiddleware) {
+		m.unmatched = route
+	}
+}
+
+func NewMetricsMiddleware(recorder metrics.Recorder, opts ...MetricsOption) *MetricsMiddleware {
+	if registry, ok := recorder.(*metrics.Registry); ok {
+		registry.SetHelp(MetricHTTPRequestsTotal, "Outgoing HTTP requests by method, host, route and status class.")
+		registry.SetHelp(MetricHTTPRequestDuration, "Latency of outgoing HTTP requests.")
+	}
+
+	m := &MetricsMiddleware{
+		recorder: recorder,
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+type routeKey struct{}
+
+// ContextWithRoute labels the requests made with ctx with route, overriding the templates. SDK
+// methods know the template of the endpoint they call and can set it directly.
+func ContextWithRoute(ctx context.Context, route string) context.Context {
+	return context.WithValue(ctx, routeKey{}, route)
+}
+
+func (m *MetricsMiddleware) Handle(ctx context.Context, req *http.Request, next rest.MiddlewareHandler) (*http.Response, error) {
+	start := time.Now()
+	resp, err := next(ctx, req)
+
+	statusClass := "error"
+	if err == nil && resp != nil {
+		statusClass = strconv.Itoa(resp.StatusCode/100) + "xx"
+	}
+	labels := metrics.Labels{
+		"method":       req.Method,
+		"host":         req.URL.Host,
+		"route":        m.route(ctx, req),
+		"status_class": statusClass,
+	}
+	m.recorder.IncCounter(MetricHTTPRequestsTotal, labels)
+	m.recorder.ObserveHistogram(MetricHTTPRequestDuration, labels, time.Since(start).Seconds())
+	return resp, err
+}
+
+func (m *MetricsMiddleware) route(ctx context.Context, req *http.Request) string {
+	if route, ok := ctx.Value(routeKey{}).(string); ok {
+		return route
+	}
+
+	segments := splitPath(req.URL.Path)
+	for _, template := range m.templates {
+		if matchTemplate(template, segments) {
+			return "/" + strings.Join(template, "/")
+		}
+	}
+	if m.unmatched != "" {
+		return m.unmatched
+	}
+
+	for i, s := range segments {
+		if looksLikeID(s) {
+			segments[i] = "{id}"
+		}
+	}
+	return "/" + strings.Join(segments, "/")
+}
+
+func splitPath(path string) []string {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, "/")
+}
+
+func matchTemplate(template, segments []string) bool {
+	for i, t := range template {
+		if t == "*" && i == len(template)-1 {
+			return true
+		}
+		if i >= len(segments) {
+			return false
+		}
+		if strings.HasPrefix(t, "{") && strings.HasSuffix(t, "}") {
+			continue
+		}
+		if t != segments[i] {
+			return false
+		}
+	}
+	return len(template) == len(segments)
+}
+
+// looksLikeID reports whether a path segment is an identifier rather than part of the route: any
+// segment containing a digit, such as a number, UUID or order number, except API versions like v2.
+func looksLikeID(segment string) bool {
+	if len(segment) > 1 && segment[0] == 'v' && isDigits(segment[1:]) {
+		return false
+	}
+	return strings.ContainsAny(segment, "0123456789")
+}
+
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
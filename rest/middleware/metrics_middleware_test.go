@@ -0,0 +1,87 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/Lumiaqian/go-sdk-core/metrics"
+	"github.com/Lumiaqian/go-sdk-core/rest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetricsMiddleware(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/v3/pay") {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	registry := metrics.NewRegistry()
+	client := rest.NewDefaultHttpClient()
+	client.Use(NewMetricsMiddleware(registry, WithRouteTemplates("/v3/pay/transactions/id/{transaction_id}")))
+
+	for _, path := range []string{
+		"/v3/pay/transactions/id/4200000001",
+		"/v3/pay/transactions/id/4200000002",
+		"/cgi-bin/user/get?userid=zhangsan",
+		"/users/12345/orders/7f9c2ba4-e88f-11ee-a506-0242ac120002",
+	} {
+		_, err := client.DoRequest(context.Background(), http.MethodGet, server.URL+path, nil, &rest.RequestPayload{})
+		require.NoError(t, err)
+	}
+	_, err := client.DoRequest(ContextWithRoute(context.Background(), "/token"), http.MethodPost, server.URL+"/gettoken", nil, &rest.RequestPayload{})
+	require.NoError(t, err)
+
+	var out strings.Builder
+	require.NoError(t, registry.WriteText(&out))
+	text := out.String()
+
+	assert.Contains(t, text, "# HELP sdk_http_client_requests_total")
+	assert.Contains(t, text, `sdk_http_client_requests_total{host="`+host+`",method="GET",route="/v3/pay/transactions/id/{transaction_id}",status_class="4xx"} 2`)
+	assert.Contains(t, text, `sdk_http_client_requests_total{host="`+host+`",method="GET",route="/cgi-bin/user/get",status_class="2xx"} 1`)
+	assert.Contains(t, text, `route="/users/{id}/orders/{id}"`)
+	assert.Contains(t, text, `sdk_http_client_requests_total{host="`+host+`",method="POST",route="/token",status_class="2xx"} 1`)
+	assert.Contains(t, text, `sdk_http_client_request_duration_seconds_count{host="`+host+`",method="GET",route="/cgi-bin/user/get",status_class="2xx"} 1`)
+	assert.NotContains(t, text, "4200000001")
+}
+
+func TestMetricsMiddleware_TransportError(t *testing.T) {
+	registry := metrics.NewRegistry()
+	client := rest.NewDefaultHttpClient()
+	client.Use(NewMetricsMiddleware(registry))
+
+	_, err := client.DoRequest(context.Background(), http.MethodGet, "http://127.0.0.1:1/token", nil, &rest.RequestPayload{})
+	require.Error(t, err)
+
+	var out strings.Builder
+	require.NoError(t, registry.WriteText(&out))
+	assert.Contains(t, out.String(), `sdk_http_client_requests_total{host="127.0.0.1:1",method="GET",route="/token",status_class="error"} 1`)
+}
+
+func TestMetricsMiddleware_Route(t *testing.T) {
+	m := NewMetricsMiddleware(metrics.NewRegistry(), WithRouteTemplates("/files/*", "/topapi/v2/user/{op}"))
+	route := func(path string) string {
+		return m.route(context.Background(), &http.Request{URL: &url.URL{Path: path}})
+	}
+
+	assert.Equal(t, "/files/*", route("/files/a/b/c"))
+	assert.Equal(t, "/topapi/v2/user/{op}", route("/topapi/v2/user/get"))
+	assert.Equal(t, "/topapi/v2/user/get/extra", route("/topapi/v2/user/get/extra"))
+	assert.Equal(t, "/", route(""))
+	assert.Equal(t, "/v2/orders/{id}", route("/v2/orders/1217752501201407033233368018"))
+	assert.Equal(t, "/api/v2", route("/api/v2"))
+	assert.Equal(t, "/users/{id}/orders/{id}", route("/users/ab12cd/orders/7"))
+
+	m = NewMetricsMiddleware(metrics.NewRegistry(), WithRouteTemplates("/users/{name}"), WithUnmatchedRoute("unmatched"))
+	assert.Equal(t, "/users/{name}", route("/users/alice"))
+	assert.Equal(t, "unmatched", route("/profiles/alice"))
+	assert.Equal(t, "/custom", m.route(ContextWithRoute(context.Background(), "/custom"), &http.Request{URL: &url.URL{Path: "/profiles/alice"}}))
+}
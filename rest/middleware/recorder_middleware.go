@@ -0,0 +1,440 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/Lumiaqian/go-sdk-core/rest"
+)
+
+// RecorderMode selects whether the RecorderMiddleware records, replays or stays out of the way.
+type RecorderMode int
+
+const (
+	// ModeReplay answers requests from the cassette and never touches the network.
+	ModeReplay RecorderMode = iota
+	// ModeRecord sends requests and writes every interaction to the cassette, replacing its content.
+	ModeRecord
+	// ModePassthrough sends requests without recording.
+	ModePassthrough
+)
+
+const redacted = "[REDACTED]"
+
+var ErrInteractionNotFound = errors.New("recorder: no matching interaction")
+
+// Cassette is the file format of recorded interactions.
+type Cassette struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+type Interaction struct {
+	Request  RecordedRequest  `json:"request"`
+	Response RecordedResponse `json:"response"`
+}
+
+type RecordedRequest struct {
+	Method  string       `json:"method"`
+	URL     string       `json:"url"`
+	Headers http.Header  `json:"headers,omitempty"`
+	Body    RecordedBody `json:"body,omitempty"`
+}
+
+type RecordedResponse struct {
+	StatusCode int          `json:"status_code"`
+	Headers    http.Header  `json:"headers,omitempty"`
+	Body       RecordedBody `json:"body,omitempty"`
+}
+
+// RecordedBody is stored as text when it is valid UTF-8 and as base64 otherwise.
+type RecordedBody []byte
+
+func (b RecordedBody) MarshalJSON() ([]byte, error) {
+	if utf8.Valid(b) {
+		return json.Marshal(string(b))
+	}
+	return json.Marshal(map[string]string{"base64": base64.StdEncoding.EncodeToString(b)})
+}
+
+func (b *RecordedBody) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		*b = RecordedBody(text)
+		return nil
+	}
+	var encoded struct {
+		Base64 string `json:"base64"`
+	}
+	if err := json.Unmarshal(data, &encoded); err != nil {
+		return err
+	}
+	raw, err := base64.StdEncoding.DecodeString(encoded.Base64)
+	*b = raw
+	return err
+}
+
+// RecorderMiddleware records HTTP interactions to a cassette file and replays them, so SDK tests
+// run without the vendor API. Use it as the last middleware so it sees requests as they are sent.
+//
+// Secrets are redacted before they are written: the Authorization, Cookie and Set-Cookie headers
+// and the access_token query parameter by default. Live requests are redacted the same way before
+// they are matched against the cassette.
+type RecorderMiddleware struct {
+	path         string
+	mode         RecorderMode
+	redactHeader map[string]bool
+	redactQuery  map[string]bool
+	ignoreQuery  map[string]bool
+	matchHeaders []string
+	matchBody    bool
+	redactFunc   func(*Interaction)
+
+	mu       sync.Mutex
+	cassette Cassette
+	used     []bool
+}
+
+type RecorderOption func(*RecorderMiddleware)
+
+// WithRedactHeaders redacts more request and response headers.
+func WithRedactHeaders(headers ...string) RecorderOption {
+	return func(m *RecorderMiddleware) {
+		for _, h := range headers {
+			m.redactHeader[http.CanonicalHeaderKey(h)] = true
+		}
+	}
+}
+
+// WithRedactQueryParams redacts more query parameters, e.g. sign or secret.
+func WithRedactQueryParams(params ...string) RecorderOption {
+	return func(m *RecorderMiddleware) {
+		for _, p := range params {
+			m.redactQuery[p] = true
+		}
+	}
+}
+
+// WithRedactFunc edits interactions before they are written, e.g. to mask secrets in bodies. In
+// replay mode it also edits live requests before matching, passed as an interaction with only the
+// request set, so masked values match whatever the secret is.
+func WithRedactFunc(fn func(*Interaction)) RecorderOption {
+	return func(m *RecorderMiddleware) {
+		m.redactFunc = fn
+	}
+}
+
+// WithIgnoreQueryParams leaves query parameters that change on every run, such as timestamps and
+// signatures, out of matching.
+func WithIgnoreQueryParams(params ...string) RecorderOption {
+	return func(m *RecorderMiddleware) {
+		for _, p := range params {
+			m.ignoreQuery[p] = true
+		}
+	}
+}
+
+// WithMatchHeaders requires the given request headers to match as well as method, URL and body.
+func WithMatchHeaders(headers ...string) RecorderOption {
+	return func(m *RecorderMiddleware) {
+		for _, h := range headers {
+			m.matchHeaders = append(m.matchHeaders, http.CanonicalHeaderKey(h))
+		}
+	}
+}
+
+// WithoutBodyMatching matches requests on method, URL and headers only. JSON bodies are otherwise
+// compared semantically and other bodies byte for byte.
+func WithoutBodyMatching() RecorderOption {
+	return func(m *RecorderMiddleware) {
+		m.matchBody = false
+	}
+}
+
+// NewRecorderMiddleware creates a recorder for the cassette at path. In ModeReplay the cassette
+// must exist.
+func NewRecorderMiddleware(path string, mode RecorderMode, opts ...RecorderOption) (*RecorderMiddleware, error) {
+	m := &RecorderMiddleware{
+		path:         path,
+		mode:         mode,
+		redactHeader: map[string]bool{"Authorization": true, "Cookie": true, "Set-Cookie": true, "Proxy-Authorization": true},
+		redactQuery:  map[string]bool{"access_token": true},
+		ignoreQuery:  map[string]bool{},
+		matchBody:    true,
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	if mode == ModeReplay {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("recorder: load cassette: %w", err)
+		}
+		if err := json.Unmarshal(data, &m.cassette); err != nil {
+			return nil, fmt.Errorf("recorder: decode cassette %s: %w", path, err)
+		}
+		m.used = make([]bool, len(m.cassette.Interactions))
+	}
+	return m, nil
+}
+
+func (m *RecorderMiddleware) Handle(ctx context.Context, req *http.Request, next rest.MiddlewareHandler) (*http.Response, error) {
+	switch m.mode {
+	case ModeReplay:
+		return m.replay(req)
+	case ModeRecord:
+		return m.record(ctx, req, next)
+	default:
+		return next(ctx, req)
+	}
+}
+
+func (m *RecorderMiddleware) record(ctx context.Context, req *http.Request, next rest.MiddlewareHandler) (*http.Response, error) {
+	reqBody, err := readBody(&req.Body)
+	if err != nil {
+		return nil, err
+	}
+	restoreBody(req, reqBody)
+
+	resp, err := next(ctx, req)
+	if err != nil {
+		return resp, err
+	}
+	respBody, err := readBody(&resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	interaction := Interaction{
+		Request: RecordedRequest{
+			Method:  req.Method,
+			URL:     m.redactURL(req.URL),
+			Headers: m.redactHeaders(req.Header),
+			Body:    reqBody,
+		},
+		Response: RecordedResponse{
+			StatusCode: resp.StatusCode,
+			Headers:    m.redactHeaders(resp.Header),
+			Body:       respBody,
+		},
+	}
+	if m.redactFunc != nil {
+		m.redactFunc(&interaction)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.cassette.Interactions = append(m.cassette.Interactions, interaction)
+	if err := m.save(); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (m *RecorderMiddleware) replay(req *http.Request) (*http.Response, error) {
+	body, err := readBody(&req.Body)
+	if err != nil {
+		return nil, err
+	}
+	live := RecordedRequest{
+		Method:  req.Method,
+		URL:     m.redactURL(req.URL),
+		Headers: m.redactHeaders(req.Header),
+		Body:    body,
+	}
+	if m.redactFunc != nil {
+		// The function sees an interaction as when recording, only its request is used for matching.
+		interaction := Interaction{Request: live}
+		m.redactFunc(&interaction)
+		live = interaction.Request
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var reasons []string
+	for i, interaction := range m.cassette.Interactions {
+		reason := m.mismatch(interaction.Request, live)
+		if reason == "" && m.used[i] {
+			reason = "already replayed"
+		}
+		if reason != "" {
+			reasons = append(reasons, fmt.Sprintf("#%d %s %s: %s", i, interaction.Request.Method, interaction.Request.URL, reason))
+			continue
+		}
+
+		m.used[i] = true
+		recorded := interaction.Response
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", recorded.StatusCode, http.StatusText(recorded.StatusCode)),
+			StatusCode:    recorded.StatusCode,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        recorded.Headers.Clone(),
+			Body:          io.NopCloser(bytes.NewReader(recorded.Body)),
+			ContentLength: int64(len(recorded.Body)),
+			Request:       req,
+		}, nil
+	}
+
+	msg := fmt.Sprintf("%s %s in cassette %s", live.Method, live.URL, m.path)
+	if len(reasons) > 0 {
+		msg += "; candidates:\n  " + strings.Join(reasons, "\n  ")
+	}
+	return nil, fmt.Errorf("%w: %s", ErrInteractionNotFound, msg)
+}
+
+// mismatch explains why a recorded request does not match the live one, or returns "".
+func (m *RecorderMiddleware) mismatch(recorded, live RecordedRequest) string {
+	if recorded.Method != live.Method {
+		return "method differs"
+	}
+	if reason := m.urlMismatch(recorded.URL, live.URL); reason != "" {
+		return reason
+	}
+	for _, h := range m.matchHeaders {
+		if strings.Join(recorded.Headers.Values(h), ",") != strings.Join(live.Headers.Values(h), ",") {
+			return fmt.Sprintf("header %s differs", h)
+		}
+	}
+	if m.matchBody && !bodiesEqual(recorded.Body, live.Body) {
+		return "body differs"
+	}
+	return ""
+}
+
+func (m *RecorderMiddleware) urlMismatch(recorded, live string) string {
+	ru, err := url.Parse(recorded)
+	if err != nil {
+		return "recorded url is invalid"
+	}
+	lu, err := url.Parse(live)
+	if err != nil {
+		return "url is invalid"
+	}
+	if ru.Scheme != lu.Scheme || ru.Host != lu.Host || ru.Path != lu.Path {
+		return "url differs"
+	}
+
+	rq, lq := ru.Query(), lu.Query()
+	keys := make(map[string]bool)
+	for k := range rq {
+		keys[k] = true
+	}
+	for k := range lq {
+		keys[k] = true
+	}
+	var differing []string
+	for k := range keys {
+		if m.ignoreQuery[k] {
+			continue
+		}
+		rv, lv := append([]string(nil), rq[k]...), append([]string(nil), lq[k]...)
+		sort.Strings(rv)
+		sort.Strings(lv)
+		if strings.Join(rv, "\x00") != strings.Join(lv, "\x00") {
+			differing = append(differing, k)
+		}
+	}
+	if len(differing) > 0 {
+		sort.Strings(differing)
+		return "query parameters differ: " + strings.Join(differing, ", ")
+	}
+	return ""
+}
+
+func bodiesEqual(a, b []byte) bool {
+	if bytes.Equal(a, b) {
+		return true
+	}
+	var av, bv any
+	if json.Unmarshal(a, &av) != nil || json.Unmarshal(b, &bv) != nil {
+		return false
+	}
+	an, _ := json.Marshal(av)
+	bn, _ := json.Marshal(bv)
+	return bytes.Equal(an, bn)
+}
+
+func (m *RecorderMiddleware) redactURL(u *url.URL) string {
+	redactedURL := *u
+	redactedURL.User = nil
+	query := redactedURL.Query()
+	changed := false
+	for k := range query {
+		if m.redactQuery[k] {
+			query[k] = []string{redacted}
+			changed = true
+		}
+	}
+	if changed {
+		redactedURL.RawQuery = query.Encode()
+	}
+	return redactedURL.String()
+}
+
+func (m *RecorderMiddleware) redactHeaders(header http.Header) http.Header {
+	if len(header) == 0 {
+		return nil
+	}
+	out := header.Clone()
+	for k := range out {
+		if m.redactHeader[http.CanonicalHeaderKey(k)] {
+			out[k] = []string{redacted}
+		}
+	}
+	return out
+}
+
+func (m *RecorderMiddleware) save() error {
+	data, err := json.MarshalIndent(m.cassette, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(m.path), 0o755); err != nil {
+		return fmt.Errorf("recorder: save cassette: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(m.path), ".cassette-*")
+	if err != nil {
+		return fmt.Errorf("recorder: save cassette: %w", err)
+	}
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return fmt.Errorf("recorder: save cassette: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("recorder: save cassette: %w", err)
+	}
+	return os.Rename(tmp.Name(), m.path)
+}
+
+// readBody reads and closes *body, leaving it nil.
+func readBody(body *io.ReadCloser) ([]byte, error) {
+	if *body == nil || *body == http.NoBody {
+		return nil, nil
+	}
+	data, err := io.ReadAll(*body)
+	(*body).Close()
+	*body = nil
+	if err != nil {
+		return nil, fmt.Errorf("recorder: read body: %w", err)
+	}
+	return data, nil
+}
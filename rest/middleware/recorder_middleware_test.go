@@ -0,0 +1,171 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/Lumiaqian/go-sdk-core/rest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newRecorderClient(t *testing.T, path string, mode RecorderMode, opts ...RecorderOption) rest.Client {
+	recorder, err := NewRecorderMiddleware(path, mode, opts...)
+	require.NoError(t, err)
+	client := rest.NewDefaultHttpClient()
+	client.Use(recorder)
+	return client
+}
+
+func TestRecorderMiddleware_RecordAndReplay(t *testing.T) {
+	var hits int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Set-Cookie", "session=abc")
+		switch r.URL.Path {
+		case "/user/get":
+			w.Write([]byte(`{"userid":"` + r.URL.Query().Get("userid") + `"}`))
+		case "/message/send":
+			w.Write([]byte(`{"errcode":0}`))
+		case "/avatar":
+			w.Write([]byte{0xff, 0xd8, 0xff, 0x00})
+		}
+	}))
+	path := filepath.Join(t.TempDir(), "testdata", "user.json")
+
+	recordClient := newRecorderClient(t, path, ModeRecord, WithRedactHeaders("X-Api-Key"))
+	calls := func(client rest.Client) []string {
+		var bodies []string
+		for _, call := range []struct {
+			method, url, body string
+		}{
+			{http.MethodGet, server.URL + "/user/get?userid=zhangsan&access_token=live-secret", ""},
+			{http.MethodGet, server.URL + "/user/get?access_token=live-secret&userid=lisi", ""},
+			{http.MethodPost, server.URL + "/message/send?access_token=live-secret", `{"touser":"zhangsan","msgtype":"text"}`},
+			{http.MethodGet, server.URL + "/avatar", ""},
+		} {
+			resp, err := client.DoRequest(context.Background(), call.method, call.url,
+				map[string]string{"Authorization": "Bearer live-secret", "X-Api-Key": "live-secret"},
+				&rest.RequestPayload{Body: strings.NewReader(call.body)})
+			require.NoError(t, err)
+			bodies = append(bodies, string(resp.Body))
+		}
+		return bodies
+	}
+	recorded := calls(recordClient)
+	assert.Equal(t, 4, hits)
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "live-secret")
+	assert.NotContains(t, string(data), "session=abc")
+	var cassette Cassette
+	require.NoError(t, json.Unmarshal(data, &cassette))
+	require.Len(t, cassette.Interactions, 4)
+	assert.Equal(t, []byte{0xff, 0xd8, 0xff, 0x00}, []byte(cassette.Interactions[3].Response.Body))
+
+	// Replay works without the server, whatever the current token is.
+	server.Close()
+	replayClient := newRecorderClient(t, path, ModeReplay)
+	assert.Equal(t, recorded, calls(replayClient))
+	assert.Equal(t, 4, hits)
+}
+
+func TestRecorderMiddleware_RedactFuncAppliesToReplay(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"access_token":"t"}`))
+	}))
+	defer server.Close()
+
+	secret := regexp.MustCompile(`"corpsecret":"[^"]*"`)
+	maskSecret := WithRedactFunc(func(i *Interaction) {
+		i.Request.Body = RecordedBody(secret.ReplaceAllString(string(i.Request.Body), `"corpsecret":"REDACTED"`))
+	})
+	path := filepath.Join(t.TempDir(), "token.json")
+	getToken := func(client rest.Client, corpSecret string) (*rest.HttpResponse, error) {
+		return client.DoRequest(context.Background(), http.MethodPost, server.URL+"/gettoken", nil,
+			&rest.RequestPayload{Body: strings.NewReader(`{"corpid":"ww1","corpsecret":"` + corpSecret + `"}`)})
+	}
+
+	_, err := getToken(newRecorderClient(t, path, ModeRecord, maskSecret), "recording-secret")
+	require.NoError(t, err)
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "recording-secret")
+
+	// A different secret on replay is masked the same way and still matches.
+	resp, err := getToken(newRecorderClient(t, path, ModeReplay, maskSecret), "ci-secret")
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"access_token":"t"}`, string(resp.Body))
+}
+
+func TestRecorderMiddleware_Matching(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	cassette := Cassette{Interactions: []Interaction{
+		{
+			Request:  RecordedRequest{Method: http.MethodPost, URL: "https://oapi.dingtalk.com/robot/send?sign=abc&timestamp=1", Headers: http.Header{"X-Tenant": {"t1"}}, Body: RecordedBody(`{"a":1,"b":2}`)},
+			Response: RecordedResponse{StatusCode: http.StatusOK, Body: RecordedBody(`first`)},
+		},
+		{
+			Request:  RecordedRequest{Method: http.MethodPost, URL: "https://oapi.dingtalk.com/robot/send?sign=abc&timestamp=1", Headers: http.Header{"X-Tenant": {"t1"}}, Body: RecordedBody(`{"a":1,"b":2}`)},
+			Response: RecordedResponse{StatusCode: http.StatusTooManyRequests, Body: RecordedBody(`second`)},
+		},
+	}}
+	data, err := json.Marshal(cassette)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, data, 0o644))
+
+	client := newRecorderClient(t, path, ModeReplay, WithIgnoreQueryParams("sign", "timestamp"), WithMatchHeaders("X-Tenant"))
+	send := func(tenant, body string) (*rest.HttpResponse, error) {
+		return client.DoRequest(context.Background(), http.MethodPost, "https://oapi.dingtalk.com/robot/send?timestamp=2&sign=xyz",
+			map[string]string{"X-Tenant": tenant}, &rest.RequestPayload{Body: strings.NewReader(body)})
+	}
+
+	_, err = send("t2", `{"a":1,"b":2}`)
+	assert.ErrorIs(t, err, ErrInteractionNotFound)
+	assert.ErrorContains(t, err, "header X-Tenant differs")
+
+	_, err = send("t1", `{"a":1,"b":3}`)
+	assert.ErrorContains(t, err, "body differs")
+
+	// JSON bodies match semantically and identical requests replay in recorded order.
+	resp, err := send("t1", `{"b":2, "a":1}`)
+	require.NoError(t, err)
+	assert.Equal(t, "first", string(resp.Body))
+	resp, err = send("t1", `{"a":1,"b":2}`)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+
+	_, err = send("t1", `{"a":1,"b":2}`)
+	assert.ErrorContains(t, err, "already replayed")
+
+	_, err = client.DoRequest(context.Background(), http.MethodPost, "https://oapi.dingtalk.com/robot/send?extra=1", map[string]string{"X-Tenant": "t1"}, &rest.RequestPayload{})
+	assert.ErrorContains(t, err, "query parameters differ: extra")
+}
+
+func TestRecorderMiddleware_Modes(t *testing.T) {
+	_, err := NewRecorderMiddleware(filepath.Join(t.TempDir(), "missing.json"), ModeReplay)
+	assert.Error(t, err)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("live"))
+	}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "passthrough.json")
+	client := newRecorderClient(t, path, ModePassthrough)
+	resp, err := client.DoRequest(context.Background(), http.MethodGet, server.URL, nil, &rest.RequestPayload{})
+	require.NoError(t, err)
+	assert.Equal(t, "live", string(resp.Body))
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,257 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Lumiaqian/go-sdk-core/rest"
+	"github.com/Lumiaqian/go-sdk-core/tools"
+)
+
+// Signer authenticates an outgoing request, typically by adding headers or query parameters. body is
+// the full request body, which the middleware has already read and restored.
+type Signer interface {
+	Sign(req *http.Request, body []byte) error
+}
+
+// SignerFunc adapts a function to the Signer interface.
+type SignerFunc func(req *http.Request, body []byte) error
+
+func (f SignerFunc) Sign(req *http.Request, body []byte) error {
+	return f(req, body)
+}
+
+// SigningMiddleware signs every request with a Signer before passing it on.
+type SigningMiddleware struct {
+	signer Signer
+}
+
+func NewSigningMiddleware(signer Signer) *SigningMiddleware {
+	return &SigningMiddleware{
+		signer: signer,
+	}
+}
+
+func (m *SigningMiddleware) Handle(ctx context.Context, req *http.Request, next rest.MiddlewareHandler) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil && req.Body != http.NoBody {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("sign request: read body: %w", err)
+		}
+	}
+
+	signed := req.Clone(ctx)
+	restoreBody(signed, body)
+	if err := m.signer.Sign(signed, body); err != nil {
+		return nil, fmt.Errorf("sign request: %w", err)
+	}
+	return next(ctx, signed)
+}
+
+func restoreBody(req *http.Request, body []byte) {
+	if body == nil {
+		return
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(body)), nil
+	}
+	req.ContentLength = int64(len(body))
+}
+
+// DingTalkSigner signs DingTalk robot webhook requests: it adds the millisecond timestamp and sign
+// query parameters, where sign is the base64 HMAC-SHA256 of timestamp + "\n" + secret.
+type DingTalkSigner struct {
+	secret string
+	now    func() time.Time
+}
+
+func NewDingTalkSigner(secret string) *DingTalkSigner {
+	return &DingTalkSigner{
+		secret: secret,
+		now:    time.Now,
+	}
+}
+
+func (s *DingTalkSigner) Sign(req *http.Request, body []byte) error {
+	if s.secret == "" {
+		return errors.New("dingtalk signer: secret cannot be empty")
+	}
+	timestamp := s.now().UnixMilli()
+
+	query := req.URL.Query()
+	query.Set("timestamp", strconv.FormatInt(timestamp, 10))
+	query.Set("sign", DingTalkSign(s.secret, timestamp))
+	req.URL.RawQuery = query.Encode()
+	return nil
+}
+
+// DingTalkSign computes the DingTalk signature for a millisecond timestamp. Callbacks from DingTalk
+// carry the same signature, so it can also be used to verify them.
+func DingTalkSign(secret string, timestampMillis int64) string {
+	stringToSign := strconv.FormatInt(timestampMillis, 10) + "\n" + secret
+	return base64.StdEncoding.EncodeToString(tools.HMACSHA256([]byte(secret), []byte(stringToSign)))
+}
+
+const (
+	defaultSigningAlgorithm = "HMAC-SHA256"
+	defaultTimestampHeader  = "X-Timestamp"
+	defaultNonceHeader      = "X-Nonce"
+	defaultContentHeader    = "X-Content-Sha256"
+)
+
+// CanonicalRequestSigner implements the canonical-request HMAC-SHA256 scheme used by Alibaba Cloud
+// ACS3 and many enterprise gateways. The canonical request is
+//
+//	METHOD
+//	PATH
+//	SORTED QUERY
+//	CANONICAL HEADERS (lower-case name:trimmed value + "\n" for each header, sorted)
+//	SIGNED HEADERS (lower-case names joined by ';')
+//	HEX(SHA256(BODY))
+//
+// joined by newlines, so an empty line separates the headers from the signed header names. The
+// string to sign is ALGORITHM + "\n" + HEX(SHA256(canonical request)), and the signature, the hex
+// HMAC-SHA256 of it, is sent as
+//
+//	Authorization: ALGORITHM Credential=KEY_ID,SignedHeaders=SIGNED HEADERS,Signature=SIGNATURE
+//
+// The host, timestamp, nonce and content hash headers are always signed.
+type CanonicalRequestSigner struct {
+	keyID           string
+	secret          []byte
+	algorithm       string
+	signedHeaders   []string
+	timestampHeader string
+	nonceHeader     string
+	contentHeader   string
+	now             func() time.Time
+	nonce           func() string
+}
+
+type CanonicalSignerOption func(*CanonicalRequestSigner)
+
+// WithAlgorithmName replaces HMAC-SHA256 as the algorithm name in the string to sign and the
+// Authorization header, e.g. ACS3-HMAC-SHA256.
+func WithAlgorithmName(name string) CanonicalSignerOption {
+	return func(s *CanonicalRequestSigner) {
+		s.algorithm = name
+	}
+}
+
+// WithSignedHeaders adds request headers, such as Content-Type, to the signature.
+func WithSignedHeaders(headers ...string) CanonicalSignerOption {
+	return func(s *CanonicalRequestSigner) {
+		s.signedHeaders = append(s.signedHeaders, headers...)
+	}
+}
+
+// WithSignatureHeaders renames the timestamp, nonce and content hash headers, by default X-Timestamp,
+// X-Nonce and X-Content-Sha256.
+func WithSignatureHeaders(timestamp, nonce, contentHash string) CanonicalSignerOption {
+	return func(s *CanonicalRequestSigner) {
+		s.timestampHeader = timestamp
+		s.nonceHeader = nonce
+		s.contentHeader = contentHash
+	}
+}
+
+func NewCanonicalRequestSigner(keyID string, secret []byte, opts ...CanonicalSignerOption) *CanonicalRequestSigner {
+	s := &CanonicalRequestSigner{
+		keyID:           keyID,
+		secret:          secret,
+		algorithm:       defaultSigningAlgorithm,
+		timestampHeader: defaultTimestampHeader,
+		nonceHeader:     defaultNonceHeader,
+		contentHeader:   defaultContentHeader,
+		now:             time.Now,
+		nonce:           randomNonce,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+func (s *CanonicalRequestSigner) Sign(req *http.Request, body []byte) error {
+	if len(s.secret) == 0 {
+		return errors.New("canonical signer: secret cannot be empty")
+	}
+
+	bodyHash := tools.HashBody(body)
+	req.Header.Set(s.timestampHeader, s.now().UTC().Format(time.RFC3339))
+	req.Header.Set(s.nonceHeader, s.nonce())
+	req.Header.Set(s.contentHeader, bodyHash)
+
+	canonicalHeaders, signedHeaders := s.canonicalHeaders(req)
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		canonicalPath(req),
+		tools.CanonicalQuery(req.URL.Query()),
+		canonicalHeaders,
+		signedHeaders,
+		bodyHash,
+	}, "\n")
+
+	stringToSign := s.algorithm + "\n" + tools.HashBody([]byte(canonicalRequest))
+	signature := hex.EncodeToString(tools.HMACSHA256(s.secret, []byte(stringToSign)))
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s,SignedHeaders=%s,Signature=%s",
+		s.algorithm, s.keyID, signedHeaders, signature))
+	return nil
+}
+
+func (s *CanonicalRequestSigner) canonicalHeaders(req *http.Request) (string, string) {
+	values := map[string]string{"host": requestHost(req)}
+	for _, name := range append([]string{s.timestampHeader, s.nonceHeader, s.contentHeader}, s.signedHeaders...) {
+		values[strings.ToLower(name)] = strings.TrimSpace(strings.Join(req.Header.Values(name), ","))
+	}
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for _, name := range names {
+		b.WriteString(name)
+		b.WriteByte(':')
+		b.WriteString(values[name])
+		b.WriteByte('\n')
+	}
+	return b.String(), strings.Join(names, ";")
+}
+
+func canonicalPath(req *http.Request) string {
+	if path := req.URL.EscapedPath(); path != "" {
+		return path
+	}
+	return "/"
+}
+
+func requestHost(req *http.Request) string {
+	if req.Host != "" {
+		return req.Host
+	}
+	return req.URL.Host
+}
+
+func randomNonce() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
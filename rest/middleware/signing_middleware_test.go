@@ -0,0 +1,111 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Lumiaqian/go-sdk-core/rest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// The expected value comes from the Python sample of the DingTalk robot documentation:
+// quote_plus(b64encode(hmac.new(secret, f"{timestamp}\n{secret}", sha256).digest())).
+func TestDingTalkSign(t *testing.T) {
+	assert.Equal(t, "RqBq3E1RTBDv3n2QBCh4adZ2WHk9mVklyUoDBLxarjI=", DingTalkSign("SEC1234567890abcdef", 1700000000000))
+}
+
+func TestSigningMiddleware_DingTalk(t *testing.T) {
+	var query string
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.RawQuery
+		body, _ = io.ReadAll(r.Body)
+	}))
+	defer server.Close()
+
+	signer := NewDingTalkSigner("SEC1234567890abcdef")
+	signer.now = func() time.Time { return time.UnixMilli(1700000000000) }
+	client := rest.NewDefaultHttpClient()
+	client.Use(NewSigningMiddleware(signer))
+
+	_, err := client.DoRequest(context.Background(), http.MethodPost, server.URL+"/robot/send?access_token=abc",
+		map[string]string{"Content-Type": "application/json"}, &rest.RequestPayload{Body: strings.NewReader(`{"msgtype":"text"}`)})
+	require.NoError(t, err)
+
+	assert.Equal(t, "access_token=abc&sign=RqBq3E1RTBDv3n2QBCh4adZ2WHk9mVklyUoDBLxarjI%3D&timestamp=1700000000000", query)
+	assert.Equal(t, `{"msgtype":"text"}`, string(body))
+}
+
+// The request, keys and signature are the worked example of the Alibaba Cloud V3 (ACS3) signature documentation.
+func TestCanonicalRequestSigner_ACS3Example(t *testing.T) {
+	signer := NewCanonicalRequestSigner("YourAccessKeyId", []byte("YourAccessKeySecret"),
+		WithAlgorithmName("ACS3-HMAC-SHA256"),
+		WithSignatureHeaders("x-acs-date", "x-acs-signature-nonce", "x-acs-content-sha256"),
+		WithSignedHeaders("x-acs-action", "x-acs-version"))
+	signer.now = func() time.Time { return time.Date(2023, 10, 26, 10, 22, 32, 0, time.UTC) }
+	signer.nonce = func() string { return "3156853299f313e23d1673dc12e1703d" }
+
+	req, err := http.NewRequest(http.MethodPost,
+		"https://ecs.cn-shanghai.aliyuncs.com/?ImageId=win2019_1809_x64_dtc_zh-cn_40G_alibase_20230811.vhd&RegionId=cn-shanghai", nil)
+	require.NoError(t, err)
+	req.Header.Set("x-acs-action", "RunInstances")
+	req.Header.Set("x-acs-version", "2014-05-26")
+
+	require.NoError(t, signer.Sign(req, nil))
+	assert.Equal(t, "ACS3-HMAC-SHA256 Credential=YourAccessKeyId,"+
+		"SignedHeaders=host;x-acs-action;x-acs-content-sha256;x-acs-date;x-acs-signature-nonce;x-acs-version,"+
+		"Signature=06563a9e1b43f5dfe96b81484da74bceab24a1d853912eee15083a6f0f3283c0", req.Header.Get("Authorization"))
+}
+
+func TestSigningMiddleware_CanonicalRequest(t *testing.T) {
+	var header http.Header
+	var body []byte
+	var next rest.MiddlewareHandler = func(ctx context.Context, req *http.Request) (*http.Response, error) {
+		header = req.Header
+		body, _ = io.ReadAll(req.Body)
+		return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+	}
+
+	signer := NewCanonicalRequestSigner("key-id", []byte("secret"), WithSignedHeaders("Content-Type"))
+	signer.now = func() time.Time { return time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC) }
+	signer.nonce = func() string { return "n0nce" }
+
+	req, err := http.NewRequest(http.MethodPost, "https://api.example.com/v1/items?c=~&b=x+y&a=2&a=1", strings.NewReader(`{"name":"demo"}`))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+
+	_, err = NewSigningMiddleware(signer).Handle(context.Background(), req, next)
+	require.NoError(t, err)
+
+	assert.Equal(t, "2024-01-02T03:04:05Z", header.Get("X-Timestamp"))
+	assert.Equal(t, "n0nce", header.Get("X-Nonce"))
+	assert.Equal(t, "HMAC-SHA256 Credential=key-id,SignedHeaders=content-type;host;x-content-sha256;x-nonce;x-timestamp,"+
+		"Signature=a21fbc154cec4c4746d95cfd79a30c56f7695fab62fe3d07135f85af20d5bf83", header.Get("Authorization"))
+	assert.Equal(t, `{"name":"demo"}`, string(body))
+	// The caller's request is left untouched.
+	assert.Empty(t, req.Header.Get("Authorization"))
+}
+
+func TestSigningMiddleware_SignerError(t *testing.T) {
+	m := NewSigningMiddleware(SignerFunc(func(req *http.Request, body []byte) error {
+		return errors.New("no credentials")
+	}))
+	req := httptest.NewRequest(http.MethodGet, "https://api.example.com/", nil)
+
+	_, err := m.Handle(context.Background(), req, func(ctx context.Context, req *http.Request) (*http.Response, error) {
+		t.Fatal("next must not be called")
+		return nil, nil
+	})
+	assert.EqualError(t, err, "sign request: no credentials")
+
+	err = NewCanonicalRequestSigner("key-id", nil).Sign(req, nil)
+	assert.Error(t, err)
+}
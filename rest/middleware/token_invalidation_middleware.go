@@ -0,0 +1,104 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/Lumiaqian/go-sdk-core/log"
+	"github.com/Lumiaqian/go-sdk-core/rest"
+	"github.com/Lumiaqian/go-sdk-core/token"
+)
+
+// ErrorCodeDecoder extracts the vendor error code from a response body.
+type ErrorCodeDecoder func(body []byte) (code int, ok bool)
+
+// TokenExtractor returns the access token a request was sent with.
+type TokenExtractor func(req *http.Request) string
+
+// JSONErrorCode decodes an integer error code from the given top level JSON field, e.g. "errcode".
+func JSONErrorCode(field string) ErrorCodeDecoder {
+	return func(body []byte) (int, bool) {
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(body, &fields); err != nil {
+			return 0, false
+		}
+		raw, ok := fields[field]
+		if !ok {
+			return 0, false
+		}
+		var code int
+		if err := json.Unmarshal(raw, &code); err != nil {
+			return 0, false
+		}
+		return code, true
+	}
+}
+
+// QueryOrBearerToken reads the access_token query parameter, falling back to an Authorization bearer token.
+func QueryOrBearerToken(req *http.Request) string {
+	if t := req.URL.Query().Get("access_token"); t != "" {
+		return t
+	}
+	auth := req.Header.Get("Authorization")
+	if len(auth) > 7 && strings.EqualFold(auth[:7], "bearer ") {
+		return auth[7:]
+	}
+	return ""
+}
+
+// TokenInvalidationMiddleware decodes error codes from responses and passes them with the
+// request token to an invalidation hook, so rejected tokens are evicted before the caller retries.
+type TokenInvalidationMiddleware struct {
+	hook      token.InvalidationHook
+	decoder   ErrorCodeDecoder
+	extractor TokenExtractor
+	logger    log.Logger
+}
+
+func NewTokenInvalidationMiddleware(hook token.InvalidationHook, decoder ErrorCodeDecoder, extractor TokenExtractor, logger log.Logger) *TokenInvalidationMiddleware {
+	if decoder == nil {
+		decoder = JSONErrorCode("errcode")
+	}
+	if extractor == nil {
+		extractor = QueryOrBearerToken
+	}
+	return &TokenInvalidationMiddleware{
+		hook:      hook,
+		decoder:   decoder,
+		extractor: extractor,
+		logger:    logger,
+	}
+}
+
+func (m *TokenInvalidationMiddleware) Handle(ctx context.Context, req *http.Request, next rest.MiddlewareHandler) (*http.Response, error) {
+	resp, err := next(ctx, req)
+	if err != nil || resp == nil {
+		return resp, err
+	}
+
+	tok := m.extractor(req)
+	if tok == "" {
+		return resp, nil
+	}
+
+	bodyBytes, readErr := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
+	if readErr != nil {
+		return resp, readErr
+	}
+
+	code, ok := m.decoder(bodyBytes)
+	if !ok {
+		return resp, nil
+	}
+	if hookErr := m.hook(ctx, tok, code); hookErr != nil && m.logger != nil {
+		m.logger.Log(ctx, log.WARN, "msg", "token invalidation failed", "errcode", code, "error", hookErr)
+	}
+
+	return resp, nil
+}
@@ -0,0 +1,93 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Lumiaqian/go-sdk-core/cache"
+	"github.com/Lumiaqian/go-sdk-core/rest"
+	"github.com/Lumiaqian/go-sdk-core/token"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type staticFetcher struct {
+	token string
+}
+
+func (f *staticFetcher) FetchToken(ctx context.Context) (string, int64, error) {
+	return f.token, 7200, nil
+}
+
+func (f *staticFetcher) GenerateCacheKey() string {
+	return "static_token"
+}
+
+func TestTokenInvalidationMiddleware(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("access_token") == "expired" {
+			w.Write([]byte(`{"errcode":42001,"errmsg":"access_token expired"}`))
+			return
+		}
+		w.Write([]byte(`{"errcode":0,"errmsg":"ok"}`))
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	memcache := cache.NewMemcache(time.Minute, time.Minute)
+	fetcher := &staticFetcher{token: "expired"}
+	provider := token.NewDefaultTokenProvider(memcache, fetcher)
+
+	client := rest.NewDefaultHttpClient()
+	client.Use(NewTokenInvalidationMiddleware(token.InvalidateOnCodes(provider, 40001, 42001), nil, nil, nil))
+
+	tok, err := provider.GetAccessToken(ctx)
+	require.NoError(t, err)
+
+	resp, err := client.DoRequest(ctx, http.MethodGet, server.URL+"?access_token="+tok, nil, &rest.RequestPayload{})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"errcode":42001,"errmsg":"access_token expired"}`, string(resp.Body))
+
+	// The rejected token was evicted, so the next call fetches a new one.
+	_, err = memcache.Get(ctx, "static_token")
+	assert.Error(t, err)
+
+	fetcher.token = "fresh"
+	tok, err = provider.GetAccessToken(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "fresh", tok)
+
+	_, err = client.DoRequest(ctx, http.MethodGet, server.URL+"?access_token="+tok, nil, &rest.RequestPayload{})
+	require.NoError(t, err)
+	cached, err := memcache.Get(ctx, "static_token")
+	require.NoError(t, err)
+	assert.Equal(t, "fresh", cached)
+}
+
+func TestTokenInvalidationMiddleware_HookError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"code":40001}`))
+	}))
+	defer server.Close()
+
+	var gotToken string
+	var gotCode int
+	hook := func(ctx context.Context, token string, errCode int) error {
+		gotToken, gotCode = token, errCode
+		return errors.New("cache down")
+	}
+
+	client := rest.NewDefaultHttpClient()
+	client.Use(NewTokenInvalidationMiddleware(hook, JSONErrorCode("code"), nil, nil))
+
+	resp, err := client.DoRequest(context.Background(), http.MethodGet, server.URL, map[string]string{"Authorization": "Bearer abc"}, &rest.RequestPayload{})
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "abc", gotToken)
+	assert.Equal(t, 40001, gotCode)
+}
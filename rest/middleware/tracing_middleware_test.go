@@ -0,0 +1,77 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Lumiaqian/go-sdk-core/rest"
+	"github.com/Lumiaqian/go-sdk-core/trace"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTracingMiddleware(t *testing.T) {
+	var traceparent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	exporter := trace.NewInMemoryExporter()
+	tracer := trace.NewTracer(exporter)
+	client := rest.NewDefaultHttpClient()
+	client.Use(NewTracingMiddleware(tracer))
+
+	ctx, parent := tracer.Start(context.Background(), "handle_callback")
+	_, err := client.DoRequest(ctx, http.MethodGet, server.URL+"/users?access_token=secret", nil, &rest.RequestPayload{})
+	require.NoError(t, err)
+	parent.End()
+
+	spans := exporter.Spans()
+	require.Len(t, spans, 2)
+	span := spans[0]
+	assert.Equal(t, "HTTP GET", span.Name)
+	assert.Equal(t, trace.SpanKindClient, span.Kind)
+	assert.Equal(t, parent.SpanContext().SpanID, span.Parent.SpanID)
+	assert.Equal(t, trace.FormatTraceparent(span.SpanContext), traceparent)
+	assert.Equal(t, trace.StatusUnset, span.Status)
+
+	url, _ := span.Attribute("url.full")
+	assert.Equal(t, server.URL+"/users", url)
+	method, _ := span.Attribute("http.request.method")
+	assert.Equal(t, http.MethodGet, method)
+	status, _ := span.Attribute("http.response.status_code")
+	assert.Equal(t, http.StatusOK, status)
+	_, ok := span.Attribute("server.port")
+	assert.True(t, ok)
+
+	exporter.Reset()
+	_, err = client.DoRequest(context.Background(), http.MethodGet, server.URL+"/missing", nil, &rest.RequestPayload{})
+	require.NoError(t, err)
+	require.Len(t, exporter.Spans(), 1)
+	assert.Equal(t, trace.StatusError, exporter.Spans()[0].Status)
+	assert.False(t, exporter.Spans()[0].Parent.IsValid())
+}
+
+func TestTracingMiddleware_TransportError(t *testing.T) {
+	exporter := trace.NewInMemoryExporter()
+	client := rest.NewDefaultHttpClient()
+	client.Use(NewTracingMiddleware(trace.NewTracer(exporter), WithSpanName(func(req *http.Request) string {
+		return "vendor " + req.URL.Path
+	})))
+
+	_, err := client.DoRequest(context.Background(), http.MethodGet, "http://127.0.0.1:1/token", nil, &rest.RequestPayload{})
+	require.Error(t, err)
+
+	spans := exporter.Spans()
+	require.Len(t, spans, 1)
+	assert.Equal(t, "vendor /token", spans[0].Name)
+	assert.Equal(t, trace.StatusError, spans[0].Status)
+	assert.Len(t, spans[0].Errors, 1)
+}
@@ -0,0 +1,382 @@
+package rest
+
+import (
+	"context"
+	"iter"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// PageRequest describes the page to fetch. Strategies fill in the fields they use.
+type PageRequest struct {
+	Offset int
+	Limit  int
+	// Page is the page number, starting at the first page of the strategy.
+	Page   int
+	Cursor string
+	// URL is the page URL for LinkPaging.
+	URL string
+}
+
+// PageInfo is what strategies need from a response to request the next page.
+type PageInfo struct {
+	// Last marks the final page, e.g. when the API reports has_more=false. When false the strategy
+	// decides from the other fields.
+	Last bool
+	// NextCursor is the cursor of the next page for CursorPaging.
+	NextCursor string
+	// Total is the total number of items, if the API reports it.
+	Total int
+	// Header is the response header, LinkPaging reads the Link header from it.
+	Header http.Header
+}
+
+// Page is one page of results.
+type Page[T any] struct {
+	Items []T
+	PageInfo
+}
+
+// PageFunc fetches one page, typically with a Client.DoRequest call built from req.
+type PageFunc[T any] func(ctx context.Context, req PageRequest) (*Page[T], error)
+
+// PageStrategy decides which page comes next.
+type PageStrategy interface {
+	First() PageRequest
+	// Next returns the request following req, whose page had count items, or false after the last page.
+	Next(req PageRequest, count int, info PageInfo) (PageRequest, bool)
+}
+
+// predictableStrategy is implemented by strategies that know the next request without the
+// previous response, which allows fetching several pages concurrently.
+type predictableStrategy interface {
+	Advance(req PageRequest) PageRequest
+}
+
+type offsetPaging struct {
+	limit int
+}
+
+// OffsetPaging requests limit items at increasing offsets. It stops at a short page, at Total or when
+// a page is marked Last.
+func OffsetPaging(limit int) PageStrategy {
+	return offsetPaging{limit: limit}
+}
+
+func (s offsetPaging) First() PageRequest {
+	return PageRequest{Offset: 0, Limit: s.limit}
+}
+
+func (s offsetPaging) Next(req PageRequest, count int, info PageInfo) (PageRequest, bool) {
+	if info.Last || count == 0 || count < req.Limit || (info.Total > 0 && req.Offset+count >= info.Total) {
+		return PageRequest{}, false
+	}
+	return s.Advance(req), true
+}
+
+func (s offsetPaging) Advance(req PageRequest) PageRequest {
+	return PageRequest{Offset: req.Offset + req.Limit, Limit: req.Limit}
+}
+
+type pageNumberPaging struct {
+	size  int
+	first int
+}
+
+// PageNumberPaging requests pages of size items numbered from firstPage, usually 0 or 1. It stops like
+// OffsetPaging.
+func PageNumberPaging(size, firstPage int) PageStrategy {
+	return pageNumberPaging{size: size, first: firstPage}
+}
+
+func (s pageNumberPaging) First() PageRequest {
+	return PageRequest{Page: s.first, Limit: s.size}
+}
+
+func (s pageNumberPaging) Next(req PageRequest, count int, info PageInfo) (PageRequest, bool) {
+	if info.Last || count == 0 || count < req.Limit || (info.Total > 0 && req.Offset+count >= info.Total) {
+		return PageRequest{}, false
+	}
+	return s.Advance(req), true
+}
+
+func (s pageNumberPaging) Advance(req PageRequest) PageRequest {
+	return PageRequest{Page: req.Page + 1, Limit: req.Limit, Offset: req.Offset + req.Limit}
+}
+
+type cursorPaging struct {
+	limit int
+}
+
+// CursorPaging passes the NextCursor of each page to the next request and stops when it is empty,
+// unchanged or the page is marked Last. limit is passed through as PageRequest.Limit.
+func CursorPaging(limit int) PageStrategy {
+	return cursorPaging{limit: limit}
+}
+
+func (s cursorPaging) First() PageRequest {
+	return PageRequest{Limit: s.limit}
+}
+
+func (s cursorPaging) Next(req PageRequest, count int, info PageInfo) (PageRequest, bool) {
+	if info.Last || info.NextCursor == "" || info.NextCursor == req.Cursor {
+		return PageRequest{}, false
+	}
+	return PageRequest{Cursor: info.NextCursor, Limit: req.Limit}, true
+}
+
+type linkPaging struct {
+	firstURL string
+}
+
+// LinkPaging follows the rel="next" URL of the RFC 8288 Link response header, as used by GitHub and
+// GitLab, starting at firstURL.
+func LinkPaging(firstURL string) PageStrategy {
+	return linkPaging{firstURL: firstURL}
+}
+
+func (s linkPaging) First() PageRequest {
+	return PageRequest{URL: s.firstURL}
+}
+
+func (s linkPaging) Next(req PageRequest, count int, info PageInfo) (PageRequest, bool) {
+	next := nextLink(info.Header)
+	if info.Last || next == "" {
+		return PageRequest{}, false
+	}
+	// Resolve relative links against the current page.
+	if base, err := url.Parse(req.URL); err == nil {
+		if ref, err := url.Parse(next); err == nil {
+			next = base.ResolveReference(ref).String()
+		}
+	}
+	if next == req.URL {
+		return PageRequest{}, false
+	}
+	return PageRequest{URL: next}, true
+}
+
+// nextLink returns the target of the rel="next" link in header.
+func nextLink(header http.Header) string {
+	for _, value := range header.Values("Link") {
+		for _, link := range strings.Split(value, ",") {
+			parts := strings.Split(link, ";")
+			target := strings.TrimSpace(parts[0])
+			if !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+				continue
+			}
+			for _, param := range parts[1:] {
+				name, rel, ok := strings.Cut(strings.TrimSpace(param), "=")
+				if !ok || !strings.EqualFold(name, "rel") {
+					continue
+				}
+				for _, r := range strings.Fields(strings.Trim(rel, `"`)) {
+					if strings.EqualFold(r, "next") {
+						return target[1 : len(target)-1]
+					}
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// Paginator walks a paginated list API page by page.
+type Paginator[T any] struct {
+	fetch    PageFunc[T]
+	strategy PageStrategy
+	config   paginatorConfig
+}
+
+type paginatorConfig struct {
+	prefetch int
+	maxPages int
+}
+
+type PaginatorOption func(*paginatorConfig)
+
+// WithPrefetch fetches up to n pages ahead of the consumer. With OffsetPaging and PageNumberPaging
+// the pages are fetched concurrently, the other strategies fetch the next page while the current
+// one is consumed.
+func WithPrefetch(n int) PaginatorOption {
+	return func(c *paginatorConfig) {
+		c.prefetch = n
+	}
+}
+
+// WithMaxPages stops after n pages, guarding against APIs that never report the last page.
+func WithMaxPages(n int) PaginatorOption {
+	return func(c *paginatorConfig) {
+		c.maxPages = n
+	}
+}
+
+func NewPaginator[T any](fetch PageFunc[T], strategy PageStrategy, opts ...PaginatorOption) *Paginator[T] {
+	p := &Paginator[T]{
+		fetch:    fetch,
+		strategy: strategy,
+	}
+	for _, opt := range opts {
+		opt(&p.config)
+	}
+	return p
+}
+
+// Pages iterates over the pages. An error, including the cancellation of ctx, is yielded once with
+// a nil page and ends the iteration.
+func (p *Paginator[T]) Pages(ctx context.Context) iter.Seq2[*Page[T], error] {
+	return func(yield func(*Page[T], error) bool) {
+		if p.config.prefetch > 0 {
+			p.prefetchPages(ctx, yield)
+			return
+		}
+
+		req := p.strategy.First()
+		for n := 1; ; n++ {
+			if err := ctx.Err(); err != nil {
+				yield(nil, err)
+				return
+			}
+			page, err := p.fetchPage(ctx, req)
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+			if !yield(page, nil) {
+				return
+			}
+			next, ok := p.strategy.Next(req, len(page.Items), page.PageInfo)
+			if !ok || n == p.config.maxPages {
+				return
+			}
+			req = next
+		}
+	}
+}
+
+// Items iterates over the items of all pages. Errors are yielded like in Pages.
+func (p *Paginator[T]) Items(ctx context.Context) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		for page, err := range p.Pages(ctx) {
+			if err != nil {
+				var zero T
+				yield(zero, err)
+				return
+			}
+			for _, item := range page.Items {
+				if !yield(item, nil) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// All collects the items of all pages. On error it returns the items collected so far.
+func (p *Paginator[T]) All(ctx context.Context) ([]T, error) {
+	var items []T
+	for page, err := range p.Pages(ctx) {
+		if err != nil {
+			return items, err
+		}
+		items = append(items, page.Items...)
+	}
+	return items, nil
+}
+
+func (p *Paginator[T]) fetchPage(ctx context.Context, req PageRequest) (*Page[T], error) {
+	page, err := p.fetch(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if page == nil {
+		page = &Page[T]{PageInfo: PageInfo{Last: true}}
+	}
+	return page, nil
+}
+
+type pageResult[T any] struct {
+	req  PageRequest
+	page *Page[T]
+	err  error
+}
+
+// prefetchPages runs a producer that keeps up to prefetch pages ready in order. Each page gets a
+// slot, which lets concurrent fetches of predictable strategies complete out of order. The producer
+// and its fetches are cancelled and waited for before prefetchPages returns, so the PageFunc is
+// never called once the loop is over.
+func (p *Paginator[T]) prefetchPages(parent context.Context, yield func(*Page[T], error) bool) {
+	ctx, cancel := context.WithCancel(parent)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	defer cancel()
+
+	slots := make(chan chan pageResult[T], p.config.prefetch)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(slots)
+		predictable, concurrent := p.strategy.(predictableStrategy)
+		req := p.strategy.First()
+		for n := 1; p.config.maxPages <= 0 || n <= p.config.maxPages; n++ {
+			slot := make(chan pageResult[T], 1)
+			if concurrent {
+				select {
+				case slots <- slot:
+				case <-ctx.Done():
+					return
+				}
+				wg.Add(1)
+				go func(req PageRequest) {
+					defer wg.Done()
+					page, err := p.fetchPage(ctx, req)
+					slot <- pageResult[T]{req: req, page: page, err: err}
+				}(req)
+				req = predictable.Advance(req)
+				continue
+			}
+
+			page, err := p.fetchPage(ctx, req)
+			slot <- pageResult[T]{req: req, page: page, err: err}
+			select {
+			case slots <- slot:
+			case <-ctx.Done():
+				return
+			}
+			if err != nil {
+				return
+			}
+			next, ok := p.strategy.Next(req, len(page.Items), page.PageInfo)
+			if !ok {
+				return
+			}
+			req = next
+		}
+	}()
+
+	for slot := range slots {
+		var result pageResult[T]
+		select {
+		case result = <-slot:
+		case <-ctx.Done():
+			yield(nil, ctx.Err())
+			return
+		}
+		if result.err != nil {
+			yield(nil, result.err)
+			return
+		}
+		if !yield(result.page, nil) {
+			return
+		}
+		// Concurrent producers run past the last page, stop at it here.
+		if _, ok := p.strategy.Next(result.req, len(result.page.Items), result.page.PageInfo); !ok {
+			return
+		}
+	}
+	if err := parent.Err(); err != nil {
+		yield(nil, err)
+	}
+}
@@ -0,0 +1,256 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func numbers(n int) []int {
+	items := make([]int, n)
+	for i := range items {
+		items[i] = i
+	}
+	return items
+}
+
+// offsetSource serves a slice the way an offset/size list API does.
+func offsetSource(items []int, requests *[]PageRequest) PageFunc[int] {
+	var mu sync.Mutex
+	return func(ctx context.Context, req PageRequest) (*Page[int], error) {
+		mu.Lock()
+		*requests = append(*requests, req)
+		mu.Unlock()
+
+		start := min(req.Offset, len(items))
+		end := min(start+req.Limit, len(items))
+		return &Page[int]{Items: items[start:end]}, nil
+	}
+}
+
+func TestPaginator_Offset(t *testing.T) {
+	var requests []PageRequest
+	all, err := NewPaginator(offsetSource(numbers(25), &requests), OffsetPaging(10)).All(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, numbers(25), all)
+	assert.Equal(t, []PageRequest{{Offset: 0, Limit: 10}, {Offset: 10, Limit: 10}, {Offset: 20, Limit: 10}}, requests)
+
+	// An exact multiple needs one empty page to find the end.
+	requests = nil
+	all, err = NewPaginator(offsetSource(numbers(20), &requests), OffsetPaging(10)).All(context.Background())
+	require.NoError(t, err)
+	assert.Len(t, all, 20)
+	assert.Len(t, requests, 3)
+}
+
+func TestPaginator_PageNumberWithTotal(t *testing.T) {
+	items := numbers(20)
+	var pages []int
+	fetch := func(ctx context.Context, req PageRequest) (*Page[int], error) {
+		pages = append(pages, req.Page)
+		start := (req.Page - 1) * req.Limit
+		return &Page[int]{Items: items[start : start+req.Limit], PageInfo: PageInfo{Total: len(items)}}, nil
+	}
+
+	all, err := NewPaginator(fetch, PageNumberPaging(10, 1)).All(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, items, all)
+	assert.Equal(t, []int{1, 2}, pages)
+}
+
+func TestPaginator_Cursor(t *testing.T) {
+	pages := map[string]Page[string]{
+		"":   {Items: []string{"a", "b"}, PageInfo: PageInfo{NextCursor: "c1"}},
+		"c1": {Items: []string{"c", "d"}, PageInfo: PageInfo{NextCursor: "c2"}},
+		"c2": {Items: []string{"e"}, PageInfo: PageInfo{NextCursor: "c3", Last: true}},
+	}
+	fetch := func(ctx context.Context, req PageRequest) (*Page[string], error) {
+		assert.Equal(t, 2, req.Limit)
+		page := pages[req.Cursor]
+		return &page, nil
+	}
+
+	var got []string
+	for item, err := range NewPaginator(fetch, CursorPaging(2)).Items(context.Background()) {
+		require.NoError(t, err)
+		got = append(got, item)
+	}
+	assert.Equal(t, []string{"a", "b", "c", "d", "e"}, got)
+}
+
+func TestPaginator_LinkHeader(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		if page < 3 {
+			w.Header().Set("Link", `</repos?page=`+strconv.Itoa(page+1)+`>; rel="next", </repos?page=3>; rel="last"`)
+		}
+		json.NewEncoder(w).Encode([]int{page})
+	}))
+	defer server.Close()
+
+	client := NewDefaultHttpClient()
+	fetch := func(ctx context.Context, req PageRequest) (*Page[int], error) {
+		resp, err := client.DoRequest(ctx, http.MethodGet, req.URL, nil, &RequestPayload{})
+		if err != nil {
+			return nil, err
+		}
+		page := &Page[int]{PageInfo: PageInfo{Header: resp.Headers}}
+		return page, json.Unmarshal(resp.Body, &page.Items)
+	}
+
+	all, err := NewPaginator(fetch, LinkPaging(server.URL+"/repos?page=1")).All(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []int{1, 2, 3}, all)
+}
+
+func TestNextLink(t *testing.T) {
+	header := http.Header{}
+	header.Add("Link", `<https://api.example.com/items?page=1>; rel="prev first", <https://api.example.com/items?page=3>; rel="next"`)
+	assert.Equal(t, "https://api.example.com/items?page=3", nextLink(header))
+	assert.Equal(t, "", nextLink(http.Header{"Link": {`<https://api.example.com/items?page=1>; rel="prev"`}}))
+}
+
+func TestPaginator_Prefetch(t *testing.T) {
+	var inFlight, maxInFlight atomic.Int32
+	items := numbers(95)
+	fetch := func(ctx context.Context, req PageRequest) (*Page[int], error) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			m := maxInFlight.Load()
+			if n <= m || maxInFlight.CompareAndSwap(m, n) {
+				break
+			}
+		}
+		// Later pages answer first to check that order is kept.
+		time.Sleep(time.Duration(100-req.Offset/10) * 100 * time.Microsecond)
+		start := min(req.Offset, len(items))
+		return &Page[int]{Items: items[start:min(start+req.Limit, len(items))]}, nil
+	}
+
+	all, err := NewPaginator(fetch, OffsetPaging(10), WithPrefetch(3)).All(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, items, all)
+	assert.LessOrEqual(t, maxInFlight.Load(), int32(4))
+	assert.Greater(t, maxInFlight.Load(), int32(1))
+
+	// Sequential strategies prefetch too.
+	pages := map[string]Page[int]{"": {Items: []int{1}, PageInfo: PageInfo{NextCursor: "x"}}, "x": {Items: []int{2}}}
+	cursorFetch := func(ctx context.Context, req PageRequest) (*Page[int], error) {
+		page := pages[req.Cursor]
+		return &page, nil
+	}
+	all, err = NewPaginator(cursorFetch, CursorPaging(1), WithPrefetch(2)).All(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []int{1, 2}, all)
+}
+
+func TestPaginator_PrefetchStopsWithLoop(t *testing.T) {
+	items := numbers(1000)
+	var calls, running atomic.Int32
+	fetch := func(ctx context.Context, req PageRequest) (*Page[int], error) {
+		calls.Add(1)
+		running.Add(1)
+		defer running.Add(-1)
+		select {
+		case <-time.After(time.Millisecond):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		start := min(req.Offset, len(items))
+		return &Page[int]{Items: items[start:min(start+req.Limit, len(items))]}, nil
+	}
+	cursorFetch := func(ctx context.Context, req PageRequest) (*Page[int], error) {
+		offset, _ := strconv.Atoi(req.Cursor)
+		page, err := fetch(ctx, PageRequest{Offset: offset, Limit: req.Limit})
+		if err != nil {
+			return nil, err
+		}
+		page.NextCursor = strconv.Itoa(offset + req.Limit)
+		return page, nil
+	}
+
+	for name, p := range map[string]*Paginator[int]{
+		"concurrent": NewPaginator(fetch, OffsetPaging(10), WithPrefetch(4)),
+		"sequential": NewPaginator(cursorFetch, CursorPaging(10), WithPrefetch(4)),
+	} {
+		calls.Store(0)
+		for item, err := range p.Items(context.Background()) {
+			require.NoError(t, err, name)
+			if item == 25 {
+				break
+			}
+		}
+		assert.Zero(t, running.Load(), name)
+		n := calls.Load()
+		time.Sleep(10 * time.Millisecond)
+		assert.Equal(t, n, calls.Load(), "%s: PageFunc called after the loop returned", name)
+	}
+}
+
+func TestPaginator_Errors(t *testing.T) {
+	boom := errors.New("boom")
+	var requests []PageRequest
+	source := offsetSource(numbers(100), &requests)
+	failing := func(ctx context.Context, req PageRequest) (*Page[int], error) {
+		if req.Offset == 20 {
+			return nil, boom
+		}
+		return source(ctx, req)
+	}
+
+	for _, opts := range [][]PaginatorOption{nil, {WithPrefetch(2)}} {
+		all, err := NewPaginator(failing, OffsetPaging(10), opts...).All(context.Background())
+		assert.ErrorIs(t, err, boom)
+		assert.Equal(t, numbers(20), all)
+	}
+
+	// Breaking out of the loop stops fetching.
+	requests = nil
+	for item, err := range NewPaginator(source, OffsetPaging(10)).Items(context.Background()) {
+		require.NoError(t, err)
+		if item == 15 {
+			break
+		}
+	}
+	assert.Len(t, requests, 2)
+
+	requests = nil
+	all, err := NewPaginator(source, OffsetPaging(10), WithMaxPages(3)).All(context.Background())
+	require.NoError(t, err)
+	assert.Len(t, all, 30)
+}
+
+func TestPaginator_ContextCancel(t *testing.T) {
+	var requests []PageRequest
+	source := offsetSource(numbers(100), &requests)
+
+	for _, opts := range [][]PaginatorOption{nil, {WithPrefetch(2)}} {
+		ctx, cancel := context.WithCancel(context.Background())
+		var got []int
+		var gotErr error
+		for item, err := range NewPaginator(source, OffsetPaging(10), opts...).Items(ctx) {
+			if err != nil {
+				gotErr = err
+				break
+			}
+			got = append(got, item)
+			if item == 15 {
+				cancel()
+			}
+		}
+		cancel()
+		assert.ErrorIs(t, gotErr, context.Canceled)
+		assert.Less(t, len(got), 100)
+	}
+}
@@ -0,0 +1,284 @@
+package resttest
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Fault makes the server misbehave instead of sending a response.
+type Fault int
+
+const (
+	// FaultCloseConnection closes the connection without a response, the client sees an EOF.
+	FaultCloseConnection Fault = iota + 1
+	// FaultMalformedResponse writes bytes that are not HTTP.
+	FaultMalformedResponse
+	// FaultTruncatedBody announces a longer body than it sends.
+	FaultTruncatedBody
+)
+
+// Matcher checks one aspect of a request. body is the full request body.
+type Matcher func(r *http.Request, body []byte) bool
+
+// Response is one canned response.
+type Response struct {
+	Status  int
+	Header  http.Header
+	Body    []byte
+	Delay   time.Duration
+	Fault   Fault
+	Handler http.HandlerFunc
+}
+
+// Expectation describes requests the server expects and how it answers them. Build it with the
+// chained methods returned by Server.On.
+type Expectation struct {
+	method   string
+	path     []string
+	matchers []Matcher
+	desc     []string
+
+	mu        sync.Mutex
+	responses []Response
+	delay     time.Duration
+	times     int
+	calls     int
+}
+
+// WithQuery requires the query parameter key to have value.
+func (e *Expectation) WithQuery(key, value string) *Expectation {
+	return e.Match(fmt.Sprintf("query %s=%s", key, value), func(r *http.Request, body []byte) bool {
+		for _, v := range r.URL.Query()[key] {
+			if v == value {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// WithHeader requires the request header key to have value.
+func (e *Expectation) WithHeader(key, value string) *Expectation {
+	return e.Match(fmt.Sprintf("header %s: %s", key, value), func(r *http.Request, body []byte) bool {
+		for _, v := range r.Header.Values(key) {
+			if v == value {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// WithBody requires the request body to equal body.
+func (e *Expectation) WithBody(body string) *Expectation {
+	return e.Match("body "+body, func(r *http.Request, b []byte) bool {
+		return string(b) == body
+	})
+}
+
+// WithJSONBody requires the request body to be JSON equal to v, ignoring formatting and key order.
+// v may be a JSON string or any value encoding/json can marshal.
+func (e *Expectation) WithJSONBody(v any) *Expectation {
+	want, err := normalizeJSON(v)
+	if err != nil {
+		panic(fmt.Sprintf("resttest: WithJSONBody: %v", err))
+	}
+	return e.Match("json body "+string(want), func(r *http.Request, b []byte) bool {
+		got, err := normalizeJSON(json.RawMessage(b))
+		return err == nil && bytes.Equal(got, want)
+	})
+}
+
+// WithBodyContaining requires the request body to contain s.
+func (e *Expectation) WithBodyContaining(s string) *Expectation {
+	return e.Match("body containing "+s, func(r *http.Request, b []byte) bool {
+		return bytes.Contains(b, []byte(s))
+	})
+}
+
+// Match adds a custom matcher, description is used in failure messages.
+func (e *Expectation) Match(description string, m Matcher) *Expectation {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.matchers = append(e.matchers, m)
+	e.desc = append(e.desc, description)
+	return e
+}
+
+// Respond adds a response with a raw body. Responses are served in the order they are added, the
+// last one repeats.
+func (e *Expectation) Respond(status int, body string, headerKV ...string) *Expectation {
+	header := http.Header{}
+	for i := 0; i+1 < len(headerKV); i += 2 {
+		header.Add(headerKV[i], headerKV[i+1])
+	}
+	return e.RespondWith(Response{Status: status, Header: header, Body: []byte(body)})
+}
+
+// RespondJSON adds a response with v encoded as JSON. A string or []byte is sent as is.
+func (e *Expectation) RespondJSON(status int, v any) *Expectation {
+	return e.RespondWith(Response{Status: status, Header: http.Header{"Content-Type": {"application/json"}}, Body: encode(v, json.Marshal)})
+}
+
+// RespondXML adds a response with v encoded as XML. A string or []byte is sent as is.
+func (e *Expectation) RespondXML(status int, v any) *Expectation {
+	return e.RespondWith(Response{Status: status, Header: http.Header{"Content-Type": {"application/xml"}}, Body: encode(v, xml.Marshal)})
+}
+
+// RespondFault adds a response that fails with fault.
+func (e *Expectation) RespondFault(fault Fault) *Expectation {
+	return e.RespondWith(Response{Fault: fault})
+}
+
+// RespondWith adds a fully specified response.
+func (e *Expectation) RespondWith(resp Response) *Expectation {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.responses = append(e.responses, resp)
+	return e
+}
+
+// Delay delays the most recently added response. Called before any response is added, it sets the
+// delay of every response that has none of its own.
+func (e *Expectation) Delay(d time.Duration) *Expectation {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if len(e.responses) == 0 {
+		e.delay = d
+		return e
+	}
+	e.responses[len(e.responses)-1].Delay = d
+	return e
+}
+
+// Times limits the expectation to n requests; AssertExpectations then requires exactly n.
+func (e *Expectation) Times(n int) *Expectation {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.times = n
+	return e
+}
+
+// Once is Times(1).
+func (e *Expectation) Once() *Expectation {
+	return e.Times(1)
+}
+
+// Calls returns how many requests the expectation has answered.
+func (e *Expectation) Calls() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.calls
+}
+
+func (e *Expectation) String() string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	s := e.method + " /" + strings.Join(e.path, "/")
+	if len(e.desc) > 0 {
+		s += " with " + strings.Join(e.desc, ", ")
+	}
+	return s
+}
+
+func (e *Expectation) matches(r *http.Request, body []byte) bool {
+	if e.method != "" && e.method != r.Method {
+		return false
+	}
+	if !matchPath(e.path, splitPath(r.URL.EscapedPath())) {
+		return false
+	}
+	e.mu.Lock()
+	matchers := e.matchers
+	e.mu.Unlock()
+	for _, m := range matchers {
+		if !m(r, body) {
+			return false
+		}
+	}
+	return true
+}
+
+// take claims the next response, or reports that the expectation is used up.
+func (e *Expectation) take() (Response, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.times > 0 && e.calls >= e.times {
+		return Response{}, false
+	}
+	resp := Response{Status: http.StatusOK}
+	if len(e.responses) > 0 {
+		resp = e.responses[min(e.calls, len(e.responses)-1)]
+	}
+	if resp.Delay == 0 {
+		resp.Delay = e.delay
+	}
+	e.calls++
+	return resp, true
+}
+
+func splitPath(path string) []string {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, "/")
+}
+
+// matchPath matches escaped path segments against a pattern of unescaped segments, in which {name}
+// matches any one segment. Splitting before unescaping keeps an encoded "/" inside its segment.
+func matchPath(pattern, segments []string) bool {
+	if len(pattern) != len(segments) {
+		return false
+	}
+	for i, p := range pattern {
+		if strings.HasPrefix(p, "{") && strings.HasSuffix(p, "}") {
+			continue
+		}
+		if unescaped, err := url.PathUnescape(segments[i]); err != nil || p != unescaped {
+			return false
+		}
+	}
+	return true
+}
+
+func encode(v any, marshal func(any) ([]byte, error)) []byte {
+	switch b := v.(type) {
+	case string:
+		return []byte(b)
+	case []byte:
+		return b
+	}
+	data, err := marshal(v)
+	if err != nil {
+		panic(fmt.Sprintf("resttest: encode response: %v", err))
+	}
+	return data
+}
+
+func normalizeJSON(v any) ([]byte, error) {
+	var raw []byte
+	switch b := v.(type) {
+	case string:
+		raw = []byte(b)
+	case json.RawMessage:
+		raw = b
+	default:
+		var err error
+		if raw, err = json.Marshal(v); err != nil {
+			return nil, err
+		}
+	}
+	var decoded any
+	if err := json.Unmarshal(raw, &decoded); err != nil {
+		return nil, err
+	}
+	return json.Marshal(decoded)
+}
@@ -0,0 +1,277 @@
+// Package resttest provides a programmable fake vendor server for testing code built on rest.Client.
+// Register expectations with On, point the client at Server.URL and assert on what was received.
+package resttest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Request is a request received by the Server.
+type Request struct {
+	Method string
+	Path   string
+	Query  url.Values
+	Header http.Header
+	Body   []byte
+	// Matched is false when no expectation answered the request.
+	Matched bool
+
+	escapedPath string
+}
+
+// DecodeJSON decodes the request body into v.
+func (r Request) DecodeJSON(v any) error {
+	return json.Unmarshal(r.Body, v)
+}
+
+// Server is an httptest.Server that answers requests from registered expectations and records
+// every request it receives. Requests matching no expectation fail the test and get a 501.
+type Server struct {
+	*httptest.Server
+
+	t            testing.TB
+	mu           sync.Mutex
+	expectations []*Expectation
+	requests     []Request
+	closing      chan struct{}
+	closeOnce    sync.Once
+}
+
+// NewServer starts a Server that is closed when the test finishes.
+func NewServer(t testing.TB) *Server {
+	s := &Server{t: t, closing: make(chan struct{})}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Close shuts the server down, interrupting delayed responses.
+func (s *Server) Close() {
+	s.closeOnce.Do(func() {
+		close(s.closing)
+		s.Server.Close()
+	})
+}
+
+// On registers an expectation for method and path. An empty method matches any method, path
+// segments written as {name} match any value. Expectations are tried in registration order; one
+// limited by Times stops matching once used up. An expectation is active as soon as On returns,
+// so requests sent while it is being built may miss its matchers and responses.
+func (s *Server) On(method, path string) *Expectation {
+	e := &Expectation{method: method, path: splitPath(path)}
+	s.mu.Lock()
+	s.expectations = append(s.expectations, e)
+	s.mu.Unlock()
+	return e
+}
+
+// Requests returns all received requests in arrival order.
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+// RequestsTo returns the received requests for method and path, which may use {name} segments.
+func (s *Server) RequestsTo(method, path string) []Request {
+	pattern := splitPath(path)
+	var out []Request
+	for _, r := range s.Requests() {
+		if (method == "" || r.Method == method) && matchPath(pattern, splitPath(r.escapedPath)) {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// AssertExpectations checks that every expectation was used: exactly n times when limited by
+// Times(n), at least once otherwise.
+func (s *Server) AssertExpectations(t testing.TB) bool {
+	t.Helper()
+	s.mu.Lock()
+	expectations := append([]*Expectation(nil), s.expectations...)
+	s.mu.Unlock()
+
+	ok := true
+	for _, e := range expectations {
+		e.mu.Lock()
+		calls, times := e.calls, e.times
+		e.mu.Unlock()
+		switch {
+		case times > 0 && calls != times:
+			t.Errorf("resttest: expected %s to be called %d times, got %d", e, times, calls)
+			ok = false
+		case times == 0 && calls == 0:
+			t.Errorf("resttest: expected %s to be called", e)
+			ok = false
+		}
+	}
+	return ok
+}
+
+// AssertCalled checks that at least one request was received for method and path.
+func (s *Server) AssertCalled(t testing.TB, method, path string) bool {
+	t.Helper()
+	if len(s.RequestsTo(method, path)) == 0 {
+		t.Errorf("resttest: expected %s %s to be called, received:\n%s", method, path, s.summary())
+		return false
+	}
+	return true
+}
+
+// AssertNotCalled checks that no request was received for method and path.
+func (s *Server) AssertNotCalled(t testing.TB, method, path string) bool {
+	t.Helper()
+	if n := len(s.RequestsTo(method, path)); n > 0 {
+		t.Errorf("resttest: expected %s %s not to be called, got %d calls", method, path, n)
+		return false
+	}
+	return true
+}
+
+// AssertNumberOfCalls checks that exactly n requests were received for method and path.
+func (s *Server) AssertNumberOfCalls(t testing.TB, method, path string, n int) bool {
+	t.Helper()
+	if got := len(s.RequestsTo(method, path)); got != n {
+		t.Errorf("resttest: expected %s %s to be called %d times, got %d", method, path, n, got)
+		return false
+	}
+	return true
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "resttest: read body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	received := Request{
+		Method: r.Method,
+		Path:   r.URL.Path,
+		Query:  r.URL.Query(),
+		Header: r.Header.Clone(),
+		Body:   body,
+
+		escapedPath: r.URL.EscapedPath(),
+	}
+
+	resp, e := s.match(r, body)
+	received.Matched = e != nil
+	s.mu.Lock()
+	s.requests = append(s.requests, received)
+	s.mu.Unlock()
+
+	if e == nil {
+		msg := fmt.Sprintf("resttest: unexpected request %s %s\n%s", r.Method, r.URL.RequestURI(), s.describeExpectations())
+		s.t.Errorf("%s", msg)
+		http.Error(w, msg, http.StatusNotImplemented)
+		return
+	}
+	s.write(w, r, resp)
+}
+
+func (s *Server) match(r *http.Request, body []byte) (Response, *Expectation) {
+	s.mu.Lock()
+	expectations := append([]*Expectation(nil), s.expectations...)
+	s.mu.Unlock()
+	for _, e := range expectations {
+		if !e.matches(r, body) {
+			continue
+		}
+		if resp, ok := e.take(); ok {
+			return resp, e
+		}
+	}
+	return Response{}, nil
+}
+
+func (s *Server) write(w http.ResponseWriter, r *http.Request, resp Response) {
+	if resp.Delay > 0 {
+		timer := time.NewTimer(resp.Delay)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-r.Context().Done():
+			return
+		case <-s.closing:
+			return
+		}
+	}
+
+	switch resp.Fault {
+	case FaultCloseConnection:
+		panic(http.ErrAbortHandler)
+	case FaultMalformedResponse:
+		hijacker, ok := w.(http.Hijacker)
+		if !ok {
+			panic(http.ErrAbortHandler)
+		}
+		conn, buf, err := hijacker.Hijack()
+		if err != nil {
+			panic(http.ErrAbortHandler)
+		}
+		buf.WriteString("NOT-HTTP garbage\r\n\r\n")
+		buf.Flush()
+		conn.Close()
+		return
+	case FaultTruncatedBody:
+		w.Header().Set("Content-Length", "1024")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"trunc`))
+		w.(http.Flusher).Flush()
+		panic(http.ErrAbortHandler)
+	}
+
+	if resp.Handler != nil {
+		resp.Handler(w, r)
+		return
+	}
+	for k, v := range resp.Header {
+		w.Header()[k] = v
+	}
+	if resp.Status == 0 {
+		resp.Status = http.StatusOK
+	}
+	w.WriteHeader(resp.Status)
+	w.Write(resp.Body)
+}
+
+func (s *Server) describeExpectations() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.expectations) == 0 {
+		return "no expectations registered"
+	}
+	lines := make([]string, 0, len(s.expectations))
+	for _, e := range s.expectations {
+		lines = append(lines, "  expected "+e.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (s *Server) summary() string {
+	requests := s.Requests()
+	if len(requests) == 0 {
+		return "  nothing"
+	}
+	lines := make([]string, 0, len(requests))
+	for _, r := range requests {
+		line := "  " + r.Method + " " + r.Path
+		if len(r.Query) > 0 {
+			line += "?" + r.Query.Encode()
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
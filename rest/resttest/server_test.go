@@ -0,0 +1,247 @@
+package resttest_test
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Lumiaqian/go-sdk-core/rest"
+	"github.com/Lumiaqian/go-sdk-core/rest/resttest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingT captures failures so tests can check that the server reports them.
+type recordingT struct {
+	testing.TB
+	mu     sync.Mutex
+	errors []string
+}
+
+func (r *recordingT) Errorf(format string, args ...any) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func (r *recordingT) Helper() {}
+
+func (r *recordingT) failures() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.errors...)
+}
+
+func do(t *testing.T, method, url string, payload *rest.RequestPayload) *rest.HttpResponse {
+	if payload == nil {
+		payload = &rest.RequestPayload{}
+	}
+	resp, err := rest.NewDefaultHttpClient().DoRequest(context.Background(), method, url, nil, payload)
+	require.NoError(t, err)
+	return resp
+}
+
+func TestServer_Matchers(t *testing.T) {
+	server := resttest.NewServer(t)
+	server.On(http.MethodGet, "/cgi-bin/user/get").
+		WithQuery("userid", "zhangsan").
+		RespondJSON(http.StatusOK, map[string]any{"errcode": 0, "name": "张三"})
+	server.On(http.MethodGet, "/cgi-bin/user/get").
+		RespondJSON(http.StatusOK, `{"errcode":60111,"errmsg":"userid not found"}`)
+	server.On(http.MethodPost, "/departments/{id}/members").
+		WithJSONBody(`{"userid": "lisi", "role": 1}`).
+		Respond(http.StatusCreated, "created", "X-Request-Id", "abc")
+
+	resp := do(t, http.MethodGet, server.URL+"/cgi-bin/user/get?userid=zhangsan&access_token=t", nil)
+	assert.JSONEq(t, `{"errcode":0,"name":"张三"}`, string(resp.Body))
+	assert.Equal(t, "application/json", resp.ContentType)
+
+	resp = do(t, http.MethodGet, server.URL+"/cgi-bin/user/get?userid=wangwu", nil)
+	assert.JSONEq(t, `{"errcode":60111,"errmsg":"userid not found"}`, string(resp.Body))
+
+	resp = do(t, http.MethodPost, server.URL+"/departments/7/members", &rest.RequestPayload{
+		Body: strings.NewReader(`{"role":1,"userid":"lisi"}`),
+	})
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Equal(t, "abc", http.Header(resp.Headers).Get("X-Request-Id"))
+
+	server.AssertExpectations(t)
+	server.AssertNumberOfCalls(t, http.MethodGet, "/cgi-bin/user/get", 2)
+	server.AssertCalled(t, http.MethodPost, "/departments/{id}/members")
+	server.AssertNotCalled(t, http.MethodDelete, "/departments/{id}/members")
+
+	requests := server.RequestsTo(http.MethodPost, "/departments/7/members")
+	require.Len(t, requests, 1)
+	var member struct {
+		UserID string `json:"userid"`
+	}
+	require.NoError(t, requests[0].DecodeJSON(&member))
+	assert.Equal(t, "lisi", member.UserID)
+	assert.Equal(t, "zhangsan", server.Requests()[0].Query.Get("userid"))
+}
+
+func TestServer_SequentialResponsesAndTimes(t *testing.T) {
+	server := resttest.NewServer(t)
+	token := server.On(http.MethodGet, "/gettoken").
+		RespondJSON(http.StatusOK, `{"errcode":-1,"errmsg":"system busy"}`).
+		RespondJSON(http.StatusOK, `{"errcode":0,"access_token":"t1"}`)
+	once := server.On(http.MethodPost, "/send").Once().Respond(http.StatusOK, "first")
+	server.On(http.MethodPost, "/send").Respond(http.StatusTooManyRequests, "later")
+
+	assert.Contains(t, string(do(t, http.MethodGet, server.URL+"/gettoken", nil).Body), "system busy")
+	assert.Contains(t, string(do(t, http.MethodGet, server.URL+"/gettoken", nil).Body), "t1")
+	// The last response repeats.
+	assert.Contains(t, string(do(t, http.MethodGet, server.URL+"/gettoken", nil).Body), "t1")
+	assert.Equal(t, 3, token.Calls())
+
+	assert.Equal(t, "first", string(do(t, http.MethodPost, server.URL+"/send", nil).Body))
+	resp := do(t, http.MethodPost, server.URL+"/send", nil)
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	assert.Equal(t, 1, once.Calls())
+	server.AssertExpectations(t)
+}
+
+func TestServer_XML(t *testing.T) {
+	type reply struct {
+		XMLName xml.Name `xml:"xml"`
+		Code    string   `xml:"return_code"`
+	}
+	server := resttest.NewServer(t)
+	server.On(http.MethodPost, "/pay/unifiedorder").
+		WithBodyContaining("<out_trade_no>42</out_trade_no>").
+		RespondXML(http.StatusOK, reply{Code: "SUCCESS"})
+
+	resp := do(t, http.MethodPost, server.URL+"/pay/unifiedorder", &rest.RequestPayload{
+		Body: strings.NewReader("<xml><out_trade_no>42</out_trade_no></xml>"),
+	})
+	assert.Equal(t, "application/xml", resp.ContentType)
+	assert.Equal(t, "<xml><return_code>SUCCESS</return_code></xml>", string(resp.Body))
+}
+
+func TestServer_DelayAndFaults(t *testing.T) {
+	server := resttest.NewServer(t)
+	server.On(http.MethodGet, "/slow").Respond(http.StatusOK, "ok").Delay(time.Second)
+	server.On(http.MethodGet, "/reset").RespondFault(resttest.FaultCloseConnection)
+	server.On(http.MethodGet, "/garbage").RespondFault(resttest.FaultMalformedResponse)
+	server.On(http.MethodGet, "/truncated").RespondFault(resttest.FaultTruncatedBody)
+	server.On(http.MethodGet, "/flaky").
+		RespondFault(resttest.FaultCloseConnection).
+		Respond(http.StatusOK, "recovered")
+
+	client := rest.NewDefaultHttpClient()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := client.DoRequest(ctx, http.MethodGet, server.URL+"/slow", nil, &rest.RequestPayload{})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	for _, path := range []string{"/reset", "/garbage", "/truncated", "/flaky"} {
+		_, err := client.DoRequest(context.Background(), http.MethodGet, server.URL+path, nil, &rest.RequestPayload{})
+		assert.Error(t, err, path)
+	}
+	assert.Equal(t, "recovered", string(do(t, http.MethodGet, server.URL+"/flaky", nil).Body))
+}
+
+func TestServer_DelayBeforeRespond(t *testing.T) {
+	server := resttest.NewServer(t)
+	server.On(http.MethodGet, "/slow").
+		Delay(100*time.Millisecond).
+		Respond(http.StatusCreated, "first").
+		Respond(http.StatusOK, "second")
+
+	client := rest.NewDefaultHttpClient()
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err := client.DoRequest(ctx, http.MethodGet, server.URL+"/slow", nil, &rest.RequestPayload{})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// The delay applies to every response, none was inserted ahead of them.
+	start := time.Now()
+	resp := do(t, http.MethodGet, server.URL+"/slow", nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "second", string(resp.Body))
+	assert.GreaterOrEqual(t, time.Since(start), 100*time.Millisecond)
+}
+
+func TestServer_CustomHandlerAndMatcher(t *testing.T) {
+	server := resttest.NewServer(t)
+	server.On("", "/echo").
+		Match("signed", func(r *http.Request, body []byte) bool {
+			return strings.HasPrefix(r.Header.Get("Authorization"), "HMAC ")
+		}).
+		RespondWith(resttest.Response{Handler: func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(r.Method))
+		}})
+
+	resp, err := rest.NewDefaultHttpClient().DoRequest(context.Background(), http.MethodPut, server.URL+"/echo",
+		map[string]string{"Authorization": "HMAC sig"}, &rest.RequestPayload{})
+	require.NoError(t, err)
+	assert.Equal(t, http.MethodPut, string(resp.Body))
+}
+
+func TestServer_Failures(t *testing.T) {
+	rt := &recordingT{TB: t}
+	server := resttest.NewServer(rt)
+	server.On(http.MethodGet, "/expected").WithHeader("X-Tenant", "a").Times(2)
+
+	resp := do(t, http.MethodGet, server.URL+"/unexpected?x=1", nil)
+	assert.Equal(t, http.StatusNotImplemented, resp.StatusCode)
+	assert.Contains(t, string(resp.Body), "expected GET /expected with header X-Tenant: a")
+	// Missing the header, so unmatched too.
+	do(t, http.MethodGet, server.URL+"/expected", nil)
+
+	assert.False(t, server.AssertExpectations(rt))
+	assert.False(t, server.AssertCalled(rt, http.MethodPost, "/expected"))
+	assert.False(t, server.AssertNotCalled(rt, http.MethodGet, "/unexpected"))
+	assert.False(t, server.AssertNumberOfCalls(rt, http.MethodGet, "/expected", 2))
+
+	failures := rt.failures()
+	require.Len(t, failures, 6)
+	assert.Contains(t, failures[0], "unexpected request GET /unexpected?x=1")
+	assert.Contains(t, failures[1], "unexpected request GET /expected")
+	assert.Contains(t, failures[2], "expected GET /expected with header X-Tenant: a to be called 2 times, got 0")
+	assert.Contains(t, failures[3], "received:\n  GET /unexpected?x=1\n  GET /expected")
+	assert.False(t, server.Requests()[0].Matched)
+}
+
+func TestServer_EscapedPaths(t *testing.T) {
+	server := resttest.NewServer(t)
+	server.On(http.MethodGet, "/files/100%").Respond(http.StatusOK, "percent")
+	server.On(http.MethodGet, "/files/{name}").Respond(http.StatusOK, "one segment")
+
+	assert.Equal(t, "percent", string(do(t, http.MethodGet, server.URL+"/files/100%25", nil).Body))
+	// %2525 decodes once to %25, not twice to %.
+	assert.Equal(t, "one segment", string(do(t, http.MethodGet, server.URL+"/files/100%2525", nil).Body))
+	// An encoded slash stays inside its segment.
+	assert.Equal(t, "one segment", string(do(t, http.MethodGet, server.URL+"/files/a%2Fb", nil).Body))
+
+	server.AssertNumberOfCalls(t, http.MethodGet, "/files/{name}", 3)
+	server.AssertNumberOfCalls(t, http.MethodGet, "/files/100%", 1)
+}
+
+func TestServer_RegisterWhileServing(t *testing.T) {
+	// Requests racing the registration may arrive before their expectation is complete.
+	rt := &recordingT{TB: t}
+	server := resttest.NewServer(rt)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				do(t, http.MethodGet, server.URL+"/ping", nil)
+			}
+		}()
+	}
+	for i := 0; i < 20; i++ {
+		server.On(http.MethodGet, "/ping").WithQuery("i", fmt.Sprint(i)).WithHeader("X-Test", "1").Respond(http.StatusOK, "pong")
+	}
+	wg.Wait()
+	server.AssertNumberOfCalls(t, http.MethodGet, "/ping", 80)
+}
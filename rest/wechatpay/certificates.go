@@ -0,0 +1,410 @@
+package wechatpay
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Lumiaqian/go-sdk-core/cache"
+	"github.com/Lumiaqian/go-sdk-core/log"
+	"github.com/Lumiaqian/go-sdk-core/rest"
+)
+
+const (
+	DefaultCertificatesURL = "https://api.mch.weixin.qq.com/v3/certificates"
+
+	// AlgorithmAEADAES256GCM is the only algorithm WeChat Pay uses for encrypted resources.
+	AlgorithmAEADAES256GCM = "AEAD_AES_256_GCM"
+
+	defaultCertificateCacheKey = "wechatpay:platform_certificates"
+	defaultRefreshInterval     = 12 * time.Hour
+	// unknownSerialRefreshInterval limits downloads triggered by serial numbers we have not seen.
+	unknownSerialRefreshInterval = time.Minute
+)
+
+var ErrUnknownCertificate = errors.New("wechatpay: unknown platform certificate")
+
+// EncryptedResource is the encrypted part of a certificate download or a payment notification.
+type EncryptedResource struct {
+	Algorithm      string `json:"algorithm"`
+	Ciphertext     string `json:"ciphertext"`
+	AssociatedData string `json:"associated_data"`
+	Nonce          string `json:"nonce"`
+	OriginalType   string `json:"original_type,omitempty"`
+}
+
+// DecryptResource decrypts r with the 32 byte merchant API v3 key.
+func DecryptResource(apiV3Key []byte, r EncryptedResource) ([]byte, error) {
+	if r.Algorithm != "" && r.Algorithm != AlgorithmAEADAES256GCM {
+		return nil, fmt.Errorf("wechatpay: unsupported resource algorithm %q", r.Algorithm)
+	}
+	if len(apiV3Key) != 32 {
+		return nil, errors.New("wechatpay: api v3 key must be 32 bytes")
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(r.Ciphertext)
+	if err != nil {
+		return nil, fmt.Errorf("wechatpay: decode ciphertext: %w", err)
+	}
+
+	block, err := aes.NewCipher(apiV3Key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCMWithNonceSize(block, len(r.Nonce))
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := aead.Open(nil, []byte(r.Nonce), ciphertext, []byte(r.AssociatedData))
+	if err != nil {
+		return nil, fmt.Errorf("wechatpay: decrypt resource: %w", err)
+	}
+	return plaintext, nil
+}
+
+// CertificateProvider looks up platform certificates by serial number.
+type CertificateProvider interface {
+	Certificate(ctx context.Context, serialNo string) (*x509.Certificate, error)
+}
+
+// CertificateManager downloads the platform certificates and keeps them up to date. Downloaded
+// certificates are stored in a cache.Cache so that processes sharing the cache download them once per
+// refresh interval. A serial number that is not known yet triggers an early download, which is how
+// certificate rotation is picked up.
+type CertificateManager struct {
+	client          rest.Client
+	apiV3Key        []byte
+	cache           cache.Cache
+	cacheKey        string
+	url             string
+	refreshInterval time.Duration
+	logger          *log.LogHelper
+	now             func() time.Time
+
+	mu           sync.Mutex
+	certs        map[string]*x509.Certificate
+	loadedAt     time.Time
+	downloadedAt time.Time
+	updating     *certificateUpdate
+}
+
+type CertificateOption func(*CertificateManager)
+
+func WithCertificatesURL(url string) CertificateOption {
+	return func(m *CertificateManager) {
+		m.url = url
+	}
+}
+
+// WithCertificateCacheKey sets the cache key, so that several merchants can share a cache.
+func WithCertificateCacheKey(key string) CertificateOption {
+	return func(m *CertificateManager) {
+		m.cacheKey = key
+	}
+}
+
+// WithRefreshInterval is how often the certificates are downloaded again, 12 hours by default.
+func WithRefreshInterval(interval time.Duration) CertificateOption {
+	return func(m *CertificateManager) {
+		m.refreshInterval = interval
+	}
+}
+
+func WithCertificateLogger(logger log.Logger) CertificateOption {
+	return func(m *CertificateManager) {
+		if logger != nil {
+			m.logger = log.NewLogHelper(logger)
+		}
+	}
+}
+
+// NewCertificateManager creates a manager that downloads certificates with client, which must sign
+// its requests, e.g. with middleware.NewSigningMiddleware(signer). It must not verify responses with
+// this manager: the download response is verified with the certificates it contains.
+func NewCertificateManager(client rest.Client, apiV3Key []byte, c cache.Cache, opts ...CertificateOption) (*CertificateManager, error) {
+	if client == nil || c == nil {
+		return nil, errors.New("wechatpay: client and cache are required")
+	}
+	if len(apiV3Key) != 32 {
+		return nil, errors.New("wechatpay: api v3 key must be 32 bytes")
+	}
+
+	m := &CertificateManager{
+		client:          client,
+		apiV3Key:        apiV3Key,
+		cache:           c,
+		cacheKey:        defaultCertificateCacheKey,
+		url:             DefaultCertificatesURL,
+		refreshInterval: defaultRefreshInterval,
+		now:             time.Now,
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m, nil
+}
+
+// Certificate returns the valid platform certificate with the given serial number.
+func (m *CertificateManager) Certificate(ctx context.Context, serialNo string) (*x509.Certificate, error) {
+	now := m.now()
+	m.mu.Lock()
+	loaded, loadedAt, downloadedAt := m.certs != nil, m.loadedAt, m.downloadedAt
+	m.mu.Unlock()
+
+	if !loaded {
+		if err := m.update(ctx, false); err != nil {
+			return nil, err
+		}
+	} else if now.Sub(loadedAt) >= m.refreshInterval && now.Sub(downloadedAt) >= unknownSerialRefreshInterval {
+		// Keep serving the certificates we have while they are refreshed in the background, they are
+		// still within their validity if the refresh fails.
+		if call, started := m.startUpdate(ctx, false); started {
+			go func() {
+				<-call.done
+				if call.err != nil {
+					m.logError(ctx, "wechatpay_certificate_refresh", call.err)
+				}
+			}()
+		}
+	}
+	if cert := m.lookup(serialNo, now); cert != nil {
+		return cert, nil
+	}
+
+	m.mu.Lock()
+	recent := now.Sub(m.downloadedAt) < unknownSerialRefreshInterval
+	m.mu.Unlock()
+	if recent {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownCertificate, serialNo)
+	}
+	if err := m.update(ctx, true); err != nil {
+		return nil, err
+	}
+	if cert := m.lookup(serialNo, now); cert != nil {
+		return cert, nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnknownCertificate, serialNo)
+}
+
+// Refresh downloads the certificates now, regardless of the refresh interval.
+func (m *CertificateManager) Refresh(ctx context.Context) error {
+	return m.update(ctx, true)
+}
+
+func (m *CertificateManager) lookup(serialNo string, now time.Time) *x509.Certificate {
+	m.mu.Lock()
+	cert := m.certs[serialKey(serialNo)]
+	m.mu.Unlock()
+	if cert == nil || now.Before(cert.NotBefore) || now.After(cert.NotAfter) {
+		return nil
+	}
+	return cert
+}
+
+// update loads the certificates from the cache, or downloads them if download is set or the cache
+// has none. Concurrent callers share one update, which runs without holding m.mu and without the
+// caller's cancellation, so a slow download only delays the callers that need it.
+func (m *CertificateManager) update(ctx context.Context, download bool) error {
+	for {
+		call, _ := m.startUpdate(ctx, download)
+		select {
+		case <-call.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		// A cache load in flight does not satisfy a caller that asked for a download.
+		if call.download || !download {
+			return call.err
+		}
+	}
+}
+
+// startUpdate starts an update unless one is in flight, and returns the in-flight update.
+func (m *CertificateManager) startUpdate(ctx context.Context, download bool) (*certificateUpdate, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.updating != nil {
+		return m.updating, false
+	}
+	call := &certificateUpdate{done: make(chan struct{}), download: download}
+	m.updating = call
+	go m.runUpdate(context.WithoutCancel(ctx), call)
+	return call, true
+}
+
+type certificateUpdate struct {
+	done     chan struct{}
+	download bool
+	err      error
+}
+
+func (m *CertificateManager) runUpdate(ctx context.Context, call *certificateUpdate) {
+	defer func() {
+		m.mu.Lock()
+		m.updating = nil
+		m.mu.Unlock()
+		close(call.done)
+	}()
+
+	if !call.download {
+		if certs, ok := m.loadCached(ctx); ok {
+			m.install(certs)
+			return
+		}
+		call.download = true
+	}
+	call.err = m.download(ctx)
+}
+
+// loadCached reads the certificates from the cache.
+func (m *CertificateManager) loadCached(ctx context.Context) (map[string]*x509.Certificate, bool) {
+	value, err := m.cache.Get(ctx, m.cacheKey)
+	if err != nil {
+		if !errors.Is(err, cache.ErrNotFound) {
+			m.logError(ctx, "wechatpay_certificate_cache_get", err)
+		}
+		return nil, false
+	}
+	certs, err := decodeCertificates(value)
+	if err != nil {
+		m.logError(ctx, "wechatpay_certificate_cache_corrupt", err)
+		return nil, false
+	}
+	return certs, true
+}
+
+func (m *CertificateManager) install(certs map[string]*x509.Certificate) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.certs = certs
+	m.loadedAt = m.now()
+}
+
+type certificatesResponse struct {
+	Data []struct {
+		SerialNo           string            `json:"serial_no"`
+		EffectiveTime      time.Time         `json:"effective_time"`
+		ExpireTime         time.Time         `json:"expire_time"`
+		EncryptCertificate EncryptedResource `json:"encrypt_certificate"`
+	} `json:"data"`
+}
+
+func (m *CertificateManager) download(ctx context.Context) error {
+	m.mu.Lock()
+	m.downloadedAt = m.now()
+	m.mu.Unlock()
+
+	resp, err := m.client.DoRequest(ctx, http.MethodGet, m.url, map[string]string{"Accept": "application/json"}, &rest.RequestPayload{})
+	if err != nil {
+		return fmt.Errorf("wechatpay: download certificates: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("wechatpay: download certificates failed with status %d: %s", resp.StatusCode, resp.Body)
+	}
+
+	var result certificatesResponse
+	if err := json.Unmarshal(resp.Body, &result); err != nil {
+		return fmt.Errorf("wechatpay: decode certificates: %w", err)
+	}
+
+	certs := make(map[string]*x509.Certificate, len(result.Data))
+	pems := make(map[string]string, len(result.Data))
+	for _, item := range result.Data {
+		certPEM, err := DecryptResource(m.apiV3Key, item.EncryptCertificate)
+		if err != nil {
+			return err
+		}
+		cert, err := parseCertificate(certPEM)
+		if err != nil {
+			return err
+		}
+		serial := serialKey(serialNumber(cert))
+		if serial != serialKey(item.SerialNo) {
+			return fmt.Errorf("wechatpay: certificate serial %s does not match %s", serialNumber(cert), item.SerialNo)
+		}
+		certs[serial] = cert
+		pems[serial] = string(certPEM)
+	}
+	if len(certs) == 0 {
+		return errors.New("wechatpay: certificate response has no certificates")
+	}
+
+	// The download is signed by one of the certificates it contains.
+	verifier := &Verifier{certs: staticCertificates(certs), maxSkew: defaultMaxClockSkew, now: m.now}
+	if err := verifier.Verify(ctx, http.Header(resp.Headers), resp.Body); err != nil {
+		return fmt.Errorf("wechatpay: verify certificate download: %w", err)
+	}
+
+	m.install(certs)
+
+	encoded, _ := json.Marshal(pems)
+	if err := m.cache.Set(ctx, m.cacheKey, string(encoded), m.refreshInterval); err != nil {
+		m.logError(ctx, "wechatpay_certificate_cache_set", err)
+	}
+	return nil
+}
+
+func (m *CertificateManager) logError(ctx context.Context, msg string, err error) {
+	if m.logger != nil {
+		m.logger.Error(ctx, "msg", msg, "error", err)
+	}
+}
+
+func decodeCertificates(value string) (map[string]*x509.Certificate, error) {
+	var pems map[string]string
+	if err := json.Unmarshal([]byte(value), &pems); err != nil {
+		return nil, err
+	}
+	certs := make(map[string]*x509.Certificate, len(pems))
+	for serial, certPEM := range pems {
+		cert, err := parseCertificate([]byte(certPEM))
+		if err != nil {
+			return nil, err
+		}
+		certs[serialKey(serial)] = cert
+	}
+	return certs, nil
+}
+
+func parseCertificate(certPEM []byte) (*x509.Certificate, error) {
+	block, _ := pem.Decode(certPEM)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, errors.New("wechatpay: no certificate PEM block found")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("wechatpay: parse certificate: %w", err)
+	}
+	return cert, nil
+}
+
+// serialNumber formats the certificate serial number the way WeChat Pay does, as upper-case hex
+// of the serial bytes, keeping a leading zero nibble.
+func serialNumber(cert *x509.Certificate) string {
+	return strings.ToUpper(hex.EncodeToString(cert.SerialNumber.Bytes()))
+}
+
+// serialKey normalizes a serial number for lookups. Leading zeros are dropped because the
+// encoding of the serial may or may not keep a leading zero byte.
+func serialKey(serialNo string) string {
+	return strings.TrimLeft(strings.ToUpper(serialNo), "0")
+}
+
+type staticCertificates map[string]*x509.Certificate
+
+func (s staticCertificates) Certificate(ctx context.Context, serialNo string) (*x509.Certificate, error) {
+	if cert, ok := s[serialKey(serialNo)]; ok {
+		return cert, nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnknownCertificate, serialNo)
+}
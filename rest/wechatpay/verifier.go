@@ -0,0 +1,133 @@
+package wechatpay
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Lumiaqian/go-sdk-core/rest"
+)
+
+const (
+	HeaderTimestamp = "Wechatpay-Timestamp"
+	HeaderNonce     = "Wechatpay-Nonce"
+	HeaderSignature = "Wechatpay-Signature"
+	HeaderSerial    = "Wechatpay-Serial"
+
+	defaultMaxClockSkew = 5 * time.Minute
+)
+
+var (
+	ErrMissingSignature = errors.New("wechatpay: response is not signed")
+	ErrInvalidSignature = errors.New("wechatpay: invalid signature")
+	ErrTimestampSkew    = errors.New("wechatpay: signature timestamp outside the allowed clock skew")
+)
+
+// Verifier checks the signatures WeChat Pay puts on responses and notifications: the SHA256-RSA
+// signature over timestamp, nonce and body, each followed by a newline, made with the platform
+// certificate named by the Wechatpay-Serial header.
+type Verifier struct {
+	certs   CertificateProvider
+	maxSkew time.Duration
+	now     func() time.Time
+}
+
+type VerifierOption func(*Verifier)
+
+// WithMaxClockSkew is how far the signature timestamp may be from the local clock, 5 minutes by default.
+func WithMaxClockSkew(skew time.Duration) VerifierOption {
+	return func(v *Verifier) {
+		v.maxSkew = skew
+	}
+}
+
+func NewVerifier(certs CertificateProvider, opts ...VerifierOption) *Verifier {
+	v := &Verifier{
+		certs:   certs,
+		maxSkew: defaultMaxClockSkew,
+		now:     time.Now,
+	}
+	for _, opt := range opts {
+		opt(v)
+	}
+	return v
+}
+
+// Verify checks the signature headers in header against body.
+func (v *Verifier) Verify(ctx context.Context, header http.Header, body []byte) error {
+	timestamp := header.Get(HeaderTimestamp)
+	nonce := header.Get(HeaderNonce)
+	signature := header.Get(HeaderSignature)
+	serial := header.Get(HeaderSerial)
+	if timestamp == "" || nonce == "" || signature == "" || serial == "" {
+		return ErrMissingSignature
+	}
+
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: bad timestamp %q", ErrInvalidSignature, timestamp)
+	}
+	if skew := v.now().Sub(time.Unix(seconds, 0)); skew > v.maxSkew || skew < -v.maxSkew {
+		return ErrTimestampSkew
+	}
+
+	cert, err := v.certs.Certificate(ctx, serial)
+	if err != nil {
+		return err
+	}
+	key, ok := cert.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return fmt.Errorf("wechatpay: platform certificate %s has no RSA public key", serial)
+	}
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+
+	message := timestamp + "\n" + nonce + "\n" + string(body) + "\n"
+	digest := sha256.Sum256([]byte(message))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig); err != nil {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// VerificationMiddleware rejects responses whose signature does not verify. The response body is
+// closed and an error is returned instead, so callers never see unverified data.
+type VerificationMiddleware struct {
+	verifier *Verifier
+}
+
+func NewVerificationMiddleware(verifier *Verifier) *VerificationMiddleware {
+	return &VerificationMiddleware{
+		verifier: verifier,
+	}
+}
+
+func (m *VerificationMiddleware) Handle(ctx context.Context, req *http.Request, next rest.MiddlewareHandler) (*http.Response, error) {
+	resp, err := next(ctx, req)
+	if err != nil || resp == nil {
+		return resp, err
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	if err := m.verifier.Verify(ctx, resp.Header, body); err != nil {
+		return nil, fmt.Errorf("wechatpay: unverified response with status %d: %w", resp.StatusCode, err)
+	}
+
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	return resp, nil
+}
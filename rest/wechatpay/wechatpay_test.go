@@ -0,0 +1,336 @@
+package wechatpay
+
+import (
+	"context"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Lumiaqian/go-sdk-core/cache"
+	"github.com/Lumiaqian/go-sdk-core/rest"
+	"github.com/Lumiaqian/go-sdk-core/rest/middleware"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var apiV3Key = []byte("0123456789abcdef0123456789abcdef")
+
+type platformCert struct {
+	key    *rsa.PrivateKey
+	pem    []byte
+	serial string
+}
+
+func newPlatformCert(t *testing.T, serial int64) platformCert {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "Tenpay.com Root CA"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	return platformCert{
+		key: key,
+		pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		// WeChat Pay keeps leading zeros, e.g. 0A1B rather than A1B.
+		serial: strings.ToUpper(hex.EncodeToString(big.NewInt(serial).Bytes())),
+	}
+}
+
+// fakeWechatPay verifies request signatures with the merchant key and signs responses with the
+// current platform certificate.
+type fakeWechatPay struct {
+	t           *testing.T
+	merchantKey *rsa.PublicKey
+
+	mu        sync.Mutex
+	current   platformCert
+	published []platformCert
+	tamper    bool
+	// certDelay, if set, holds certificate downloads until it is closed.
+	certDelay chan struct{}
+	downloads atomic.Int32
+}
+
+var authPattern = regexp.MustCompile(`^WECHATPAY2-SHA256-RSA2048 mchid="(\w+)",nonce_str="(\w+)",signature="([^"]+)",timestamp="(\d+)",serial_no="(\w+)"$`)
+
+func (f *fakeWechatPay) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	m := authPattern.FindStringSubmatch(r.Header.Get("Authorization"))
+	if m == nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	message := r.Method + "\n" + r.URL.RequestURI() + "\n" + m[4] + "\n" + m[2] + "\n" + string(body) + "\n"
+	digest := sha256.Sum256([]byte(message))
+	sig, _ := base64.StdEncoding.DecodeString(m[3])
+	if rsa.VerifyPKCS1v15(f.merchantKey, crypto.SHA256, digest[:], sig) != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	f.mu.Lock()
+	delay := f.certDelay
+	f.mu.Unlock()
+	if delay != nil && r.URL.Path == "/v3/certificates" {
+		<-delay
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var resp []byte
+	if r.URL.Path == "/v3/certificates" {
+		f.downloads.Add(1)
+		var data []map[string]any
+		for _, cert := range f.published {
+			data = append(data, map[string]any{
+				"serial_no":           cert.serial,
+				"effective_time":      time.Now().Format(time.RFC3339),
+				"expire_time":         time.Now().Add(24 * time.Hour).Format(time.RFC3339),
+				"encrypt_certificate": encrypt(f.t, cert.pem),
+			})
+		}
+		resp, _ = json.Marshal(map[string]any{"data": data})
+	} else {
+		resp = []byte(`{"trade_state":"SUCCESS"}`)
+	}
+
+	timestamp, nonce := strconv.FormatInt(time.Now().Unix(), 10), "platformnonce"
+	digest = sha256.Sum256([]byte(timestamp + "\n" + nonce + "\n" + string(resp) + "\n"))
+	sig, _ = rsa.SignPKCS1v15(rand.Reader, f.current.key, crypto.SHA256, digest[:])
+	w.Header().Set(HeaderTimestamp, timestamp)
+	w.Header().Set(HeaderNonce, nonce)
+	w.Header().Set(HeaderSignature, base64.StdEncoding.EncodeToString(sig))
+	w.Header().Set(HeaderSerial, f.current.serial)
+	if f.tamper && r.URL.Path != "/v3/certificates" {
+		resp = []byte(`{"trade_state":"REFUND"}`)
+	}
+	w.Write(resp)
+}
+
+func encrypt(t *testing.T, plaintext []byte) EncryptedResource {
+	block, err := aes.NewCipher(apiV3Key)
+	require.NoError(t, err)
+	aead, err := cipher.NewGCM(block)
+	require.NoError(t, err)
+	nonce := "abcdef012345"
+	ciphertext := aead.Seal(nil, []byte(nonce), plaintext, []byte("certificate"))
+	return EncryptedResource{
+		Algorithm:      AlgorithmAEADAES256GCM,
+		Ciphertext:     base64.StdEncoding.EncodeToString(ciphertext),
+		AssociatedData: "certificate",
+		Nonce:          nonce,
+	}
+}
+
+type testEnv struct {
+	server   *httptest.Server
+	fake     *fakeWechatPay
+	signer   *Signer
+	cache    cache.Cache
+	manager  *CertificateManager
+	client   *rest.DefaultHttpClient
+	platform platformCert
+}
+
+func newTestEnv(t *testing.T) *testEnv {
+	merchantKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(merchantKey)})
+	signer, err := NewSigner("1900000001", "MERCHANTSERIAL", keyPEM)
+	require.NoError(t, err)
+
+	platform := newPlatformCert(t, 0x5157F09EFDC096DE)
+	fake := &fakeWechatPay{t: t, merchantKey: &merchantKey.PublicKey, current: platform, published: []platformCert{platform}}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	env := &testEnv{server: server, fake: fake, signer: signer, cache: cache.NewMemcache(0, time.Minute), platform: platform}
+	env.manager = env.newManager(t)
+	env.client = rest.NewDefaultHttpClient()
+	env.client.Use(NewVerificationMiddleware(NewVerifier(env.manager)))
+	env.client.Use(middleware.NewSigningMiddleware(signer))
+	return env
+}
+
+func (e *testEnv) newManager(t *testing.T) *CertificateManager {
+	certClient := rest.NewDefaultHttpClient()
+	certClient.Use(middleware.NewSigningMiddleware(e.signer))
+	manager, err := NewCertificateManager(certClient, apiV3Key, e.cache, WithCertificatesURL(e.server.URL+"/v3/certificates"))
+	require.NoError(t, err)
+	return manager
+}
+
+func (e *testEnv) query() (*rest.HttpResponse, error) {
+	return e.client.DoRequest(context.Background(), http.MethodGet, e.server.URL+"/v3/pay/transactions/id/4200000001?mchid=1900000001", nil, &rest.RequestPayload{})
+}
+
+func TestSignAndVerify(t *testing.T) {
+	env := newTestEnv(t)
+
+	resp, err := env.query()
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.JSONEq(t, `{"trade_state":"SUCCESS"}`, string(resp.Body))
+
+	_, err = env.query()
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), env.fake.downloads.Load())
+
+	// Another process sharing the cache does not download again.
+	cert, err := env.newManager(t).Certificate(context.Background(), env.platform.serial)
+	require.NoError(t, err)
+	assert.Equal(t, env.platform.serial, serialNumber(cert))
+	assert.Equal(t, int32(1), env.fake.downloads.Load())
+}
+
+func TestVerificationMiddleware_RejectsTamperedResponse(t *testing.T) {
+	env := newTestEnv(t)
+	env.fake.tamper = true
+
+	_, err := env.query()
+	assert.ErrorIs(t, err, ErrInvalidSignature)
+}
+
+func TestVerificationMiddleware_RejectsUnsignedResponse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	client := rest.NewDefaultHttpClient()
+	client.Use(NewVerificationMiddleware(NewVerifier(staticCertificates{})))
+	_, err := client.DoRequest(context.Background(), http.MethodGet, server.URL, nil, &rest.RequestPayload{})
+	assert.ErrorIs(t, err, ErrMissingSignature)
+}
+
+func TestVerifier_ClockSkew(t *testing.T) {
+	platform := newPlatformCert(t, 42)
+	cert, err := parseCertificate(platform.pem)
+	require.NoError(t, err)
+	v := NewVerifier(staticCertificates{platform.serial: cert}, WithMaxClockSkew(time.Minute))
+
+	body := []byte(`{}`)
+	timestamp := strconv.FormatInt(time.Now().Add(-2*time.Minute).Unix(), 10)
+	digest := sha256.Sum256([]byte(timestamp + "\nnonce\n" + string(body) + "\n"))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, platform.key, crypto.SHA256, digest[:])
+	require.NoError(t, err)
+	header := http.Header{}
+	header.Set(HeaderTimestamp, timestamp)
+	header.Set(HeaderNonce, "nonce")
+	header.Set(HeaderSignature, base64.StdEncoding.EncodeToString(sig))
+	header.Set(HeaderSerial, platform.serial)
+
+	assert.ErrorIs(t, v.Verify(context.Background(), header, body), ErrTimestampSkew)
+	v.maxSkew = 5 * time.Minute
+	assert.NoError(t, v.Verify(context.Background(), header, body))
+
+	header.Set(HeaderSerial, "UNKNOWN")
+	assert.ErrorIs(t, v.Verify(context.Background(), header, body), ErrUnknownCertificate)
+}
+
+func TestCertificateManager_Rotation(t *testing.T) {
+	env := newTestEnv(t)
+	now := time.Now()
+	env.manager.now = func() time.Time { return now }
+
+	_, err := env.query()
+	require.NoError(t, err)
+
+	// WeChat Pay publishes the new certificate next to the old one, then starts signing with it.
+	// The serial starts with a zero nibble, which must survive formatting.
+	next := newPlatformCert(t, 0x0A1B)
+	require.Equal(t, "0A1B", next.serial)
+	env.fake.mu.Lock()
+	env.fake.published = append(env.fake.published, next)
+	env.fake.current = next
+	env.fake.mu.Unlock()
+
+	// Downloads for unknown serial numbers are rate limited.
+	_, err = env.query()
+	assert.ErrorIs(t, err, ErrUnknownCertificate)
+	assert.Equal(t, int32(1), env.fake.downloads.Load())
+
+	now = now.Add(2 * time.Minute)
+	resp, err := env.query()
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"trade_state":"SUCCESS"}`, string(resp.Body))
+	assert.Equal(t, int32(2), env.fake.downloads.Load())
+}
+
+func TestCertificateManager_RefreshDoesNotBlockLookups(t *testing.T) {
+	env := newTestEnv(t)
+	var nowMutex sync.Mutex
+	now := time.Now()
+	env.manager.now = func() time.Time {
+		nowMutex.Lock()
+		defer nowMutex.Unlock()
+		return now
+	}
+
+	_, err := env.query()
+	require.NoError(t, err)
+
+	release := make(chan struct{})
+	env.fake.mu.Lock()
+	env.fake.certDelay = release
+	env.fake.mu.Unlock()
+	nowMutex.Lock()
+	now = now.Add(13 * time.Hour)
+	nowMutex.Unlock()
+	// The shared copy expired as well, so the refresh has to download.
+	require.NoError(t, env.cache.Delete(context.Background(), defaultCertificateCacheKey))
+
+	// The refresh is due, but lookups are served from the current certificates while it runs.
+	for i := 0; i < 3; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		cert, err := env.manager.Certificate(ctx, env.platform.serial)
+		cancel()
+		require.NoError(t, err)
+		assert.Equal(t, env.platform.serial, serialNumber(cert))
+	}
+
+	close(release)
+	assert.Eventually(t, func() bool { return env.fake.downloads.Load() == 2 }, time.Second, 10*time.Millisecond)
+}
+
+func TestSerialKey(t *testing.T) {
+	assert.Equal(t, serialKey("0A1B"), serialKey("a1b"))
+	assert.Equal(t, serialKey("000A1B"), serialKey("0A1B"))
+}
+
+func TestDecryptResource(t *testing.T) {
+	resource := encrypt(t, []byte(`{"out_trade_no":"1217752501201407033233368018"}`))
+	plaintext, err := DecryptResource(apiV3Key, resource)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"out_trade_no":"1217752501201407033233368018"}`, string(plaintext))
+
+	resource.AssociatedData = "transaction"
+	_, err = DecryptResource(apiV3Key, resource)
+	assert.Error(t, err)
+}
@@ -2,66 +2,287 @@ package token
 
 import (
 	"context"
+	"sort"
 	"sync"
 	"time"
 
 	"github.com/Lumiaqian/go-sdk-core/cache"
+	"github.com/Lumiaqian/go-sdk-core/log"
 )
 
 type DefaultTokenProvider struct {
 	mutex   sync.RWMutex
 	cache   cache.Cache
 	fetcher TokenFetcher
+
+	logger        *log.LogHelper
+	observers     []Observer
+	staleFallback bool
+	staleGrace    time.Duration
+	now           func() time.Time
+
+	// states keeps per cache key the last successfully fetched token with its real expiry,
+	// independent of whatever the cache backend still holds, and the outcome of the last fetch.
+	statesMutex sync.Mutex
+	states      map[string]*keyState
+}
+
+type keyState struct {
+	lastGood    Token
+	lastFetchAt time.Time
+	lastErr     error
+	lastErrAt   time.Time
+}
+
+type Option func(*DefaultTokenProvider)
+
+// WithStaleFallback serves the last known good token when FetchToken fails, as long as
+// it expired no longer than grace ago. A grace of zero only serves tokens that have not expired yet.
+func WithStaleFallback(grace time.Duration) Option {
+	return func(p *DefaultTokenProvider) {
+		if grace < 0 {
+			grace = 0
+		}
+		p.staleFallback = true
+		p.staleGrace = grace
+	}
 }
 
-func NewDefaultTokenProvider(cache cache.Cache, fetcher TokenFetcher) *DefaultTokenProvider {
-	return &DefaultTokenProvider{
+func WithLogger(logger log.Logger) Option {
+	return func(p *DefaultTokenProvider) {
+		if logger != nil {
+			p.logger = log.NewLogHelper(logger)
+		}
+	}
+}
+
+// WithObserver registers an observer for lifecycle events, it can be used multiple times.
+func WithObserver(observer Observer) Option {
+	return func(p *DefaultTokenProvider) {
+		if observer != nil {
+			p.observers = append(p.observers, observer)
+		}
+	}
+}
+
+func NewDefaultTokenProvider(cache cache.Cache, fetcher TokenFetcher, opts ...Option) *DefaultTokenProvider {
+	p := &DefaultTokenProvider{
 		cache:   cache,
 		fetcher: fetcher,
+		now:     time.Now,
+		states:  make(map[string]*keyState),
+	}
+	for _, opt := range opts {
+		opt(p)
 	}
+	return p
 }
 
 func (p *DefaultTokenProvider) GetAccessToken(ctx context.Context) (string, error) {
+	token, err := p.GetToken(ctx)
+	if err != nil {
+		return "", err
+	}
+	return token.Value, nil
+}
+
+// GetToken behaves like GetAccessToken but also reports the token expiry, when known,
+// and whether a stale token was served because fetching a new one failed.
+func (p *DefaultTokenProvider) GetToken(ctx context.Context) (Token, error) {
 	p.mutex.RLock()
 	defer p.mutex.RUnlock()
 
 	key := p.fetcher.GenerateCacheKey()
 
 	// Try to get token from cache
-	token, err := p.cache.Get(ctx, key)
+	value, err := p.cache.Get(ctx, key)
 	if err == nil {
+		p.emit(ctx, Event{Type: EventCacheHit, Key: key})
+		token := Token{Value: value}
+		if last, ok := p.lastGoodToken(key); ok && last.Value == value {
+			token.ExpiresAt = last.ExpiresAt
+		}
 		return token, nil
 	}
+	p.emit(ctx, Event{Type: EventCacheMiss, Key: key})
 
 	// Fetch token from server
-	token, expiry, err := p.fetcher.FetchToken(ctx)
+	token, err := p.fetch(ctx, key)
 	if err != nil {
-		return "", err
+		return p.staleToken(ctx, key, err)
 	}
+	return token, nil
+}
 
-	// Save token to cache
-	err = p.cache.Set(ctx, key, token, time.Duration(expiry)*time.Second)
+func (p *DefaultTokenProvider) RefreshAccessToken(ctx context.Context) (string, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	key := p.fetcher.GenerateCacheKey()
+	p.emit(ctx, Event{Type: EventRefresh, Key: key})
+	token, err := p.fetch(ctx, key)
 	if err != nil {
 		return "", err
 	}
 
-	return token, nil
+	return token.Value, nil
 }
 
-func (p *DefaultTokenProvider) RefreshAccessToken(ctx context.Context) (string, error) {
+func (p *DefaultTokenProvider) InvalidateAccessToken(ctx context.Context, rejectedToken string) error {
 	p.mutex.Lock()
 	defer p.mutex.Unlock()
 
 	key := p.fetcher.GenerateCacheKey()
-	token, expiry, err := p.fetcher.FetchToken(ctx)
+	p.forgetToken(key, rejectedToken)
+
+	current, err := p.cache.Get(ctx, key)
+	if err != nil || current != rejectedToken {
+		// Already evicted or replaced by a newer token.
+		return nil
+	}
+
+	if err := p.cache.Delete(ctx, key); err != nil {
+		return err
+	}
+	p.emit(ctx, Event{Type: EventInvalidate, Key: key})
+	return nil
+}
+
+type KeyHealth struct {
+	Key string
+	// ExpiresAt and TimeToExpiry describe the last successfully fetched token, zero if there is none.
+	ExpiresAt    time.Time
+	TimeToExpiry time.Duration
+	LastFetchAt  time.Time
+	// LastError is the error of the most recent fetch, nil if it succeeded.
+	LastError   error
+	LastErrorAt time.Time
+}
+
+// Healthy reports whether the last fetch succeeded and the token has not expired.
+func (h KeyHealth) Healthy() bool {
+	return h.LastError == nil && h.TimeToExpiry > 0
+}
+
+// HealthCheck reports the token state of every cache key this provider has fetched for, sorted by key.
+func (p *DefaultTokenProvider) HealthCheck() []KeyHealth {
+	now := p.now()
+
+	p.statesMutex.Lock()
+	defer p.statesMutex.Unlock()
+
+	health := make([]KeyHealth, 0, len(p.states))
+	for key, state := range p.states {
+		h := KeyHealth{
+			Key:         key,
+			ExpiresAt:   state.lastGood.ExpiresAt,
+			LastFetchAt: state.lastFetchAt,
+			LastError:   state.lastErr,
+			LastErrorAt: state.lastErrAt,
+		}
+		if !h.ExpiresAt.IsZero() {
+			h.TimeToExpiry = h.ExpiresAt.Sub(now)
+		}
+		health = append(health, h)
+	}
+	sort.Slice(health, func(i, j int) bool { return health[i].Key < health[j].Key })
+	return health
+}
+
+func (p *DefaultTokenProvider) fetch(ctx context.Context, key string) (Token, error) {
+	start := p.now()
+	p.emit(ctx, Event{Type: EventFetchStart, Key: key, Time: start})
+
+	value, expiry, err := p.fetcher.FetchToken(ctx)
 	if err != nil {
-		return "", err
+		p.recordFailure(key, err)
+		p.emit(ctx, Event{Type: EventFetchFailure, Key: key, Duration: p.now().Sub(start), Err: err})
+		return Token{}, err
 	}
 
-	err = p.cache.Set(ctx, key, token, time.Duration(expiry)*time.Second)
+	token := Token{Value: value, ExpiresAt: p.now().Add(time.Duration(expiry) * time.Second)}
+	p.rememberToken(key, token)
+	p.emit(ctx, Event{Type: EventFetchSuccess, Key: key, Duration: p.now().Sub(start), ExpiresAt: token.ExpiresAt})
+
+	// Save token to cache
+	err = p.cache.Set(ctx, key, value, time.Duration(expiry)*time.Second)
 	if err != nil {
-		return "", err
+		return Token{}, err
 	}
 
 	return token, nil
 }
+
+func (p *DefaultTokenProvider) staleToken(ctx context.Context, key string, fetchErr error) (Token, error) {
+	if !p.staleFallback {
+		return Token{}, fetchErr
+	}
+	last, ok := p.lastGoodToken(key)
+	if !ok || p.now().After(last.ExpiresAt.Add(p.staleGrace)) {
+		return Token{}, fetchErr
+	}
+
+	if p.logger != nil {
+		p.logger.Warn(ctx, "msg", "token fetch failed, serving stale access token",
+			"key", key, "expires_at", last.ExpiresAt, "error", fetchErr)
+	}
+	p.emit(ctx, Event{Type: EventStaleServed, Key: key, ExpiresAt: last.ExpiresAt, Err: fetchErr})
+	last.Stale = true
+	return last, nil
+}
+
+func (p *DefaultTokenProvider) emit(ctx context.Context, event Event) {
+	if len(p.observers) == 0 {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = p.now()
+	}
+	for _, observer := range p.observers {
+		observer.OnEvent(ctx, event)
+	}
+}
+
+func (p *DefaultTokenProvider) state(key string) *keyState {
+	state, ok := p.states[key]
+	if !ok {
+		state = &keyState{}
+		p.states[key] = state
+	}
+	return state
+}
+
+func (p *DefaultTokenProvider) rememberToken(key string, token Token) {
+	p.statesMutex.Lock()
+	defer p.statesMutex.Unlock()
+	state := p.state(key)
+	state.lastGood = token
+	state.lastFetchAt = p.now()
+	state.lastErr = nil
+}
+
+func (p *DefaultTokenProvider) recordFailure(key string, err error) {
+	p.statesMutex.Lock()
+	defer p.statesMutex.Unlock()
+	state := p.state(key)
+	state.lastErr = err
+	state.lastErrAt = p.now()
+}
+
+func (p *DefaultTokenProvider) forgetToken(key, value string) {
+	p.statesMutex.Lock()
+	defer p.statesMutex.Unlock()
+	if state, ok := p.states[key]; ok && state.lastGood.Value == value {
+		state.lastGood = Token{}
+	}
+}
+
+func (p *DefaultTokenProvider) lastGoodToken(key string) (Token, bool) {
+	p.statesMutex.Lock()
+	defer p.statesMutex.Unlock()
+	state, ok := p.states[key]
+	if !ok || state.lastGood.Value == "" {
+		return Token{}, false
+	}
+	return state.lastGood, true
+}
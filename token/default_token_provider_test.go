@@ -6,6 +6,9 @@ import (
 	"testing"
 	"time"
 
+	"github.com/Lumiaqian/go-sdk-core/cache"
+	"github.com/Lumiaqian/go-sdk-core/log"
+
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
@@ -131,3 +134,151 @@ func TestDefaultTokenProvider_RefreshAccessToken_Failure(t *testing.T) {
 	assert.Error(t, err)
 	assert.Equal(t, "", token)
 }
+
+type recordingLogger struct {
+	entries [][]any
+}
+
+func (l *recordingLogger) Log(ctx context.Context, level log.Level, keyvals ...any) {
+	l.entries = append(l.entries, keyvals)
+}
+
+func TestDefaultTokenProvider_GetToken_StaleFallback(t *testing.T) {
+	mockCache := new(MockCache)
+	mockFetcher := new(MockTokenFetcher)
+	logger := &recordingLogger{}
+	provider := NewDefaultTokenProvider(mockCache, mockFetcher, WithStaleFallback(time.Minute), WithLogger(logger))
+	now := time.Unix(1700000000, 0)
+	provider.now = func() time.Time { return now }
+
+	mockFetcher.On("GenerateCacheKey").Return("mockedCacheKey")
+	mockCache.On("Get", mock.Anything, "mockedCacheKey").Return("", errors.New("cache miss"))
+	mockCache.On("Set", mock.Anything, "mockedCacheKey", "goodToken", time.Hour).Return(nil)
+	mockFetcher.On("FetchToken", mock.Anything).Return("goodToken", int64(3600), nil).Once()
+
+	token, err := provider.GetToken(context.Background())
+	assert.NoError(t, err)
+	assert.False(t, token.Stale)
+	assert.Equal(t, now.Add(time.Hour), token.ExpiresAt)
+
+	// The cache entry is gone and the token endpoint is down.
+	mockFetcher.On("FetchToken", mock.Anything).Return("", int64(0), errors.New("fetcher error"))
+
+	now = now.Add(30 * time.Minute)
+	token, err = provider.GetToken(context.Background())
+	assert.NoError(t, err)
+	assert.True(t, token.Stale)
+	assert.Equal(t, "goodToken", token.Value)
+	assert.Len(t, logger.entries, 1)
+
+	// Within the grace window after the real expiry.
+	now = now.Add(30*time.Minute + 30*time.Second)
+	value, err := provider.GetAccessToken(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "goodToken", value)
+
+	// Past the grace window.
+	now = now.Add(time.Minute)
+	_, err = provider.GetToken(context.Background())
+	assert.EqualError(t, err, "fetcher error")
+}
+
+func TestDefaultTokenProvider_GetToken_NoFallbackByDefault(t *testing.T) {
+	mockCache := new(MockCache)
+	mockFetcher := new(MockTokenFetcher)
+	provider := NewDefaultTokenProvider(mockCache, mockFetcher)
+
+	mockFetcher.On("GenerateCacheKey").Return("mockedCacheKey")
+	mockCache.On("Set", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	mockFetcher.On("FetchToken", mock.Anything).Return("goodToken", int64(3600), nil).Once()
+	_, err := provider.RefreshAccessToken(context.Background())
+	assert.NoError(t, err)
+
+	mockCache.On("Get", mock.Anything, "mockedCacheKey").Return("", errors.New("cache miss"))
+	mockFetcher.On("FetchToken", mock.Anything).Return("", int64(0), errors.New("fetcher error"))
+	_, err = provider.GetToken(context.Background())
+	assert.Error(t, err)
+}
+
+func TestDefaultTokenProvider_InvalidateAccessToken(t *testing.T) {
+	mockCache := new(MockCache)
+	mockFetcher := new(MockTokenFetcher)
+	provider := NewDefaultTokenProvider(mockCache, mockFetcher)
+
+	mockFetcher.On("GenerateCacheKey").Return("mockedCacheKey")
+	mockCache.On("Get", mock.Anything, "mockedCacheKey").Return("cachedToken", nil)
+	mockCache.On("Delete", mock.Anything, "mockedCacheKey").Return(nil)
+
+	// A token that has already been replaced is not evicted.
+	err := provider.InvalidateAccessToken(context.Background(), "olderToken")
+	assert.NoError(t, err)
+	mockCache.AssertNotCalled(t, "Delete", mock.Anything, mock.Anything)
+
+	err = provider.InvalidateAccessToken(context.Background(), "cachedToken")
+	assert.NoError(t, err)
+	mockCache.AssertCalled(t, "Delete", mock.Anything, "mockedCacheKey")
+}
+
+func TestDefaultTokenProvider_InvalidateAccessToken_ForgetsStaleToken(t *testing.T) {
+	mockCache := new(MockCache)
+	mockFetcher := new(MockTokenFetcher)
+	provider := NewDefaultTokenProvider(mockCache, mockFetcher, WithStaleFallback(time.Hour))
+
+	mockFetcher.On("GenerateCacheKey").Return("mockedCacheKey")
+	mockCache.On("Set", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	mockFetcher.On("FetchToken", mock.Anything).Return("rejectedToken", int64(3600), nil).Once()
+	_, err := provider.RefreshAccessToken(context.Background())
+	assert.NoError(t, err)
+
+	mockCache.On("Get", mock.Anything, "mockedCacheKey").Return("", errors.New("cache miss"))
+	assert.NoError(t, provider.InvalidateAccessToken(context.Background(), "rejectedToken"))
+
+	// The rejected token must not come back as a stale fallback.
+	mockFetcher.On("FetchToken", mock.Anything).Return("", int64(0), errors.New("fetcher error"))
+	_, err = provider.GetToken(context.Background())
+	assert.Error(t, err)
+}
+
+type MockInvalidator struct {
+	mock.Mock
+}
+
+func (m *MockInvalidator) InvalidateAccessToken(ctx context.Context, rejectedToken string) error {
+	args := m.Called(ctx, rejectedToken)
+	return args.Error(0)
+}
+
+func TestInvalidateOnCodes(t *testing.T) {
+	invalidator := new(MockInvalidator)
+	invalidator.On("InvalidateAccessToken", mock.Anything, "badToken").Return(nil)
+	hook := InvalidateOnCodes(invalidator, 40001, 42001)
+
+	assert.NoError(t, hook(context.Background(), "badToken", 0))
+	assert.NoError(t, hook(context.Background(), "badToken", 45009))
+	invalidator.AssertNotCalled(t, "InvalidateAccessToken", mock.Anything, mock.Anything)
+
+	assert.NoError(t, hook(context.Background(), "badToken", 42001))
+	invalidator.AssertNumberOfCalls(t, "InvalidateAccessToken", 1)
+}
+
+func TestDefaultTokenProvider_EncryptedCache(t *testing.T) {
+	backend := cache.NewMemcache(time.Minute, time.Minute)
+	encrypted, err := cache.NewEncryptedCache(backend, "k1", map[string][]byte{"k1": []byte("0123456789abcdef")})
+	assert.NoError(t, err)
+
+	mockFetcher := new(MockTokenFetcher)
+	mockFetcher.On("GenerateCacheKey").Return("mockedCacheKey")
+	mockFetcher.On("FetchToken", mock.Anything).Return("fetchedToken", int64(3600), nil).Once()
+	provider := NewDefaultTokenProvider(encrypted, mockFetcher)
+
+	for i := 0; i < 2; i++ {
+		token, err := provider.GetAccessToken(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, "fetchedToken", token)
+	}
+	mockFetcher.AssertNumberOfCalls(t, "FetchToken", 1)
+
+	raw, err := backend.Get(context.Background(), "mockedCacheKey")
+	assert.NoError(t, err)
+	assert.NotContains(t, raw, "fetchedToken")
+}
@@ -0,0 +1,181 @@
+package jwt
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Lumiaqian/go-sdk-core/rest"
+)
+
+// GrantTypeJWTBearer is the RFC 7523 grant type used when exchanging an assertion.
+const GrantTypeJWTBearer = "urn:ietf:params:oauth:grant-type:jwt-bearer"
+
+type Mode int
+
+const (
+	// ModeDirect uses the signed JWT itself as the access token (e.g. Apple APNs).
+	ModeDirect Mode = iota
+	// ModeExchange posts the signed JWT as an assertion to TokenURL and uses the returned access token
+	// (e.g. Google service accounts).
+	ModeExchange
+)
+
+type Config struct {
+	Mode   Mode
+	Signer Signer
+	KeyID  string
+
+	Issuer   string
+	Subject  string
+	Audience string
+	Scope    string
+	// ExtraClaims are merged into the claim set, registered claims take precedence.
+	ExtraClaims map[string]any
+
+	// Lifetime of the signed JWT, defaults to one hour. In ModeDirect it is also the token expiry.
+	Lifetime time.Duration
+	// OmitExpiry leaves out the exp claim for vendors that reject it (APNs only accepts iss and iat).
+	OmitExpiry bool
+
+	// TokenURL, GrantType and Client are only used in ModeExchange. GrantType defaults to GrantTypeJWTBearer.
+	TokenURL  string
+	GrantType string
+	Client    rest.Client
+
+	// Now overrides the clock, mainly for tests.
+	Now func() time.Time
+}
+
+// Fetcher is a token.TokenFetcher that authenticates with a self-signed JWT.
+type Fetcher struct {
+	config Config
+}
+
+func NewFetcher(config Config) (*Fetcher, error) {
+	if config.Signer == nil {
+		return nil, errors.New("jwt: signer cannot be nil")
+	}
+	if config.Lifetime <= 0 {
+		config.Lifetime = time.Hour
+	}
+	if config.Now == nil {
+		config.Now = time.Now
+	}
+
+	switch config.Mode {
+	case ModeDirect:
+	case ModeExchange:
+		if config.TokenURL == "" {
+			return nil, errors.New("jwt: token url is required in exchange mode")
+		}
+		if config.Client == nil {
+			return nil, errors.New("jwt: rest client is required in exchange mode")
+		}
+		if config.GrantType == "" {
+			config.GrantType = GrantTypeJWTBearer
+		}
+	default:
+		return nil, fmt.Errorf("jwt: unknown mode %d", config.Mode)
+	}
+
+	return &Fetcher{config: config}, nil
+}
+
+// Assertion signs a fresh JWT from the configured claims.
+func (f *Fetcher) Assertion() (string, error) {
+	now := f.config.Now()
+
+	claims := Claims{
+		Issuer:   f.config.Issuer,
+		Subject:  f.config.Subject,
+		Audience: f.config.Audience,
+		IssuedAt: now.Unix(),
+		Extra:    make(map[string]any, len(f.config.ExtraClaims)+1),
+	}
+	if !f.config.OmitExpiry {
+		claims.ExpiresAt = now.Add(f.config.Lifetime).Unix()
+	}
+	for k, v := range f.config.ExtraClaims {
+		claims.Extra[k] = v
+	}
+	if f.config.Scope != "" {
+		claims.Extra["scope"] = f.config.Scope
+	}
+
+	return Sign(f.config.Signer, Header{KeyID: f.config.KeyID}, claims)
+}
+
+func (f *Fetcher) FetchToken(ctx context.Context) (string, int64, error) {
+	assertion, err := f.Assertion()
+	if err != nil {
+		return "", 0, err
+	}
+
+	if f.config.Mode == ModeDirect {
+		return assertion, int64(f.config.Lifetime / time.Second), nil
+	}
+
+	return f.exchange(ctx, assertion)
+}
+
+func (f *Fetcher) GenerateCacheKey() string {
+	parts := []string{
+		f.config.Signer.Algorithm(),
+		f.config.KeyID,
+		f.config.Issuer,
+		f.config.Subject,
+		f.config.Audience,
+		f.config.Scope,
+		f.config.TokenURL,
+	}
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+	return "jwt_token:" + hex.EncodeToString(sum[:8])
+}
+
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int64  `json:"expires_in"`
+	Error       string `json:"error"`
+	Description string `json:"error_description"`
+}
+
+func (f *Fetcher) exchange(ctx context.Context, assertion string) (string, int64, error) {
+	form := url.Values{}
+	form.Set("grant_type", f.config.GrantType)
+	form.Set("assertion", assertion)
+
+	headers := map[string]string{
+		"Content-Type": "application/x-www-form-urlencoded",
+		"Accept":       "application/json",
+	}
+	resp, err := f.config.Client.DoRequest(ctx, http.MethodPost, f.config.TokenURL, headers, &rest.RequestPayload{
+		Body: strings.NewReader(form.Encode()),
+	})
+	if err != nil {
+		return "", 0, err
+	}
+
+	var result tokenResponse
+	if err := json.Unmarshal(resp.Body, &result); err != nil && resp.StatusCode < http.StatusBadRequest {
+		return "", 0, fmt.Errorf("jwt: decode token response: %w", err)
+	}
+	if resp.StatusCode >= http.StatusBadRequest || result.Error != "" {
+		if result.Error != "" {
+			return "", 0, fmt.Errorf("jwt: token exchange failed with status %d: %s %s", resp.StatusCode, result.Error, result.Description)
+		}
+		return "", 0, fmt.Errorf("jwt: token exchange failed with status %d: %s", resp.StatusCode, resp.Body)
+	}
+	if result.AccessToken == "" {
+		return "", 0, errors.New("jwt: token response has no access_token")
+	}
+
+	return result.AccessToken, result.ExpiresIn, nil
+}
@@ -0,0 +1,84 @@
+package jwt
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+)
+
+// Header is the JOSE header of a signed JWT.
+type Header struct {
+	Algorithm string `json:"alg"`
+	Type      string `json:"typ,omitempty"`
+	KeyID     string `json:"kid,omitempty"`
+}
+
+// Claims holds the registered claims plus any vendor specific ones in Extra.
+type Claims struct {
+	Issuer    string
+	Subject   string
+	Audience  string
+	ExpiresAt int64
+	NotBefore int64
+	IssuedAt  int64
+	ID        string
+	Extra     map[string]any
+}
+
+func (c Claims) MarshalJSON() ([]byte, error) {
+	m := make(map[string]any, len(c.Extra)+7)
+	for k, v := range c.Extra {
+		m[k] = v
+	}
+	setString := func(k, v string) {
+		if v != "" {
+			m[k] = v
+		}
+	}
+	setInt := func(k string, v int64) {
+		if v != 0 {
+			m[k] = v
+		}
+	}
+	setString("iss", c.Issuer)
+	setString("sub", c.Subject)
+	setString("aud", c.Audience)
+	setInt("exp", c.ExpiresAt)
+	setInt("nbf", c.NotBefore)
+	setInt("iat", c.IssuedAt)
+	setString("jti", c.ID)
+	return json.Marshal(m)
+}
+
+// Sign encodes header and claims and signs them with signer, returning the compact serialization.
+// The header algorithm is always taken from the signer.
+func Sign(signer Signer, header Header, claims Claims) (string, error) {
+	if signer == nil {
+		return "", errors.New("jwt: signer cannot be nil")
+	}
+	header.Algorithm = signer.Algorithm()
+	if header.Type == "" {
+		header.Type = "JWT"
+	}
+
+	headerJSON, err := json.Marshal(header)
+	if err != nil {
+		return "", err
+	}
+	claimsJSON, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := encodeSegment(headerJSON) + "." + encodeSegment(claimsJSON)
+	signature, err := signer.Sign([]byte(signingInput))
+	if err != nil {
+		return "", err
+	}
+
+	return signingInput + "." + encodeSegment(signature), nil
+}
+
+func encodeSegment(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,210 @@
+package jwt
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Lumiaqian/go-sdk-core/cache"
+	"github.com/Lumiaqian/go-sdk-core/rest"
+	"github.com/Lumiaqian/go-sdk-core/token"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func decodeSegment(t *testing.T, s string) []byte {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	require.NoError(t, err)
+	return b
+}
+
+func TestHS256Signer_RFC7515Vector(t *testing.T) {
+	// RFC 7515 appendix A.1
+	key, err := base64.RawURLEncoding.DecodeString("AyM1SysPpbyDfgZld3umj1qzKObwVMkoqQ-EstJQLr_T-1qS0gZH75aKtMN3Yj0iPS4hcgUuTwjAzZr1Z9CAow")
+	require.NoError(t, err)
+	signer, err := NewHS256Signer(key)
+	require.NoError(t, err)
+
+	signingInput := "eyJ0eXAiOiJKV1QiLA0KICJhbGciOiJIUzI1NiJ9" +
+		"." +
+		"eyJpc3MiOiJqb2UiLA0KICJleHAiOjEzMDA4MTkzODAsDQogImh0dHA6Ly9leGFtcGxlLmNvbS9pc19yb290Ijp0cnVlfQ"
+	sig, err := signer.Sign([]byte(signingInput))
+	require.NoError(t, err)
+	assert.Equal(t, "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk", encodeSegment(sig))
+}
+
+func TestRS256Signer(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	pemKey := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+
+	signer, err := NewRS256Signer(pemKey)
+	require.NoError(t, err)
+
+	jwt, err := Sign(signer, Header{KeyID: "kid-1"}, Claims{Issuer: "svc@example.com", IssuedAt: 1700000000})
+	require.NoError(t, err)
+
+	parts := strings.Split(jwt, ".")
+	require.Len(t, parts, 3)
+	assert.JSONEq(t, `{"alg":"RS256","typ":"JWT","kid":"kid-1"}`, string(decodeSegment(t, parts[0])))
+	assert.JSONEq(t, `{"iss":"svc@example.com","iat":1700000000}`, string(decodeSegment(t, parts[1])))
+
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	assert.NoError(t, rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, digest[:], decodeSegment(t, parts[2])))
+}
+
+func TestES256Signer(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	pemKey := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+
+	signer, err := NewES256Signer(pemKey)
+	require.NoError(t, err)
+
+	jwt, err := Sign(signer, Header{}, Claims{Issuer: "TEAMID"})
+	require.NoError(t, err)
+
+	parts := strings.Split(jwt, ".")
+	require.Len(t, parts, 3)
+	sig := decodeSegment(t, parts[2])
+	require.Len(t, sig, 64)
+
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	r := new(big.Int).SetBytes(sig[:32])
+	s := new(big.Int).SetBytes(sig[32:])
+	assert.True(t, ecdsa.Verify(&key.PublicKey, digest[:], r, s))
+}
+
+func TestSigner_InvalidKeys(t *testing.T) {
+	_, err := NewRS256Signer([]byte("not a pem"))
+	assert.Error(t, err)
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalECPrivateKey(ecKey)
+	require.NoError(t, err)
+	_, err = NewRS256Signer(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}))
+	assert.Error(t, err)
+
+	_, err = NewHS256Signer(nil)
+	assert.Error(t, err)
+}
+
+func TestFetcher_DirectMode(t *testing.T) {
+	signer, err := NewHS256Signer([]byte("secret"))
+	require.NoError(t, err)
+	now := time.Unix(1700000000, 0)
+
+	fetcher, err := NewFetcher(Config{
+		Signer:      signer,
+		Issuer:      "app-id",
+		Lifetime:    30 * time.Minute,
+		ExtraClaims: map[string]any{"app": "demo"},
+		Now:         func() time.Time { return now },
+	})
+	require.NoError(t, err)
+
+	tok, expiry, err := fetcher.FetchToken(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, int64(1800), expiry)
+
+	parts := strings.Split(tok, ".")
+	require.Len(t, parts, 3)
+	var claims map[string]any
+	require.NoError(t, json.Unmarshal(decodeSegment(t, parts[1]), &claims))
+	assert.Equal(t, "app-id", claims["iss"])
+	assert.Equal(t, "demo", claims["app"])
+	assert.Equal(t, float64(now.Unix()), claims["iat"])
+	assert.Equal(t, float64(now.Add(30*time.Minute).Unix()), claims["exp"])
+}
+
+func TestFetcher_OmitExpiry(t *testing.T) {
+	signer, err := NewHS256Signer([]byte("secret"))
+	require.NoError(t, err)
+
+	fetcher, err := NewFetcher(Config{Signer: signer, Issuer: "TEAMID", OmitExpiry: true})
+	require.NoError(t, err)
+
+	tok, _, err := fetcher.FetchToken(context.Background())
+	require.NoError(t, err)
+	var claims map[string]any
+	require.NoError(t, json.Unmarshal(decodeSegment(t, strings.Split(tok, ".")[1]), &claims))
+	assert.NotContains(t, claims, "exp")
+}
+
+func TestFetcher_ExchangeMode(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		require.NoError(t, r.ParseForm())
+		assert.Equal(t, GrantTypeJWTBearer, r.Form.Get("grant_type"))
+		assert.Len(t, strings.Split(r.Form.Get("assertion"), "."), 3)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token":"exchanged","expires_in":3599,"token_type":"Bearer"}`))
+	}))
+	defer server.Close()
+
+	signer, err := NewHS256Signer([]byte("secret"))
+	require.NoError(t, err)
+	fetcher, err := NewFetcher(Config{
+		Mode:     ModeExchange,
+		Signer:   signer,
+		Issuer:   "svc@example.com",
+		Audience: server.URL,
+		Scope:    "https://www.googleapis.com/auth/cloud-platform",
+		TokenURL: server.URL,
+		Client:   rest.NewDefaultHttpClient(),
+	})
+	require.NoError(t, err)
+
+	provider := token.NewDefaultTokenProvider(cache.NewMemcache(time.Minute, time.Minute), fetcher)
+	tok, err := provider.GetAccessToken(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "exchanged", tok)
+}
+
+func TestFetcher_ExchangeError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error":"invalid_grant","error_description":"Invalid JWT Signature."}`))
+	}))
+	defer server.Close()
+
+	signer, err := NewHS256Signer([]byte("secret"))
+	require.NoError(t, err)
+	fetcher, err := NewFetcher(Config{Mode: ModeExchange, Signer: signer, TokenURL: server.URL, Client: rest.NewDefaultHttpClient()})
+	require.NoError(t, err)
+
+	_, _, err = fetcher.FetchToken(context.Background())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid_grant")
+}
+
+func TestNewFetcher_Validation(t *testing.T) {
+	signer, err := NewHS256Signer([]byte("secret"))
+	require.NoError(t, err)
+
+	_, err = NewFetcher(Config{})
+	assert.Error(t, err)
+	_, err = NewFetcher(Config{Mode: ModeExchange, Signer: signer})
+	assert.Error(t, err)
+	_, err = NewFetcher(Config{Mode: ModeExchange, Signer: signer, TokenURL: "https://example.com/token"})
+	assert.Error(t, err)
+}
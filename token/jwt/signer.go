@@ -0,0 +1,133 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+)
+
+const (
+	AlgRS256 = "RS256"
+	AlgES256 = "ES256"
+	AlgHS256 = "HS256"
+)
+
+// Signer produces the signature part of a JWS for a fixed algorithm.
+type Signer interface {
+	// Algorithm returns the JOSE "alg" header value, e.g. RS256.
+	Algorithm() string
+	// Sign signs the JWS signing input (base64url(header) + "." + base64url(payload)).
+	Sign(signingInput []byte) ([]byte, error)
+}
+
+type rsaSigner struct {
+	key *rsa.PrivateKey
+}
+
+// NewRS256Signer creates an RS256 signer from a PEM encoded PKCS#1 or PKCS#8 RSA private key.
+func NewRS256Signer(pemKey []byte) (Signer, error) {
+	key, err := parsePrivateKey(pemKey)
+	if err != nil {
+		return nil, err
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("jwt: RS256 requires an RSA private key, got %T", key)
+	}
+	return &rsaSigner{key: rsaKey}, nil
+}
+
+func (s *rsaSigner) Algorithm() string {
+	return AlgRS256
+}
+
+func (s *rsaSigner) Sign(signingInput []byte) ([]byte, error) {
+	digest := sha256.Sum256(signingInput)
+	return rsa.SignPKCS1v15(rand.Reader, s.key, crypto.SHA256, digest[:])
+}
+
+type ecdsaSigner struct {
+	key *ecdsa.PrivateKey
+}
+
+// NewES256Signer creates an ES256 signer from a PEM encoded SEC 1 or PKCS#8 P-256 private key,
+// such as the .p8 keys issued by Apple.
+func NewES256Signer(pemKey []byte) (Signer, error) {
+	key, err := parsePrivateKey(pemKey)
+	if err != nil {
+		return nil, err
+	}
+	ecKey, ok := key.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("jwt: ES256 requires an ECDSA private key, got %T", key)
+	}
+	if ecKey.Curve != elliptic.P256() {
+		return nil, errors.New("jwt: ES256 requires a P-256 private key")
+	}
+	return &ecdsaSigner{key: ecKey}, nil
+}
+
+func (s *ecdsaSigner) Algorithm() string {
+	return AlgES256
+}
+
+func (s *ecdsaSigner) Sign(signingInput []byte) ([]byte, error) {
+	digest := sha256.Sum256(signingInput)
+	r, sig, err := ecdsa.Sign(rand.Reader, s.key, digest[:])
+	if err != nil {
+		return nil, err
+	}
+	// JWS uses the fixed width R || S encoding instead of ASN.1 DER.
+	out := make([]byte, 64)
+	r.FillBytes(out[:32])
+	sig.FillBytes(out[32:])
+	return out, nil
+}
+
+type hmacSigner struct {
+	secret []byte
+}
+
+// NewHS256Signer creates an HS256 signer using the given shared secret.
+func NewHS256Signer(secret []byte) (Signer, error) {
+	if len(secret) == 0 {
+		return nil, errors.New("jwt: HS256 secret cannot be empty")
+	}
+	return &hmacSigner{secret: secret}, nil
+}
+
+func (s *hmacSigner) Algorithm() string {
+	return AlgHS256
+}
+
+func (s *hmacSigner) Sign(signingInput []byte) ([]byte, error) {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write(signingInput)
+	return mac.Sum(nil), nil
+}
+
+func parsePrivateKey(pemKey []byte) (crypto.PrivateKey, error) {
+	block, _ := pem.Decode(pemKey)
+	if block == nil {
+		return nil, errors.New("jwt: no PEM block found in private key")
+	}
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		return x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("jwt: unsupported PEM block type %q", block.Type)
+	}
+}
@@ -0,0 +1,78 @@
+package token
+
+import (
+	"context"
+	"time"
+
+	"github.com/Lumiaqian/go-sdk-core/metrics"
+)
+
+type EventType string
+
+const (
+	EventCacheHit     EventType = "cache_hit"
+	EventCacheMiss    EventType = "cache_miss"
+	EventFetchStart   EventType = "fetch_start"
+	EventFetchSuccess EventType = "fetch_success"
+	EventFetchFailure EventType = "fetch_failure"
+	EventRefresh      EventType = "refresh"
+	EventInvalidate   EventType = "invalidate"
+	EventStaleServed  EventType = "stale_served"
+)
+
+type Event struct {
+	Type EventType
+	Key  string
+	Time time.Time
+	// Duration is set on fetch success and failure events.
+	Duration time.Duration
+	// ExpiresAt is set on fetch success and stale served events.
+	ExpiresAt time.Time
+	// Err is set on fetch failure and stale served events.
+	Err error
+}
+
+// Observer receives the lifecycle events of a DefaultTokenProvider. OnEvent is called synchronously
+// on the request path and must not block.
+type Observer interface {
+	OnEvent(ctx context.Context, event Event)
+}
+
+type ObserverFunc func(ctx context.Context, event Event)
+
+func (f ObserverFunc) OnEvent(ctx context.Context, event Event) {
+	f(ctx, event)
+}
+
+const (
+	MetricEventsTotal          = "sdk_token_events_total"
+	MetricFetchDurationSeconds = "sdk_token_fetch_duration_seconds"
+	MetricExpiryTimestamp      = "sdk_token_expiry_timestamp_seconds"
+)
+
+type metricsObserver struct {
+	recorder metrics.Recorder
+}
+
+// NewMetricsObserver records event counts, fetch latency and token expiry into recorder.
+// When recorder is a *metrics.Registry the help texts are registered as well.
+func NewMetricsObserver(recorder metrics.Recorder) Observer {
+	if registry, ok := recorder.(*metrics.Registry); ok {
+		registry.SetHelp(MetricEventsTotal, "Token provider lifecycle events.")
+		registry.SetHelp(MetricFetchDurationSeconds, "Latency of token fetches from the remote server.")
+		registry.SetHelp(MetricExpiryTimestamp, "Unix time at which the last fetched token expires.")
+	}
+	return &metricsObserver{recorder: recorder}
+}
+
+func (o *metricsObserver) OnEvent(ctx context.Context, event Event) {
+	o.recorder.IncCounter(MetricEventsTotal, metrics.Labels{"key": event.Key, "event": string(event.Type)})
+
+	switch event.Type {
+	case EventFetchSuccess:
+		o.recorder.ObserveHistogram(MetricFetchDurationSeconds, metrics.Labels{"key": event.Key, "result": "success"}, event.Duration.Seconds())
+		o.recorder.SetGauge(MetricExpiryTimestamp, metrics.Labels{"key": event.Key}, float64(event.ExpiresAt.Unix()))
+	case EventFetchFailure:
+		o.recorder.ObserveHistogram(MetricFetchDurationSeconds, metrics.Labels{"key": event.Key, "result": "failure"}, event.Duration.Seconds())
+	}
+}
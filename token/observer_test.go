@@ -0,0 +1,106 @@
+package token
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Lumiaqian/go-sdk-core/metrics"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDefaultTokenProvider_Events(t *testing.T) {
+	mockCache := new(MockCache)
+	mockFetcher := new(MockTokenFetcher)
+	var events []EventType
+	observer := ObserverFunc(func(ctx context.Context, event Event) {
+		assert.Equal(t, "mockedCacheKey", event.Key)
+		assert.False(t, event.Time.IsZero())
+		events = append(events, event.Type)
+	})
+	provider := NewDefaultTokenProvider(mockCache, mockFetcher, WithObserver(observer))
+
+	mockFetcher.On("GenerateCacheKey").Return("mockedCacheKey")
+	mockCache.On("Get", mock.Anything, "mockedCacheKey").Return("", errors.New("cache miss")).Once()
+	mockFetcher.On("FetchToken", mock.Anything).Return("fetchedToken", int64(3600), nil).Once()
+	mockCache.On("Set", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	_, err := provider.GetAccessToken(context.Background())
+	require.NoError(t, err)
+
+	mockCache.On("Get", mock.Anything, "mockedCacheKey").Return("fetchedToken", nil)
+	_, err = provider.GetAccessToken(context.Background())
+	require.NoError(t, err)
+
+	mockCache.On("Delete", mock.Anything, "mockedCacheKey").Return(nil)
+	require.NoError(t, provider.InvalidateAccessToken(context.Background(), "fetchedToken"))
+
+	mockFetcher.On("FetchToken", mock.Anything).Return("", int64(0), errors.New("fetcher error"))
+	_, err = provider.RefreshAccessToken(context.Background())
+	require.Error(t, err)
+
+	assert.Equal(t, []EventType{
+		EventCacheMiss, EventFetchStart, EventFetchSuccess,
+		EventCacheHit,
+		EventInvalidate,
+		EventRefresh, EventFetchStart, EventFetchFailure,
+	}, events)
+}
+
+func TestMetricsObserver(t *testing.T) {
+	registry := metrics.NewRegistry()
+	observer := NewMetricsObserver(registry)
+	ctx := context.Background()
+
+	observer.OnEvent(ctx, Event{Type: EventCacheHit, Key: "k"})
+	observer.OnEvent(ctx, Event{Type: EventFetchSuccess, Key: "k", Duration: 20 * time.Millisecond, ExpiresAt: time.Unix(1700000000, 0)})
+	observer.OnEvent(ctx, Event{Type: EventFetchFailure, Key: "k", Duration: time.Second})
+
+	var sb strings.Builder
+	require.NoError(t, registry.WriteText(&sb))
+	out := sb.String()
+	assert.Contains(t, out, `sdk_token_events_total{event="cache_hit",key="k"} 1`)
+	assert.Contains(t, out, `sdk_token_events_total{event="fetch_failure",key="k"} 1`)
+	assert.Contains(t, out, `sdk_token_fetch_duration_seconds_count{key="k",result="success"} 1`)
+	assert.Contains(t, out, `sdk_token_fetch_duration_seconds_sum{key="k",result="failure"} 1`)
+	assert.Contains(t, out, `sdk_token_expiry_timestamp_seconds{key="k"} 1.7e+09`)
+	assert.Contains(t, out, "# HELP sdk_token_events_total")
+}
+
+func TestDefaultTokenProvider_HealthCheck(t *testing.T) {
+	mockCache := new(MockCache)
+	mockFetcher := new(MockTokenFetcher)
+	provider := NewDefaultTokenProvider(mockCache, mockFetcher)
+	now := time.Unix(1700000000, 0)
+	provider.now = func() time.Time { return now }
+
+	assert.Empty(t, provider.HealthCheck())
+
+	mockFetcher.On("GenerateCacheKey").Return("mockedCacheKey")
+	mockCache.On("Set", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	mockFetcher.On("FetchToken", mock.Anything).Return("fetchedToken", int64(3600), nil).Once()
+	_, err := provider.RefreshAccessToken(context.Background())
+	require.NoError(t, err)
+
+	now = now.Add(10 * time.Minute)
+	health := provider.HealthCheck()
+	require.Len(t, health, 1)
+	assert.Equal(t, "mockedCacheKey", health[0].Key)
+	assert.Equal(t, 50*time.Minute, health[0].TimeToExpiry)
+	assert.True(t, health[0].Healthy())
+
+	mockFetcher.On("FetchToken", mock.Anything).Return("", int64(0), errors.New("fetcher error"))
+	_, err = provider.RefreshAccessToken(context.Background())
+	require.Error(t, err)
+
+	health = provider.HealthCheck()
+	require.Len(t, health, 1)
+	assert.EqualError(t, health[0].LastError, "fetcher error")
+	assert.Equal(t, now, health[0].LastErrorAt)
+	assert.Equal(t, 50*time.Minute, health[0].TimeToExpiry)
+	assert.False(t, health[0].Healthy())
+}
@@ -2,6 +2,7 @@ package token
 
 import (
 	"context"
+	"time"
 )
 
 type TokenProvider interface {
@@ -12,9 +13,43 @@ type TokenProvider interface {
 	RefreshAccessToken(ctx context.Context) (string, error)
 }
 
+type TokenInvalidator interface {
+	// InvalidateAccessToken evicts the cached token only if it still equals rejectedToken,
+	// so concurrent callers that saw the same token fail trigger a single refresh.
+	InvalidateAccessToken(ctx context.Context, rejectedToken string) error
+}
+
+// InvalidationHook is called by response error decoders with the token a request was sent with
+// and the vendor error code it failed with.
+type InvalidationHook func(ctx context.Context, token string, errCode int) error
+
+// InvalidateOnCodes returns a hook invalidating the token when errCode is one of codes,
+// e.g. 40001 and 42001 for WeChat.
+func InvalidateOnCodes(invalidator TokenInvalidator, codes ...int) InvalidationHook {
+	set := make(map[int]struct{}, len(codes))
+	for _, code := range codes {
+		set[code] = struct{}{}
+	}
+	return func(ctx context.Context, token string, errCode int) error {
+		if _, ok := set[errCode]; !ok || token == "" {
+			return nil
+		}
+		return invalidator.InvalidateAccessToken(ctx, token)
+	}
+}
+
 type TokenFetcher interface {
 	// FetchToken retrieves an access token from a remote server
 	FetchToken(ctx context.Context) (token string, expiry int64, err error)
 	// GenerateCacheKey generates a cache key
 	GenerateCacheKey() string
 }
+
+type Token struct {
+	Value string
+	// ExpiresAt is the expiry reported by the fetcher, zero when the token came from a cache
+	// entry this provider did not write.
+	ExpiresAt time.Time
+	// Stale is set when the token was served from the last known good token because fetching failed.
+	Stale bool
+}
@@ -0,0 +1,73 @@
+package tools
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// PercentEncode escapes s as RFC 3986 requires: everything except A-Z, a-z, 0-9, '-', '.', '_' and
+// '~' is percent-encoded with upper-case hex, so spaces become %20 rather than '+'.
+func PercentEncode(s string) string {
+	const hexDigits = "0123456789ABCDEF"
+	var b strings.Builder
+	b.Grow(len(s))
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if isUnreserved(c) {
+			b.WriteByte(c)
+			continue
+		}
+		b.WriteByte('%')
+		b.WriteByte(hexDigits[c>>4])
+		b.WriteByte(hexDigits[c&0x0f])
+	}
+	return b.String()
+}
+
+func isUnreserved(c byte) bool {
+	return 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' ||
+		c == '-' || c == '.' || c == '_' || c == '~'
+}
+
+// CanonicalQuery encodes values sorted by key and then by value, with keys and values
+// percent-encoded by PercentEncode. Repeated keys are kept.
+func CanonicalQuery(values url.Values) string {
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	for _, k := range keys {
+		vs := append([]string(nil), values[k]...)
+		sort.Strings(vs)
+		for _, v := range vs {
+			if b.Len() > 0 {
+				b.WriteByte('&')
+			}
+			b.WriteString(PercentEncode(k))
+			b.WriteByte('=')
+			b.WriteString(PercentEncode(v))
+		}
+	}
+	return b.String()
+}
+
+// HashBody returns the lower-case hex SHA-256 of body. An empty body hashes to
+// e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855.
+func HashBody(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// HMACSHA256 returns the HMAC-SHA256 of data keyed with key.
+func HMACSHA256(key, data []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
@@ -0,0 +1,33 @@
+package tools
+
+import (
+	"encoding/hex"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPercentEncode(t *testing.T) {
+	assert.Equal(t, "AZaz09-._~", PercentEncode("AZaz09-._~"))
+	assert.Equal(t, "a%20b%2Bc%2A%2F%3D", PercentEncode("a b+c*/="))
+	assert.Equal(t, "%E4%BD%A0", PercentEncode("你"))
+}
+
+func TestCanonicalQuery(t *testing.T) {
+	values := url.Values{
+		"b": {"x y"},
+		"a": {"2", "1"},
+		"c": {"~"},
+	}
+	assert.Equal(t, "a=1&a=2&b=x%20y&c=~", CanonicalQuery(values))
+	assert.Equal(t, "", CanonicalQuery(nil))
+}
+
+func TestHashes(t *testing.T) {
+	assert.Equal(t, "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855", HashBody(nil))
+
+	// RFC 4231, test case 2.
+	mac := HMACSHA256([]byte("Jefe"), []byte("what do ya want for nothing?"))
+	assert.Equal(t, "5bdcc146bf60754e6a042426089575c75a003f089d2739839dec58b964ec3843", hex.EncodeToString(mac))
+}
@@ -0,0 +1,158 @@
+// Package trace is a small tracing abstraction without external dependencies. Tracer and Span can
+// be backed by the tracer in this package or adapted to a full tracing library.
+package trace
+
+import (
+	"context"
+	"encoding/hex"
+)
+
+// TraceID identifies a trace, SpanID a span within it. The zero values are invalid.
+type (
+	TraceID [16]byte
+	SpanID  [8]byte
+)
+
+func (t TraceID) IsValid() bool  { return t != TraceID{} }
+func (t TraceID) String() string { return hex.EncodeToString(t[:]) }
+func (s SpanID) IsValid() bool   { return s != SpanID{} }
+func (s SpanID) String() string  { return hex.EncodeToString(s[:]) }
+
+// FlagSampled is the W3C trace flag marking a sampled trace.
+const FlagSampled byte = 0x01
+
+// SpanContext is the part of a span that is propagated to other services.
+type SpanContext struct {
+	TraceID    TraceID
+	SpanID     SpanID
+	Flags      byte
+	TraceState string
+	// Remote reports whether the span context was extracted from an incoming request.
+	Remote bool
+}
+
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+func (sc SpanContext) IsSampled() bool {
+	return sc.Flags&FlagSampled != 0
+}
+
+type SpanKind int
+
+const (
+	SpanKindInternal SpanKind = iota
+	SpanKindClient
+	SpanKindServer
+)
+
+type StatusCode int
+
+const (
+	StatusUnset StatusCode = iota
+	StatusOK
+	StatusError
+)
+
+// Attribute is a key-value pair describing a span, e.g. http.request.method=GET.
+type Attribute struct {
+	Key   string
+	Value any
+}
+
+func Attr(key string, value any) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+type Tracer interface {
+	// Start starts a span, a child of the span in ctx if there is one, and returns a context holding it.
+	Start(ctx context.Context, name string, opts ...SpanOption) (context.Context, Span)
+}
+
+type Span interface {
+	SpanContext() SpanContext
+	SetAttributes(attrs ...Attribute)
+	SetStatus(code StatusCode, description string)
+	RecordError(err error)
+	// End finishes the span. Calls after the first are ignored.
+	End()
+}
+
+type SpanConfig struct {
+	Kind       SpanKind
+	Attributes []Attribute
+}
+
+type SpanOption func(*SpanConfig)
+
+func WithSpanKind(kind SpanKind) SpanOption {
+	return func(c *SpanConfig) {
+		c.Kind = kind
+	}
+}
+
+func WithAttributes(attrs ...Attribute) SpanOption {
+	return func(c *SpanConfig) {
+		c.Attributes = append(c.Attributes, attrs...)
+	}
+}
+
+// NewSpanConfig applies opts, for Tracer implementations.
+func NewSpanConfig(opts ...SpanOption) SpanConfig {
+	var c SpanConfig
+	for _, opt := range opts {
+		opt(&c)
+	}
+	return c
+}
+
+type spanKey struct{}
+
+// ContextWithSpan returns a context holding span.
+func ContextWithSpan(ctx context.Context, span Span) context.Context {
+	return context.WithValue(ctx, spanKey{}, span)
+}
+
+// ContextWithRemoteSpanContext returns a context whose spans continue the trace of an incoming request.
+func ContextWithRemoteSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	sc.Remote = true
+	return ContextWithSpan(ctx, noopSpan{sc: sc})
+}
+
+// SpanFromContext returns the span in ctx, or a span that does nothing.
+func SpanFromContext(ctx context.Context) Span {
+	if span, ok := ctx.Value(spanKey{}).(Span); ok {
+		return span
+	}
+	return noopSpan{}
+}
+
+// SpanContextFromContext returns the span context of the span in ctx, invalid if there is none.
+// Log adapters use it to add trace_id and span_id to log entries.
+func SpanContextFromContext(ctx context.Context) SpanContext {
+	return SpanFromContext(ctx).SpanContext()
+}
+
+// NoopTracer returns a Tracer that records nothing. Its spans carry the span context of their parent,
+// so propagation still works.
+func NoopTracer() Tracer {
+	return noopTracer{}
+}
+
+type noopTracer struct{}
+
+func (noopTracer) Start(ctx context.Context, name string, opts ...SpanOption) (context.Context, Span) {
+	span := noopSpan{sc: SpanContextFromContext(ctx)}
+	return ContextWithSpan(ctx, span), span
+}
+
+type noopSpan struct {
+	sc SpanContext
+}
+
+func (s noopSpan) SpanContext() SpanContext                      { return s.sc }
+func (s noopSpan) SetAttributes(attrs ...Attribute)              {}
+func (s noopSpan) SetStatus(code StatusCode, description string) {}
+func (s noopSpan) RecordError(err error)                         {}
+func (s noopSpan) End()                                          {}
@@ -0,0 +1,133 @@
+package trace
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTracer_ParentChild(t *testing.T) {
+	exporter := NewInMemoryExporter()
+	tracer := NewTracer(exporter)
+
+	ctx, parent := tracer.Start(context.Background(), "parent", WithAttributes(Attr("user", "u1")))
+	_, child := tracer.Start(ctx, "child", WithSpanKind(SpanKindClient))
+	child.SetAttributes(Attr("attempt", 1))
+	child.RecordError(errors.New("boom"))
+	child.SetStatus(StatusError, "boom")
+	child.End()
+	child.End()
+	parent.End()
+
+	spans := exporter.Spans()
+	require.Len(t, spans, 2)
+	assert.Equal(t, "child", spans[0].Name)
+	assert.Equal(t, SpanKindClient, spans[0].Kind)
+	assert.Equal(t, parent.SpanContext().TraceID, spans[0].SpanContext.TraceID)
+	assert.Equal(t, parent.SpanContext().SpanID, spans[0].Parent.SpanID)
+	assert.Equal(t, StatusError, spans[0].Status)
+	assert.Len(t, spans[0].Errors, 1)
+	attempt, ok := spans[0].Attribute("attempt")
+	assert.True(t, ok)
+	assert.Equal(t, 1, attempt)
+
+	assert.False(t, spans[1].Parent.IsValid())
+	assert.True(t, spans[1].SpanContext.IsSampled())
+	assert.False(t, spans[1].End.Before(spans[1].Start))
+
+	exporter.Reset()
+	assert.Empty(t, exporter.Spans())
+}
+
+func TestTracer_Sampling(t *testing.T) {
+	exporter := NewInMemoryExporter()
+	tracer := NewTracer(exporter, WithSampler(NeverSample))
+
+	ctx, span := tracer.Start(context.Background(), "unsampled")
+	assert.True(t, span.SpanContext().IsValid())
+	_, child := tracer.Start(ctx, "child")
+	child.End()
+	span.End()
+	assert.Empty(t, exporter.Spans())
+
+	// A sampled remote parent wins over the sampler.
+	remote := SpanContext{TraceID: TraceID{1}, SpanID: SpanID{2}, Flags: FlagSampled}
+	_, span = tracer.Start(ContextWithRemoteSpanContext(context.Background(), remote), "server")
+	span.End()
+	require.Len(t, exporter.Spans(), 1)
+	assert.True(t, exporter.Spans()[0].Parent.Remote)
+
+	sampled := 0
+	sampler := RatioSampler(0.25)
+	for i := 0; i < 4000; i++ {
+		if sampler(newTraceID()) {
+			sampled++
+		}
+	}
+	assert.InDelta(t, 1000, sampled, 200)
+	assert.True(t, RatioSampler(1)(TraceID{0xff}))
+	assert.False(t, RatioSampler(0)(TraceID{0xff}))
+}
+
+func TestNoopTracer(t *testing.T) {
+	remote := SpanContext{TraceID: TraceID{1}, SpanID: SpanID{2}}
+	ctx, span := NoopTracer().Start(ContextWithRemoteSpanContext(context.Background(), remote), "noop")
+	span.End()
+	assert.Equal(t, remote.TraceID, SpanContextFromContext(ctx).TraceID)
+
+	assert.False(t, SpanContextFromContext(context.Background()).IsValid())
+}
+
+func TestTraceparent(t *testing.T) {
+	// The example from the W3C Trace Context specification.
+	const value = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	sc, err := ParseTraceparent(value)
+	require.NoError(t, err)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", sc.TraceID.String())
+	assert.Equal(t, "00f067aa0ba902b7", sc.SpanID.String())
+	assert.True(t, sc.IsSampled())
+	assert.Equal(t, value, FormatTraceparent(sc))
+
+	// Future versions may append fields.
+	_, err = ParseTraceparent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra")
+	assert.NoError(t, err)
+
+	for _, invalid := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e473-00f067aa0ba902b7-01",
+	} {
+		_, err := ParseTraceparent(invalid)
+		assert.ErrorIs(t, err, ErrInvalidTraceparent, invalid)
+	}
+}
+
+func TestInjectExtract(t *testing.T) {
+	header := http.Header{}
+	header.Set(HeaderTraceparent, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	header.Set(HeaderTracestate, "congo=t61rcWkgMzE")
+
+	ctx := Extract(context.Background(), header)
+	sc := SpanContextFromContext(ctx)
+	assert.True(t, sc.Remote)
+	assert.Equal(t, "congo=t61rcWkgMzE", sc.TraceState)
+
+	ctx, span := NewTracer(nil).Start(ctx, "client")
+	out := http.Header{}
+	Inject(ctx, out)
+	assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-"+span.SpanContext().SpanID.String()+"-01", out.Get(HeaderTraceparent))
+	assert.Equal(t, "congo=t61rcWkgMzE", out.Get(HeaderTracestate))
+
+	out = http.Header{}
+	Inject(context.Background(), out)
+	assert.Empty(t, out)
+	assert.Equal(t, context.Background(), Extract(context.Background(), http.Header{HeaderTraceparent: {"garbage"}}))
+}
@@ -0,0 +1,215 @@
+package trace
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"sync"
+	"time"
+)
+
+// SpanData is a finished span as handed to an Exporter.
+type SpanData struct {
+	Name              string
+	Kind              SpanKind
+	SpanContext       SpanContext
+	Parent            SpanContext
+	Start             time.Time
+	End               time.Time
+	Attributes        []Attribute
+	Status            StatusCode
+	StatusDescription string
+	Errors            []error
+}
+
+// Attribute returns the value of the last attribute with the given key.
+func (d SpanData) Attribute(key string) (any, bool) {
+	for i := len(d.Attributes) - 1; i >= 0; i-- {
+		if d.Attributes[i].Key == key {
+			return d.Attributes[i].Value, true
+		}
+	}
+	return nil, false
+}
+
+// Exporter receives sampled spans when they end. ExportSpan must not block for long.
+type Exporter interface {
+	ExportSpan(span SpanData)
+}
+
+// Sampler decides whether a new trace is sampled. Child spans follow their parent.
+type Sampler func(traceID TraceID) bool
+
+func AlwaysSample(TraceID) bool { return true }
+func NeverSample(TraceID) bool  { return false }
+
+// RatioSampler samples a fraction of traces, decided from the trace ID so that every service using
+// the same ratio samples the same traces.
+func RatioSampler(ratio float64) Sampler {
+	bound := uint64(ratio * (1 << 63))
+	return func(traceID TraceID) bool {
+		if ratio >= 1 {
+			return true
+		}
+		return binary.BigEndian.Uint64(traceID[8:])>>1 < bound
+	}
+}
+
+type tracer struct {
+	exporter Exporter
+	sampler  Sampler
+	now      func() time.Time
+}
+
+type TracerOption func(*tracer)
+
+// WithSampler sets the sampler of new traces, AlwaysSample by default.
+func WithSampler(sampler Sampler) TracerOption {
+	return func(t *tracer) {
+		t.sampler = sampler
+	}
+}
+
+// NewTracer creates a Tracer that hands sampled spans to exporter when they end.
+func NewTracer(exporter Exporter, opts ...TracerOption) Tracer {
+	t := &tracer{
+		exporter: exporter,
+		sampler:  AlwaysSample,
+		now:      time.Now,
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
+}
+
+func (t *tracer) Start(ctx context.Context, name string, opts ...SpanOption) (context.Context, Span) {
+	config := NewSpanConfig(opts...)
+	parent := SpanContextFromContext(ctx)
+
+	sc := SpanContext{SpanID: newSpanID()}
+	if parent.IsValid() {
+		sc.TraceID = parent.TraceID
+		sc.Flags = parent.Flags
+		sc.TraceState = parent.TraceState
+	} else {
+		sc.TraceID = newTraceID()
+		if t.sampler(sc.TraceID) {
+			sc.Flags = FlagSampled
+		}
+	}
+
+	s := &span{
+		tracer: t,
+		data: SpanData{
+			Name:        name,
+			Kind:        config.Kind,
+			SpanContext: sc,
+			Parent:      parent,
+			Start:       t.now(),
+			Attributes:  config.Attributes,
+		},
+	}
+	return ContextWithSpan(ctx, s), s
+}
+
+type span struct {
+	tracer *tracer
+
+	mu    sync.Mutex
+	data  SpanData
+	ended bool
+}
+
+func (s *span) SpanContext() SpanContext {
+	return s.data.SpanContext
+}
+
+func (s *span) SetAttributes(attrs ...Attribute) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.ended {
+		s.data.Attributes = append(s.data.Attributes, attrs...)
+	}
+}
+
+func (s *span) SetStatus(code StatusCode, description string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.ended {
+		s.data.Status = code
+		s.data.StatusDescription = description
+	}
+}
+
+func (s *span) RecordError(err error) {
+	if err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.ended {
+		s.data.Errors = append(s.data.Errors, err)
+	}
+}
+
+func (s *span) End() {
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.End = s.tracer.now()
+	data := s.data
+	s.mu.Unlock()
+
+	if data.SpanContext.IsSampled() && s.tracer.exporter != nil {
+		s.tracer.exporter.ExportSpan(data)
+	}
+}
+
+func newTraceID() TraceID {
+	var id TraceID
+	for !id.IsValid() {
+		rand.Read(id[:])
+	}
+	return id
+}
+
+func newSpanID() SpanID {
+	var id SpanID
+	for !id.IsValid() {
+		rand.Read(id[:])
+	}
+	return id
+}
+
+// InMemoryExporter keeps finished spans in memory, for tests.
+type InMemoryExporter struct {
+	mu    sync.Mutex
+	spans []SpanData
+}
+
+func NewInMemoryExporter() *InMemoryExporter {
+	return &InMemoryExporter{}
+}
+
+func (e *InMemoryExporter) ExportSpan(span SpanData) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = append(e.spans, span)
+}
+
+// Spans returns the exported spans in the order they ended.
+func (e *InMemoryExporter) Spans() []SpanData {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]SpanData(nil), e.spans...)
+}
+
+func (e *InMemoryExporter) Reset() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = nil
+}